@@ -12,6 +12,9 @@ const (
 	ARRAY_DEF
 	FUNC_DEF
 	FUNC_ARG
+	TYPE_DECL
+	ENUMERATOR
+	DECL_LIST
 	IDENT
 	// expr
 	BINARY_EXPR
@@ -23,185 +26,344 @@ const (
 	DEC_EXPR
 	FUNC_CALL
 	INT_VAL
+	FLOAT_VAL
 	CHAR_VAL
+	STRING_VAL
 	PTR_VAL
 	ADDRESS_VAL
 	ARRAY_INIT
+	MEMBER_EXPR
+	SIZEOF_EXPR
+	CAST_EXPR
+	VA_START_EXPR
+	VA_ARG_EXPR
 	// stmt
 	BLOCK_STMT
 	RETURN_STMT
 	EXPR_STMT
 	IF_STMT
 	FOR_STMT
+	WHILE_STMT
+	DO_WHILE_STMT
+	BREAK_STMT
+	CONTINUE_STMT
+	SWITCH_STMT
+	CASE_STMT
+	LABELED_STMT
+	GOTO_STMT
+	// syntax errors
+	BAD_DECL
+	BAD_STMT
+	BAD_EXPR
 )
 
-type PrimitiveType int
-
-const (
-	C_int PrimitiveType = iota
-	C_void
-	C_char
-	C_float
-	C_long
-	C_short
-	C_double
+type (
+	Node interface {
+		Kind() Kind
+		Pos() token.Position
+	}
 )
 
-func (p PrimitiveType) Bytes() int {
-	switch p {
-	case C_int:
-		return 4
-	case C_char:
-		return 1
-	default:
-		panic("unimplemented type size")
-	}
-}
+type ObjKind int
 
-func (t CType) Bytes() int {
-	if t.Ptr {
-		return 8
-	}
-	return t.Primitive.Bytes()
-}
+const (
+	VarObj ObjKind = iota
+	FuncObj
+	ConstObj // an enumeration constant
+)
 
-type CType struct {
-	Primitive PrimitiveType
-	Ptr       bool
-	Array     bool
+// Object is a declared variable, argument, function or enumeration constant.
+// sema creates one for each declared entity, shared by its redeclarations,
+// and links every use to it. The parser links the enumeration constants
+// it can evaluate earlier, to objects of its own.
+type Object struct {
+	Kind    ObjKind
+	Name    string
+	Type    *CType
+	Decl    Node // *VarDef, *ArrayDef, *FuncDef, *FuncArg, *Enumerator or *StringVal; the definition once seen
+	Value   int  // of a ConstObj
+	Static  bool // a variable of static storage duration, at file scope or declared static
+	Linkage bool // declared at file scope or extern, so that all declarations name the same symbol
 }
 
-func (p PrimitiveType) String() string {
-	switch p {
-	case C_int:
-		return "int"
-	case C_void:
-		return "void"
-	case C_char:
-		return "char"
-	case C_float:
-		return "float"
-	case C_long:
-		return "long"
-	case C_short:
-		return "short"
-	case C_double:
-		return "double"
-	default:
-		panic("undefined Type")
+// IsDefinition reports whether the declaration n defines its object.
+func IsDefinition(n Node) bool {
+	switch v := n.(type) {
+	case *FuncDef:
+		return v.Block != nil
+	case *VarDef:
+		return !v.Extern || v.Init != nil
+	case *ArrayDef:
+		return !v.Extern || v.Init != nil
 	}
+	return true
 }
 
-func (t CType) String() string {
-	s := t.Primitive.String()
-	if t.Ptr {
-		s += " *"
+// IsTentative reports whether the declaration n of an object at file scope
+// is a tentative definition, having neither an initializer nor extern.
+// It defines the object, zero-initialized, unless another one does.
+func IsTentative(n Node) bool {
+	switch v := n.(type) {
+	case *VarDef:
+		return !v.Extern && v.Init == nil
+	case *ArrayDef:
+		return !v.Extern && v.Init == nil
 	}
-	return s
+	return false
 }
 
-type (
-	Node interface {
-		Kind() Kind
-	}
-)
-
 type (
 	Ident struct {
+		Typed
 		Token *token.Token
+		Obj   *Object
 	}
 
 	VarDef struct {
-		Type  CType
-		Token *token.Token
-		Init  *Expr
+		Type   *CType
+		Token  *token.Token
+		Init   *Expr
+		Obj    *Object
+		Static bool // declared static
+		Extern bool // declared extern
 	}
 
 	ArrayDef struct {
-		Type      CType
+		Type      *CType // Len is -1 for "a[]" until sema counts Init
 		Token     *token.Token
 		Subscript *Expr
 		Init      *ArrayInit
+		Obj       *Object
+		Static    bool // declared static
+		Extern    bool // declared extern
 	}
 
+	// FuncDef is a function definition, or a declaration if Block is nil.
 	FuncDef struct {
-		Type  CType
-		Name  string
-		Args  []FuncArg
-		Block BlockStmt
+		Type   *CType // function type
+		Name   string
+		Token  *token.Token
+		Args   []FuncArg
+		Block  *BlockStmt
+		Obj    *Object
+		Static bool // declared static
 	}
 
 	FuncArg struct {
-		Type CType
-		Name *token.Token
+		Type *CType
+		Name *token.Token // nil if the parameter of a declaration is unnamed
+		Obj  *Object
+	}
+
+	// TypeDecl declares a struct, union or enum without declaring a
+	// variable, e.g. "struct S { int a; };", or a typedef name.
+	TypeDecl struct {
+		Type  *CType
+		Token *token.Token
+		Name  *token.Token // declared by typedef, nil otherwise
+	}
+
+	// Enumerator declares an enumeration constant, e.g. "B = 2" in
+	// "enum E { A, B = 2 }".
+	Enumerator struct {
+		Name  *token.Token
+		Value *Expr // nil if the value follows the previous constant
+		Obj   *Object
+	}
+
+	// DeclList is a declaration with several declarators, e.g.
+	// "int a = 1, *b;", each declared in turn.
+	DeclList struct {
+		Token *token.Token
+		List  []Node
+	}
+)
+
+// BadDecl, BadStmt and BadExpr are placeholders for source ranges
+// that contained syntax errors.
+type (
+	BadDecl struct {
+		From, To token.Position
+	}
+
+	BadStmt struct {
+		From, To token.Position
+	}
+
+	BadExpr struct {
+		Typed
+		From, To token.Position
 	}
 )
 
+// Typed is embedded in every expression and holds the type computed by sema.
+type Typed struct {
+	Ty *CType
+}
+
+func (t *Typed) Type() *CType      { return t.Ty }
+func (t *Typed) SetType(ty *CType) { t.Ty = ty }
+
 type (
 	Expr interface {
 		Node
+		Type() *CType
+		SetType(*CType)
 		expr()
 	}
 
 	BinaryExpr struct {
+		Typed
 		X  Expr
 		Op *token.Token
 		Y  Expr
 	}
 
 	CondExpr struct {
+		Typed
 		Cond Expr
 		L    Expr
 		R    Expr
 	}
 
 	UnaryExpr struct {
+		Typed
 		Op   *token.Token
 		Expr Expr
 	}
 
 	AssignExpr struct {
+		Typed
 		L  Expr
 		Op *token.Token
 		R  Expr
 	}
 
-	// a[0], b[10]
+	// a[0], p[i][j]
 	SubscriptExpr struct {
-		Token *token.Token
-		Expr  Expr
+		Typed
+		X      Expr
+		Lbrack *token.Token
+		Index  Expr
 	}
 
 	IncExpr struct {
-		Ident Ident
+		Typed
+		Op      *token.Token
+		X       Expr
+		Postfix bool // i++ rather than ++i
 	}
 
 	DecExpr struct {
-		Ident Ident
+		Typed
+		Op      *token.Token
+		X       Expr
+		Postfix bool // i-- rather than --i
 	}
 
+	// IntVal is an integer constant of type int, or of the type given by
+	// Unsigned and Long.
 	IntVal struct {
-		Num int
+		Typed
+		Num      int
+		Unsigned bool
+		Long     bool
+		Token    *token.Token
+	}
+
+	// FloatVal is a floating constant of type double, or float if it
+	// has the suffix f.
+	FloatVal struct {
+		Typed
+		Num   float64
+		Float bool
+		Token *token.Token
 	}
 
 	CharVal struct {
+		Typed
 		Token *token.Token
 	}
 
+	// StringVal is a string literal, including the adjacent literals
+	// concatenated to it. Obj is the unnamed array holding it.
+	StringVal struct {
+		Typed
+		Token *token.Token
+		Val   []byte
+		Obj   *Object
+	}
+
+	// FuncCall calls Func, a function designator or a pointer to a
+	// function, e.g. f(x) or (*fp)(x).
 	FuncCall struct {
-		Ident Ident
-		Args  []Expr
+		Typed
+		Func Expr
+		Args []Expr
 	}
 
+	// *X
 	PtrVal struct {
+		Typed
 		Token *token.Token
+		X     Expr
 	}
+
+	// &X
 	AddressVal struct {
+		Typed
 		Token *token.Token
+		X     Expr
 	}
 
 	ArrayInit struct {
-		List []Expr
+		Typed
+		Token *token.Token
+		List  []Expr
+	}
+
+	// s.a, p->a
+	MemberExpr struct {
+		Typed
+		X     Expr
+		Op    *token.Token // . or ->
+		Name  *token.Token
+		Field *Field
+	}
+
+	// SizeofExpr is "sizeof x", "sizeof(T)" or "_Alignof(T)", a constant
+	// of type unsigned long. X is not evaluated.
+	SizeofExpr struct {
+		Typed
+		Token *token.Token // sizeof or _Alignof
+		X     Expr         // nil for a type name
+		Of    *CType       // the type name, or the type of X once computed by sema
+	}
+
+	// (T)X
+	CastExpr struct {
+		Typed
+		Lparen *token.Token
+		To     *CType
+		X      Expr
+	}
+
+	// VaStartExpr is "__builtin_va_start(ap, last)", which va_start
+	// expands to. It sets ap to the arguments after the last parameter.
+	VaStartExpr struct {
+		Typed
+		Token *token.Token
+		Ap    Expr
+		Last  Expr
+	}
+
+	// VaArgExpr is "__builtin_va_arg(ap, T)", which va_arg expands to.
+	// It reads the next argument from ap as a T.
+	VaArgExpr struct {
+		Typed
+		Token *token.Token
+		Ap    Expr
+		To    *CType
 	}
 )
 
@@ -212,11 +374,13 @@ type (
 	}
 
 	BlockStmt struct {
+		Token *token.Token
 		Nodes []Node
 	}
 
 	ReturnStmt struct {
-		Expr Expr
+		Token *token.Token
+		Expr  Expr // nil for "return;"
 	}
 
 	ExprStmt struct {
@@ -224,16 +388,67 @@ type (
 	}
 
 	IfStmt struct {
+		Token *token.Token // if or else
 		Expr  *Expr
-		Block BlockStmt
+		Block *BlockStmt
 		Else  *IfStmt
 	}
 
 	ForStmt struct {
+		Token *token.Token
 		E1    Node
 		E2    *Expr
 		E3    *Expr
-		Block BlockStmt
+		Block *BlockStmt
+	}
+
+	WhileStmt struct {
+		Token *token.Token
+		Cond  Expr
+		Body  Stmt
+	}
+
+	// do Body while (Cond);
+	DoWhileStmt struct {
+		Token *token.Token
+		Body  Stmt
+		Cond  Expr
+	}
+
+	BreakStmt struct {
+		Token *token.Token
+	}
+
+	ContinueStmt struct {
+		Token *token.Token
+	}
+
+	SwitchStmt struct {
+		Token   *token.Token
+		Expr    Expr
+		Block   *BlockStmt
+		Cases   []*CaseStmt // case labels in source order, set by sema
+		Default *CaseStmt   // set by sema
+	}
+
+	// case Expr: Stmt, or default: Stmt if Expr is nil
+	CaseStmt struct {
+		Token *token.Token
+		Expr  Expr
+		Value int // value of Expr, set by sema
+		Stmt  Stmt
+	}
+
+	// Label: Stmt
+	LabeledStmt struct {
+		Label *token.Token
+		Stmt  Stmt
+	}
+
+	GotoStmt struct {
+		Token  *token.Token
+		Label  *token.Token
+		Target *LabeledStmt // set by sema
 	}
 )
 
@@ -241,6 +456,9 @@ func (VarDef) Kind() Kind        { return VAR_DEF }
 func (ArrayDef) Kind() Kind      { return ARRAY_DEF }
 func (FuncDef) Kind() Kind       { return FUNC_DEF }
 func (FuncArg) Kind() Kind       { return FUNC_ARG }
+func (TypeDecl) Kind() Kind      { return TYPE_DECL }
+func (Enumerator) Kind() Kind    { return ENUMERATOR }
+func (DeclList) Kind() Kind      { return DECL_LIST }
 func (Ident) Kind() Kind         { return IDENT }
 func (BinaryExpr) Kind() Kind    { return BINARY_EXPR }
 func (CondExpr) Kind() Kind      { return COND_EXPR }
@@ -251,15 +469,90 @@ func (IncExpr) Kind() Kind       { return INC_EXPR }
 func (DecExpr) Kind() Kind       { return DEC_EXPR }
 func (FuncCall) Kind() Kind      { return FUNC_CALL }
 func (IntVal) Kind() Kind        { return INT_VAL }
+func (FloatVal) Kind() Kind      { return FLOAT_VAL }
 func (CharVal) Kind() Kind       { return CHAR_VAL }
+func (StringVal) Kind() Kind     { return STRING_VAL }
 func (PtrVal) Kind() Kind        { return PTR_VAL }
 func (AddressVal) Kind() Kind    { return ADDRESS_VAL }
 func (ArrayInit) Kind() Kind     { return ARRAY_INIT }
+func (MemberExpr) Kind() Kind    { return MEMBER_EXPR }
+func (SizeofExpr) Kind() Kind    { return SIZEOF_EXPR }
+func (CastExpr) Kind() Kind      { return CAST_EXPR }
+func (VaStartExpr) Kind() Kind   { return VA_START_EXPR }
+func (VaArgExpr) Kind() Kind     { return VA_ARG_EXPR }
 func (BlockStmt) Kind() Kind     { return BLOCK_STMT }
 func (ReturnStmt) Kind() Kind    { return RETURN_STMT }
 func (ExprStmt) Kind() Kind      { return EXPR_STMT }
 func (IfStmt) Kind() Kind        { return IF_STMT }
 func (ForStmt) Kind() Kind       { return FOR_STMT }
+func (WhileStmt) Kind() Kind     { return WHILE_STMT }
+func (DoWhileStmt) Kind() Kind   { return DO_WHILE_STMT }
+func (BreakStmt) Kind() Kind     { return BREAK_STMT }
+func (ContinueStmt) Kind() Kind  { return CONTINUE_STMT }
+func (SwitchStmt) Kind() Kind    { return SWITCH_STMT }
+func (CaseStmt) Kind() Kind      { return CASE_STMT }
+func (LabeledStmt) Kind() Kind   { return LABELED_STMT }
+func (GotoStmt) Kind() Kind      { return GOTO_STMT }
+func (BadDecl) Kind() Kind       { return BAD_DECL }
+func (BadStmt) Kind() Kind       { return BAD_STMT }
+func (BadExpr) Kind() Kind       { return BAD_EXPR }
+
+func (n VarDef) Pos() token.Position        { return n.Token.Pos }
+func (n ArrayDef) Pos() token.Position      { return n.Token.Pos }
+func (n FuncDef) Pos() token.Position       { return n.Token.Pos }
+func (n FuncArg) Pos() token.Position       { return n.Name.Pos }
+func (n TypeDecl) Pos() token.Position      { return n.Token.Pos }
+func (n Enumerator) Pos() token.Position    { return n.Name.Pos }
+func (n DeclList) Pos() token.Position      { return n.Token.Pos }
+func (n Ident) Pos() token.Position         { return n.Token.Pos }
+func (n BinaryExpr) Pos() token.Position    { return n.X.Pos() }
+func (n CondExpr) Pos() token.Position      { return n.Cond.Pos() }
+func (n UnaryExpr) Pos() token.Position     { return n.Op.Pos }
+func (n AssignExpr) Pos() token.Position    { return n.L.Pos() }
+func (n SubscriptExpr) Pos() token.Position { return n.X.Pos() }
+func (n FuncCall) Pos() token.Position      { return n.Func.Pos() }
+func (n IntVal) Pos() token.Position        { return n.Token.Pos }
+func (n FloatVal) Pos() token.Position      { return n.Token.Pos }
+func (n CharVal) Pos() token.Position       { return n.Token.Pos }
+func (n StringVal) Pos() token.Position     { return n.Token.Pos }
+func (n PtrVal) Pos() token.Position        { return n.Token.Pos }
+func (n AddressVal) Pos() token.Position    { return n.Token.Pos }
+func (n ArrayInit) Pos() token.Position     { return n.Token.Pos }
+func (n MemberExpr) Pos() token.Position    { return n.X.Pos() }
+func (n SizeofExpr) Pos() token.Position    { return n.Token.Pos }
+func (n CastExpr) Pos() token.Position      { return n.Lparen.Pos }
+func (n VaStartExpr) Pos() token.Position   { return n.Token.Pos }
+func (n VaArgExpr) Pos() token.Position     { return n.Token.Pos }
+func (n BlockStmt) Pos() token.Position     { return n.Token.Pos }
+func (n ReturnStmt) Pos() token.Position    { return n.Token.Pos }
+func (n ExprStmt) Pos() token.Position      { return n.Expr.Pos() }
+func (n IfStmt) Pos() token.Position        { return n.Token.Pos }
+func (n ForStmt) Pos() token.Position       { return n.Token.Pos }
+func (n WhileStmt) Pos() token.Position     { return n.Token.Pos }
+func (n DoWhileStmt) Pos() token.Position   { return n.Token.Pos }
+func (n BreakStmt) Pos() token.Position     { return n.Token.Pos }
+func (n ContinueStmt) Pos() token.Position  { return n.Token.Pos }
+func (n SwitchStmt) Pos() token.Position    { return n.Token.Pos }
+func (n CaseStmt) Pos() token.Position      { return n.Token.Pos }
+func (n LabeledStmt) Pos() token.Position   { return n.Label.Pos }
+func (n GotoStmt) Pos() token.Position      { return n.Token.Pos }
+func (n BadDecl) Pos() token.Position       { return n.From }
+func (n BadStmt) Pos() token.Position       { return n.From }
+func (n BadExpr) Pos() token.Position       { return n.From }
+
+func (n IncExpr) Pos() token.Position {
+	if n.Postfix {
+		return n.X.Pos()
+	}
+	return n.Op.Pos
+}
+
+func (n DecExpr) Pos() token.Position {
+	if n.Postfix {
+		return n.X.Pos()
+	}
+	return n.Op.Pos
+}
 
 func (Ident) expr()         {}
 func (BinaryExpr) expr()    {}
@@ -271,17 +564,58 @@ func (IncExpr) expr()       {}
 func (DecExpr) expr()       {}
 func (FuncCall) expr()      {}
 func (IntVal) expr()        {}
+func (FloatVal) expr()      {}
 func (CharVal) expr()       {}
+func (StringVal) expr()     {}
 func (PtrVal) expr()        {}
 func (AddressVal) expr()    {}
 func (ArrayInit) expr()     {}
-
-func (BlockStmt) stmt()  {}
-func (ReturnStmt) stmt() {}
-func (ExprStmt) stmt()   {}
-func (IfStmt) stmt()     {}
-func (ForStmt) stmt()    {}
+func (MemberExpr) expr()    {}
+func (SizeofExpr) expr()    {}
+func (CastExpr) expr()      {}
+func (VaStartExpr) expr()   {}
+func (VaArgExpr) expr()     {}
+func (BadExpr) expr()       {}
+
+func (BlockStmt) stmt()    {}
+func (ReturnStmt) stmt()   {}
+func (ExprStmt) stmt()     {}
+func (IfStmt) stmt()       {}
+func (ForStmt) stmt()      {}
+func (WhileStmt) stmt()    {}
+func (DoWhileStmt) stmt()  {}
+func (BreakStmt) stmt()    {}
+func (ContinueStmt) stmt() {}
+func (SwitchStmt) stmt()   {}
+func (CaseStmt) stmt()     {}
+func (LabeledStmt) stmt()  {}
+func (GotoStmt) stmt()     {}
+func (BadStmt) stmt()      {}
 
 func (i IntVal) Str() string  { return fmt.Sprintf("$%d", i.Num) }
-func (c CharVal) Str() string { return "$" + fmt.Sprintf("%d", c.Token.Str[0]) }
-func (i Ident) Str() string   { return "_" + i.Token.String() }
+func (c CharVal) Str() string { return fmt.Sprintf("$%d", c.Value()) }
+
+// Value returns the value of the character constant, which has type int
+// with the byte read as a signed char.
+func (c CharVal) Value() int { return int(int8(c.Token.Str[0])) }
+
+// ConstType returns the type of the integer constant given by its suffixes.
+func (i IntVal) ConstType() *CType {
+	switch {
+	case i.Long && i.Unsigned:
+		return ULongType
+	case i.Long:
+		return LongType
+	case i.Unsigned:
+		return UIntType
+	}
+	return IntType
+}
+
+// ConstType returns the type of the floating constant given by its suffix.
+func (f FloatVal) ConstType() *CType {
+	if f.Float {
+		return FloatType
+	}
+	return DoubleType
+}
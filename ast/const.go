@@ -0,0 +1,519 @@
+package ast
+
+import (
+	"gocc/token"
+	"math"
+	"math/bits"
+)
+
+// Constant expressions are evaluated with the types computed by sema,
+// or before sema, as for array sizes in declarators, with the types the
+// constants and operators give them. Integer values are kept in an int
+// converted to their type, so an unsigned long above 2^63 is negative.
+
+// ConstError is the reason C does not define the result of an operation
+// on integer constants.
+type ConstError int
+
+const (
+	Overflow      ConstError = iota + 1 // signed result does not fit, it wraps around
+	DivByZero                           // division or remainder by zero
+	NegativeShift                       // shift count is negative
+	WideShift                           // shift count is not less than the width of the type
+	NegativeValue                       // left shift of a negative value
+)
+
+// IntOp computes x op y on integers of type t, which both operands are
+// converted to except the right operand of a shift. C leaves the result
+// undefined on any error, but one that overflows or shifts a negative
+// value is still computed, wrapping around as the machine does. The
+// result of the other errors is 0.
+func IntOp(op token.TokenKind, t *CType, x, y int) (int, ConstError) {
+	width := t.Bytes() * 8
+	switch op {
+	case token.DIV, token.REM:
+		if y == 0 {
+			return 0, DivByZero
+		}
+	case token.LSHIFT, token.RSHIFT:
+		switch {
+		case y < 0:
+			return 0, NegativeShift
+		case y >= width:
+			return 0, WideShift
+		}
+	}
+
+	var r int
+	switch op {
+	case token.ADD:
+		r = x + y
+	case token.SUB:
+		r = x - y
+	case token.MUL:
+		r = x * y
+	case token.DIV:
+		if t.Unsigned {
+			r = int(uint64(x) / uint64(y))
+		} else if y != -1 {
+			r = x / y
+		} else {
+			r = -x
+		}
+	case token.REM:
+		if t.Unsigned {
+			r = int(uint64(x) % uint64(y))
+		} else if y != -1 {
+			r = x % y
+		}
+	case token.AND:
+		r = x & y
+	case token.OR:
+		r = x | y
+	case token.XOR:
+		r = x ^ y
+	case token.LSHIFT:
+		r = x << uint(y)
+	case token.RSHIFT:
+		if t.Unsigned {
+			r = int(uint64(x) >> uint(y))
+		} else {
+			r = x >> uint(y)
+		}
+	}
+	switch {
+	case t.Unsigned:
+	case op == token.LSHIFT && x < 0:
+		return ConvertInt(t, r), NegativeValue
+	case overflows(op, width, x, y, r):
+		return ConvertInt(t, r), Overflow
+	}
+	return ConvertInt(t, r), 0
+}
+
+// computed reports whether IntOp computes a result despite err.
+func (err ConstError) computed() bool {
+	return err == 0 || err == Overflow || err == NegativeValue
+}
+
+// overflows reports whether r, the result of x op y computed on 64 bits,
+// is not the exact result on signed integers of the given width.
+func overflows(op token.TokenKind, width, x, y, r int) bool {
+	switch {
+	case op == token.LSHIFT:
+		// the sign bit may be shifted into, but not past
+		return bits.Len64(uint64(x))+y > width
+	case width < 64:
+		// the operands are narrow enough for r to be exact
+		return r < -1<<(width-1) || r >= 1<<(width-1)
+	}
+	switch op {
+	case token.ADD:
+		return (x >= 0) == (y >= 0) && (r >= 0) != (x >= 0)
+	case token.SUB:
+		return (x >= 0) != (y >= 0) && (r >= 0) != (x >= 0)
+	case token.MUL:
+		return x != 0 && (r/x != y || x == -1 && y == math.MinInt64)
+	case token.DIV:
+		return x == math.MinInt64 && y == -1
+	}
+	return false
+}
+
+// ConvertInt converts the integer v to the integer type t.
+func ConvertInt(t *CType, v int) int {
+	if t.Kind == C_bool {
+		return boolInt(v != 0)
+	}
+	switch t.Bytes() {
+	case 1:
+		if t.Unsigned {
+			return int(uint8(v))
+		}
+		return int(int8(v))
+	case 2:
+		if t.Unsigned {
+			return int(uint16(v))
+		}
+		return int(int16(v))
+	case 4:
+		if t.Unsigned {
+			return int(uint32(v))
+		}
+		return int(int32(v))
+	}
+	return v
+}
+
+// IntConst evaluates the integer constant expression e. It is not
+// constant if IntOp computes no result for one of its operations, like
+// a division by zero.
+func IntConst(e Expr) (int, bool) {
+	t := typeOf(e)
+	if t == nil || !t.IsInteger() {
+		return 0, false
+	}
+	switch v := e.(type) {
+	case *IntVal:
+		return v.Num, true
+	case *CharVal:
+		return v.Value(), true
+	case *Ident:
+		if v.Obj != nil && v.Obj.Kind == ConstObj {
+			return v.Obj.Value, true
+		}
+	case *SizeofExpr:
+		if v.Of == nil || !v.Of.IsComplete() || v.Of.Kind == C_func {
+			break
+		}
+		if v.Token.Kind == token.ALIGNOF {
+			return v.Of.Align(), true
+		}
+		return v.Of.Bytes(), true
+	case *CastExpr:
+		return convertConst(t, v.X)
+	case *UnaryExpr:
+		switch v.Op.Kind {
+		case token.NOT:
+			x, ok := BoolConst(v.Expr)
+			return boolInt(!x), ok
+		case token.ADD:
+			return convertConst(t, v.Expr)
+		case token.SUB:
+			x, ok := convertConst(t, v.Expr)
+			n, _ := IntOp(token.SUB, t, 0, x)
+			return n, ok
+		case token.TILDE:
+			x, ok := convertConst(t, v.Expr)
+			return ConvertInt(t, ^x), ok
+		}
+	case *BinaryExpr:
+		return binaryConst(v, t)
+	case *CondExpr:
+		cond, ok := BoolConst(v.Cond)
+		switch {
+		case !ok:
+		case cond:
+			return convertConst(t, v.L)
+		default:
+			return convertConst(t, v.R)
+		}
+	}
+	return 0, false
+}
+
+func binaryConst(b *BinaryExpr, t *CType) (int, bool) {
+	switch op := b.Op.Kind; op {
+	case token.LAND, token.LOR:
+		// a false operand decides &&, a true operand decides ||
+		x, ok := BoolConst(b.X)
+		if !ok || x == (op == token.LOR) {
+			return boolInt(x), ok
+		}
+		y, ok := BoolConst(b.Y)
+		return boolInt(y), ok
+	case token.EQ, token.NE, token.LT, token.LE, token.GT, token.GE:
+		return compareConst(b)
+	case token.LSHIFT, token.RSHIFT:
+		x, okx := convertConst(t, b.X)
+		y, oky := IntConst(b.Y)
+		n, err := IntOp(op, t, x, y)
+		return n, okx && oky && err.computed()
+	default:
+		x, okx := convertConst(t, b.X)
+		y, oky := convertConst(t, b.Y)
+		n, err := IntOp(op, t, x, y)
+		return n, okx && oky && err.computed()
+	}
+}
+
+// compareConst evaluates the comparison b of arithmetic constants.
+func compareConst(b *BinaryExpr) (int, bool) {
+	tx, ty := typeOf(b.X), typeOf(b.Y)
+	if tx == nil || ty == nil || !tx.IsArith() || !ty.IsArith() {
+		return 0, false
+	}
+	op := b.Op.Kind
+	t := UsualArith(tx, ty)
+	if t.IsFloat() {
+		x, okx := FloatConst(b.X)
+		y, oky := FloatConst(b.Y)
+		return boolInt(compare(op, x < y, x == y, x > y)), okx && oky
+	}
+	x, okx := convertConst(t, b.X)
+	y, oky := convertConst(t, b.Y)
+	less := x < y
+	if t.Unsigned {
+		less = uint64(x) < uint64(y)
+	}
+	return boolInt(compare(op, less, x == y, !less && x != y)), okx && oky
+}
+
+// compare returns the result of the comparison op of operands that are
+// less, equal or greater, or none of these if one is a NaN.
+func compare(op token.TokenKind, less, equal, greater bool) bool {
+	switch op {
+	case token.EQ:
+		return equal
+	case token.NE:
+		return !equal
+	case token.LT:
+		return less
+	case token.LE:
+		return less || equal
+	case token.GT:
+		return greater
+	}
+	return greater || equal
+}
+
+// convertConst evaluates the arithmetic constant expression e converted
+// to the integer type t.
+func convertConst(t *CType, e Expr) (int, bool) {
+	if et := typeOf(e); et != nil && et.IsFloat() {
+		f, ok := FloatConst(e)
+		if !ok {
+			return 0, false
+		}
+		return floatToInt(t, f)
+	}
+	n, ok := IntConst(e)
+	return ConvertInt(t, n), ok
+}
+
+// floatToInt truncates f to the integer type t. The result is undefined
+// if it is out of range of t.
+func floatToInt(t *CType, f float64) (int, bool) {
+	if t.Kind == C_bool {
+		return boolInt(f != 0), true
+	}
+	f = math.Trunc(f)
+	width := float64(t.Bytes() * 8)
+	switch {
+	case t.Unsigned && f >= 0 && f < math.Exp2(width):
+		return ConvertInt(t, int(uint64(f))), true
+	case !t.Unsigned && f >= -math.Exp2(width-1) && f < math.Exp2(width-1):
+		return int(f), true
+	}
+	return 0, false
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// BoolConst evaluates the truth of the arithmetic constant expression e.
+func BoolConst(e Expr) (bool, bool) {
+	t := typeOf(e)
+	switch {
+	case t == nil:
+	case t.IsFloat():
+		f, ok := FloatConst(e)
+		return f != 0, ok
+	case t.IsInteger():
+		n, ok := IntConst(e)
+		return n != 0, ok
+	}
+	return false, false
+}
+
+// FloatConst evaluates the arithmetic constant expression e, which
+// may mix integer and floating constants. Operations on floats are
+// rounded to float as they are at run time.
+func FloatConst(e Expr) (float64, bool) {
+	t := typeOf(e)
+	if t == nil || !t.IsArith() {
+		return 0, false
+	}
+	if t.IsInteger() {
+		n, ok := IntConst(e)
+		if t.Unsigned && t.Bytes() == 8 {
+			return float64(uint64(n)), ok
+		}
+		return float64(n), ok
+	}
+	switch v := e.(type) {
+	case *FloatVal:
+		return round(t, v.Num), true
+	case *CastExpr:
+		f, ok := FloatConst(v.X)
+		return round(t, f), ok
+	case *UnaryExpr:
+		f, ok := FloatConst(v.Expr)
+		switch v.Op.Kind {
+		case token.ADD:
+			return round(t, f), ok
+		case token.SUB:
+			return -round(t, f), ok
+		}
+	case *BinaryExpr:
+		x, okx := FloatConst(v.X)
+		y, oky := FloatConst(v.Y)
+		if !okx || !oky {
+			break
+		}
+		x, y = round(t, x), round(t, y)
+		switch v.Op.Kind {
+		case token.ADD:
+			return round(t, x+y), true
+		case token.SUB:
+			return round(t, x-y), true
+		case token.MUL:
+			return round(t, x*y), true
+		case token.DIV:
+			return round(t, x/y), true
+		}
+	case *CondExpr:
+		cond, ok := BoolConst(v.Cond)
+		switch {
+		case !ok:
+		case cond:
+			f, ok := FloatConst(v.L)
+			return round(t, f), ok
+		default:
+			f, ok := FloatConst(v.R)
+			return round(t, f), ok
+		}
+	}
+	return 0, false
+}
+
+// round rounds f to the floating type t.
+func round(t *CType, f float64) float64 {
+	if t.Kind == C_float {
+		return float64(float32(f))
+	}
+	return f
+}
+
+// typeOf returns the type of e computed by sema. Before sema, it returns
+// the type of e if e is a constant expression and nil otherwise.
+func typeOf(e Expr) *CType {
+	if t := e.Type(); t != nil {
+		return t
+	}
+	switch v := e.(type) {
+	case *IntVal:
+		return v.ConstType()
+	case *FloatVal:
+		return v.ConstType()
+	case *CharVal:
+		return IntType
+	case *Ident:
+		if v.Obj != nil && v.Obj.Kind == ConstObj {
+			return v.Obj.Type
+		}
+	case *SizeofExpr:
+		return ULongType
+	case *CastExpr:
+		return v.To
+	case *UnaryExpr:
+		x := typeOf(v.Expr)
+		switch {
+		case x == nil || !x.IsArith():
+		case v.Op.Kind == token.NOT:
+			return IntType
+		case v.Op.Kind == token.ADD, v.Op.Kind == token.SUB, v.Op.Kind == token.TILDE:
+			return Promote(x)
+		}
+	case *BinaryExpr:
+		x, y := typeOf(v.X), typeOf(v.Y)
+		if x == nil || y == nil || !x.IsArith() || !y.IsArith() {
+			break
+		}
+		switch v.Op.Kind {
+		case token.LAND, token.LOR, token.EQ, token.NE, token.LT, token.LE, token.GT, token.GE:
+			return IntType
+		case token.LSHIFT, token.RSHIFT:
+			return Promote(x)
+		}
+		return UsualArith(x, y)
+	case *CondExpr:
+		x, y := typeOf(v.L), typeOf(v.R)
+		if x != nil && y != nil && x.IsArith() && y.IsArith() {
+			return UsualArith(x, y)
+		}
+	}
+	return nil
+}
+
+// AddrConst evaluates the address constant e, which is the address of
+// an object of static storage duration or a function plus an offset in
+// bytes, e.g. &a[2], &s.x, a + 1 or f, or a null or other absolute
+// address with a nil object, e.g. (void *)0. Types must have been computed by sema.
+func AddrConst(e Expr) (*Object, int, bool) {
+	switch v := e.(type) {
+	case *AddressVal:
+		return objectAddr(v.X)
+	case *CastExpr:
+		if !v.To.IsPtr() {
+			break
+		}
+		if n, ok := IntConst(v.X); ok {
+			return nil, n, true
+		}
+		return AddrConst(v.X)
+	case *Ident, *StringVal:
+		if t := v.Type(); t.IsArray() || t.IsFunc() {
+			return objectAddr(v)
+		}
+	case *BinaryExpr:
+		x, y := v.X, v.Y
+		if v.Op.Kind == token.ADD && y.Type().Decay().IsPtr() {
+			x, y = y, x
+		}
+		if v.Op.Kind != token.ADD && v.Op.Kind != token.SUB {
+			break
+		}
+		obj, off, ok := AddrConst(x)
+		n, isInt := IntConst(y)
+		if !ok || !isInt {
+			break
+		}
+		if v.Op.Kind == token.SUB {
+			n = -n
+		}
+		return obj, off + n*x.Type().Decay().Elem().Bytes(), true
+	}
+	return nil, 0, false
+}
+
+// objectAddr returns the object of static storage duration or the
+// function designated by e and the offset of e in it.
+func objectAddr(e Expr) (*Object, int, bool) {
+	switch v := e.(type) {
+	case *Ident:
+		if v.Obj != nil && (v.Obj.Static || v.Obj.Kind == FuncObj) {
+			return v.Obj, 0, true
+		}
+	case *StringVal:
+		return v.Obj, 0, v.Obj != nil
+	case *SubscriptExpr:
+		i, isInt := IntConst(v.Index)
+		if !isInt || !v.X.Type().IsArray() {
+			break
+		}
+		obj, off, ok := objectAddr(v.X)
+		return obj, off + i*v.Type().Bytes(), ok
+	case *MemberExpr:
+		if v.Op.Kind != token.PERIOD || v.Field == nil {
+			break
+		}
+		obj, off, ok := objectAddr(v.X)
+		return obj, off + v.Field.Offset, ok
+	}
+	return nil, 0, false
+}
+
+// StringInit returns the string literal in init initializing an array
+// of type t, as in char s[] = "abc" or char s[] = {"abc"}.
+func StringInit(t *CType, init *ArrayInit) (*StringVal, bool) {
+	if init == nil || len(init.List) != 1 || t.Elem().Kind != C_char {
+		return nil, false
+	}
+	str, ok := init.List[0].(*StringVal)
+	return str, ok
+}
@@ -0,0 +1,66 @@
+package ast
+
+import (
+	"gocc/token"
+	"math"
+	"testing"
+)
+
+func TestIntOp(t *testing.T) {
+	tests := []struct {
+		op     token.TokenKind
+		ty     *CType
+		x, y   int
+		expect int
+		err    ConstError
+	}{
+		{token.ADD, IntType, 2, 3, 5, 0},
+		{token.ADD, IntType, math.MaxInt32, 1, math.MinInt32, Overflow},
+		{token.ADD, UIntType, math.MaxUint32, 1, 0, 0},
+		{token.SUB, IntType, 0, math.MinInt32, math.MinInt32, Overflow},
+		{token.SUB, LongType, math.MinInt64, 1, math.MaxInt64, Overflow},
+		{token.MUL, LongType, 1 << 32, 1 << 31, math.MinInt64, Overflow},
+		{token.MUL, IntType, -4, 5, -20, 0},
+		{token.DIV, IntType, -7, 2, -3, 0},
+		{token.DIV, IntType, math.MinInt32, -1, math.MinInt32, Overflow},
+		{token.DIV, ULongType, -1, 2, math.MaxInt64, 0},
+		{token.REM, IntType, -7, 2, -1, 0},
+		{token.REM, IntType, 1, 0, 0, DivByZero},
+		{token.DIV, UIntType, 1, 0, 0, DivByZero},
+		{token.LSHIFT, IntType, 1, 31, math.MinInt32, 0},
+		{token.LSHIFT, IntType, 3, 31, math.MinInt32, Overflow},
+		{token.LSHIFT, IntType, -1, 2, -4, NegativeValue},
+		{token.LSHIFT, UIntType, 3, 31, 1 << 31, 0},
+		{token.LSHIFT, IntType, 1, 32, 0, WideShift},
+		{token.RSHIFT, IntType, -16, 2, -4, 0},
+		{token.RSHIFT, ULongType, -1, 60, 15, 0},
+		{token.RSHIFT, IntType, 1, -1, 0, NegativeShift},
+		{token.XOR, UCharType, 0xf0, 0xff, 0x0f, 0},
+	}
+	for _, tt := range tests {
+		n, err := IntOp(tt.op, tt.ty, tt.x, tt.y)
+		if n != tt.expect || err != tt.err {
+			t.Errorf("%d %s %d as %s: expected %d (error %d), but got %d (error %d)", tt.x, tt.op, tt.y, tt.ty, tt.expect, tt.err, n, err)
+		}
+	}
+}
+
+func TestConvertInt(t *testing.T) {
+	tests := []struct {
+		ty        *CType
+		v, expect int
+	}{
+		{CharType, 300, 44},
+		{CharType, 255, -1},
+		{UCharType, -1, 255},
+		{ShortType, 0x18000, -0x8000},
+		{UIntType, -1, math.MaxUint32},
+		{IntType, 1 << 32, 0},
+		{LongType, -1, -1},
+	}
+	for _, tt := range tests {
+		if n := ConvertInt(tt.ty, tt.v); n != tt.expect {
+			t.Errorf("%d as %s: expected %d, but got %d", tt.v, tt.ty, tt.expect, n)
+		}
+	}
+}
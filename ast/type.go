@@ -0,0 +1,475 @@
+package ast
+
+import (
+	"fmt"
+	"gocc/token"
+	"strings"
+)
+
+type TypeKind int
+
+const (
+	C_void TypeKind = iota
+	C_bool
+	C_char
+	C_short
+	C_int
+	C_long
+	C_float
+	C_double
+	C_ldouble // long double, which only declarations may use
+	C_enum
+	C_ptr
+	C_array
+	C_func
+	C_struct // struct or union, see CType.Struct
+)
+
+// CType is a C type. Derived types refer to the type they are derived
+// from, e.g. int ** is a pointer to a pointer to int. Types may be
+// shared and must not be modified once built.
+type CType struct {
+	Kind     TypeKind
+	Unsigned bool
+	Const    bool
+	Volatile bool
+
+	Base     *CType      // pointee, array element or function result
+	Len      int         // number of array elements, -1 if not known
+	Params   []*CType    // function parameters
+	Variadic bool        // function takes "..." after Params
+	NoProto  bool        // function declared without parameters, as in int f()
+	Struct   *StructType // for C_struct
+	Enum     *EnumType   // for C_enum
+}
+
+var (
+	VoidType   = &CType{Kind: C_void}
+	BoolType   = &CType{Kind: C_bool}
+	CharType   = &CType{Kind: C_char}
+	ShortType  = &CType{Kind: C_short}
+	IntType    = &CType{Kind: C_int}
+	LongType   = &CType{Kind: C_long}
+	UCharType  = &CType{Kind: C_char, Unsigned: true}
+	UShortType = &CType{Kind: C_short, Unsigned: true}
+	UIntType   = &CType{Kind: C_int, Unsigned: true}
+	ULongType  = &CType{Kind: C_long, Unsigned: true}
+	FloatType  = &CType{Kind: C_float}
+	DoubleType = &CType{Kind: C_double}
+
+	LongDoubleType = &CType{Kind: C_ldouble}
+)
+
+func PointerTo(base *CType) *CType {
+	return &CType{Kind: C_ptr, Base: base}
+}
+
+// ArrayOf returns the type of an array of n elements, n < 0 if unknown.
+func ArrayOf(elem *CType, n int) *CType {
+	return &CType{Kind: C_array, Base: elem, Len: n}
+}
+
+func FuncOf(result *CType, params []*CType, variadic bool) *CType {
+	return &CType{Kind: C_func, Base: result, Params: params, Variadic: variadic}
+}
+
+func StructOf(s *StructType) *CType {
+	return &CType{Kind: C_struct, Struct: s}
+}
+
+func EnumOf(e *EnumType) *CType {
+	return &CType{Kind: C_enum, Enum: e}
+}
+
+// Qualified returns t with the qualifiers const and volatile added.
+func (t *CType) Qualified(c, v bool) *CType {
+	if (!c || t.Const) && (!v || t.Volatile) {
+		return t
+	}
+	q := *t
+	q.Const = t.Const || c
+	q.Volatile = t.Volatile || v
+	return &q
+}
+
+// Unqualified returns t without qualifiers.
+func (t *CType) Unqualified() *CType {
+	if !t.Const && !t.Volatile {
+		return t
+	}
+	q := *t
+	q.Const, q.Volatile = false, false
+	return &q
+}
+
+// Bytes returns the size of t. Like GCC, void and functions have size 1
+// so that pointer arithmetic on them works.
+func (t *CType) Bytes() int {
+	switch t.Kind {
+	case C_bool, C_char, C_void, C_func:
+		return 1
+	case C_short:
+		return 2
+	case C_int, C_float, C_enum:
+		return 4
+	case C_long, C_double, C_ptr:
+		return 8
+	case C_ldouble:
+		return 16
+	case C_array:
+		if t.Len < 0 {
+			return 0
+		}
+		return t.Base.Bytes() * t.Len
+	case C_struct:
+		return t.Struct.Size
+	}
+	panic("unknown type kind")
+}
+
+// Align returns the alignment of t in bytes.
+func (t *CType) Align() int {
+	switch t.Kind {
+	case C_array:
+		return t.Base.Align()
+	case C_struct:
+		return t.Struct.Align
+	}
+	return t.Bytes()
+}
+
+// Elem returns the type pointed to by a pointer or the element type of an array.
+func (t *CType) Elem() *CType {
+	return t.Base
+}
+
+// Decay converts an array to a pointer to its first element and a
+// function to a pointer to it, as their values are used in expressions.
+func (t *CType) Decay() *CType {
+	switch t.Kind {
+	case C_array:
+		return PointerTo(t.Base)
+	case C_func:
+		return PointerTo(t)
+	}
+	return t
+}
+
+func (t *CType) IsVoid() bool   { return t.Kind == C_void }
+func (t *CType) IsPtr() bool    { return t.Kind == C_ptr }
+func (t *CType) IsArray() bool  { return t.Kind == C_array }
+func (t *CType) IsFunc() bool   { return t.Kind == C_func }
+func (t *CType) IsStruct() bool { return t.Kind == C_struct }
+
+func (t *CType) IsInteger() bool {
+	switch t.Kind {
+	case C_bool, C_char, C_short, C_int, C_long, C_enum:
+		return true
+	}
+	return false
+}
+
+func (t *CType) IsFloat() bool {
+	return t.Kind == C_float || t.Kind == C_double
+}
+
+func (t *CType) IsArith() bool {
+	return t.IsInteger() || t.IsFloat()
+}
+
+func (t *CType) IsScalar() bool {
+	return t.IsArith() || t.IsPtr()
+}
+
+// IsComplete reports whether the size of t is known.
+func (t *CType) IsComplete() bool {
+	switch t.Kind {
+	case C_void:
+		return false
+	case C_array:
+		return t.Len >= 0 && t.Base.IsComplete()
+	case C_struct:
+		return t.Struct.Complete
+	case C_enum:
+		return t.Enum.Complete
+	}
+	return true
+}
+
+// Compatible reports whether a and b are compatible types, i.e. the
+// same type for the purposes of assignments and redeclarations.
+func Compatible(a, b *CType) bool {
+	if a == b {
+		return true
+	}
+	if a.Kind != b.Kind || a.Unsigned != b.Unsigned || a.Const != b.Const || a.Volatile != b.Volatile {
+		return false
+	}
+	switch a.Kind {
+	case C_ptr:
+		return Compatible(a.Base, b.Base)
+	case C_array:
+		return Compatible(a.Base, b.Base) && (a.Len < 0 || b.Len < 0 || a.Len == b.Len)
+	case C_func:
+		if a.NoProto || b.NoProto {
+			// the parameters are not known, but cannot be variable
+			return Compatible(a.Base, b.Base) && !a.Variadic && !b.Variadic
+		}
+		if !Compatible(a.Base, b.Base) || a.Variadic != b.Variadic || len(a.Params) != len(b.Params) {
+			return false
+		}
+		for i := range a.Params {
+			if !Compatible(a.Params[i].Unqualified(), b.Params[i].Unqualified()) {
+				return false
+			}
+		}
+		return true
+	case C_struct:
+		return a.Struct == b.Struct
+	case C_enum:
+		return a.Enum == b.Enum
+	}
+	return true
+}
+
+func (t *CType) rank() int {
+	switch t.Kind {
+	case C_bool:
+		return 0
+	case C_char:
+		return 1
+	case C_short:
+		return 2
+	case C_long:
+		return 4
+	}
+	return 3
+}
+
+// Promote applies the integer promotions: integers of lower rank than
+// int, and enums, are converted to int.
+func Promote(t *CType) *CType {
+	if t.IsInteger() && t.rank() <= IntType.rank() && !(t.Kind == C_int && t.Unsigned) {
+		return IntType
+	}
+	return t.Unqualified()
+}
+
+// UsualArith returns the common type of the operands of a binary
+// operator after the usual arithmetic conversions.
+func UsualArith(a, b *CType) *CType {
+	switch {
+	case a.Kind == C_double || b.Kind == C_double:
+		return DoubleType
+	case a.Kind == C_float || b.Kind == C_float:
+		return FloatType
+	}
+	a, b = Promote(a), Promote(b)
+	if a.Unsigned == b.Unsigned {
+		if a.rank() >= b.rank() {
+			return a
+		}
+		return b
+	}
+	u, s := a, b
+	if s.Unsigned {
+		u, s = s, u
+	}
+	switch {
+	case u.rank() >= s.rank():
+		return u
+	case s.Bytes() > u.Bytes():
+		return s
+	}
+	c := *s
+	c.Unsigned = true
+	return &c
+}
+
+func (k TypeKind) String() string {
+	switch k {
+	case C_void:
+		return "void"
+	case C_bool:
+		return "_Bool"
+	case C_char:
+		return "char"
+	case C_short:
+		return "short"
+	case C_int:
+		return "int"
+	case C_long:
+		return "long"
+	case C_float:
+		return "float"
+	case C_double:
+		return "double"
+	case C_ldouble:
+		return "long double"
+	case C_enum:
+		return "enum"
+	case C_ptr:
+		return "pointer"
+	case C_array:
+		return "array"
+	case C_func:
+		return "function"
+	case C_struct:
+		return "struct"
+	default:
+		panic("undefined Type")
+	}
+}
+
+// String spells t the way it is written in a cast, e.g. "char *[4]"
+// or "int (*)(int)".
+func (t *CType) String() string {
+	return t.declarator("")
+}
+
+func (t *CType) qualifiers() string {
+	var q []string
+	if t.Const {
+		q = append(q, "const")
+	}
+	if t.Volatile {
+		q = append(q, "volatile")
+	}
+	return strings.Join(q, " ")
+}
+
+// declarator returns t declaring inner, which is the part of the
+// declarator already spelled.
+func (t *CType) declarator(inner string) string {
+	// array and function declarators bind tighter than pointers
+	wrap := func() string {
+		if strings.HasPrefix(inner, "*") {
+			return "(" + inner + ")"
+		}
+		return inner
+	}
+	switch t.Kind {
+	case C_ptr:
+		s := "*"
+		if q := t.qualifiers(); q != "" {
+			s += q
+			if inner != "" {
+				s += " "
+			}
+		}
+		return t.Base.declarator(s + inner)
+	case C_array:
+		if t.Len < 0 {
+			return t.Base.declarator(wrap() + "[]")
+		}
+		return t.Base.declarator(fmt.Sprintf("%s[%d]", wrap(), t.Len))
+	case C_func:
+		var params []string
+		for _, p := range t.Params {
+			params = append(params, p.String())
+		}
+		if t.Variadic {
+			params = append(params, "...")
+		}
+		if len(params) == 0 && !t.NoProto {
+			params = append(params, "void")
+		}
+		return t.Base.declarator(wrap() + "(" + strings.Join(params, ", ") + ")")
+	}
+
+	s := t.specifier()
+	if q := t.qualifiers(); q != "" {
+		s = q + " " + s
+	}
+	if inner == "" {
+		return s
+	}
+	return s + " " + inner
+}
+
+func (t *CType) specifier() string {
+	switch t.Kind {
+	case C_struct:
+		if t.Struct.Tag == nil {
+			return t.Struct.Keyword() + " (anonymous)"
+		}
+		return t.Struct.Keyword() + " " + t.Struct.Tag.String()
+	case C_enum:
+		if t.Enum.Tag == nil {
+			return "enum (anonymous)"
+		}
+		return "enum " + t.Enum.Tag.String()
+	}
+	if t.Unsigned {
+		return "unsigned " + t.Kind.String()
+	}
+	return t.Kind.String()
+}
+
+// StructType is a struct or union. Its fields are laid out following
+// the System V ABI: each field is aligned to its own alignment and the
+// size is rounded up to the largest of them.
+type StructType struct {
+	Tag      *token.Token // nil for anonymous types
+	Union    bool
+	Fields   []*Field
+	Size     int
+	Align    int
+	Complete bool // false until the member list was read
+}
+
+type Field struct {
+	Name   *token.Token
+	Type   *CType
+	Offset int
+}
+
+func (s *StructType) Keyword() string {
+	if s.Union {
+		return "union"
+	}
+	return "struct"
+}
+
+// Field returns the field named name or nil.
+func (s *StructType) Field(name string) *Field {
+	for _, f := range s.Fields {
+		if f.Name.String() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Layout computes the offsets of the fields, the size and the alignment.
+func (s *StructType) Layout() {
+	s.Size, s.Align = 0, 1
+	for _, f := range s.Fields {
+		size, align := f.Type.Bytes(), f.Type.Align()
+		if align > s.Align {
+			s.Align = align
+		}
+		if s.Union {
+			f.Offset = 0
+			if size > s.Size {
+				s.Size = size
+			}
+			continue
+		}
+		f.Offset = alignTo(s.Size, align)
+		s.Size = f.Offset + size
+	}
+	s.Size = alignTo(s.Size, s.Align)
+	s.Complete = true
+}
+
+func alignTo(n, align int) int {
+	return (n + align - 1) / align * align
+}
+
+// EnumType is an enumeration. Its values have type int.
+type EnumType struct {
+	Tag      *token.Token // nil for anonymous types
+	Complete bool         // false until the enumerator list was read
+	Consts   []*Enumerator
+}
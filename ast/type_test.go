@@ -0,0 +1,81 @@
+package ast
+
+import "testing"
+
+func TestTypeString(t *testing.T) {
+	argv := PointerTo(CharType)
+	tests := []struct {
+		ty     *CType
+		expect string
+	}{
+		{PointerTo(PointerTo(IntType)), "int **"},
+		{ArrayOf(argv, 4), "char *[4]"},
+		{PointerTo(ArrayOf(IntType, 3)), "int (*)[3]"},
+		{PointerTo(FuncOf(IntType, []*CType{IntType, argv}, true)), "int (*)(int, char *, ...)"},
+		{FuncOf(VoidType, nil, false), "void (void)"},
+		{ArrayOf(UIntType, -1), "unsigned int []"},
+		{FuncOf(LongDoubleType, []*CType{LongDoubleType}, false), "long double (long double)"},
+	}
+	for _, test := range tests {
+		if s := test.ty.String(); s != test.expect {
+			t.Errorf("expected type is %s, but got %s", test.expect, s)
+		}
+	}
+}
+
+func TestUsualArith(t *testing.T) {
+	short := ShortType.Qualified(true, false)
+	tests := []struct {
+		x, y, expect *CType
+	}{
+		{CharType, short, IntType},
+		{IntType, UIntType, UIntType},
+		{UIntType, LongType, LongType},
+		{ULongType, LongType, ULongType},
+		{LongType, FloatType, FloatType},
+		{FloatType, DoubleType, DoubleType},
+		{EnumOf(&EnumType{}), UCharType, IntType},
+	}
+	for _, test := range tests {
+		if got := UsualArith(test.x, test.y); !Compatible(got, test.expect) {
+			t.Errorf("%s and %s: expected type is %s, but got %s", test.x, test.y, test.expect, got)
+		}
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	s := &StructType{}
+	tests := []struct {
+		x, y   *CType
+		expect bool
+	}{
+		{PointerTo(IntType), PointerTo(IntType), true},
+		{PointerTo(IntType), PointerTo(UIntType), false},
+		{PointerTo(IntType), PointerTo(IntType.Qualified(true, false)), false},
+		{ArrayOf(IntType, 3), ArrayOf(IntType, -1), true},
+		{ArrayOf(IntType, 3), ArrayOf(IntType, 4), false},
+		{FuncOf(IntType, []*CType{CharType}, false), FuncOf(IntType, []*CType{CharType.Qualified(true, false)}, false), true},
+		{FuncOf(IntType, nil, false), FuncOf(IntType, nil, true), false},
+		{StructOf(s), StructOf(s), true},
+		{StructOf(s), StructOf(&StructType{}), false},
+	}
+	for _, test := range tests {
+		if got := Compatible(test.x, test.y); got != test.expect {
+			t.Errorf("%s and %s: expected compatible is %v, but got %v", test.x, test.y, test.expect, got)
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	s := &StructType{Fields: []*Field{{Type: CharType}, {Type: ArrayOf(PointerTo(IntType), 2)}, {Type: ShortType}}}
+	s.Layout()
+	if s.Size != 32 || s.Align != 8 || s.Fields[2].Offset != 24 {
+		t.Errorf("unexpected layout size %d, align %d, offset %d", s.Size, s.Align, s.Fields[2].Offset)
+	}
+	if n := ArrayOf(ArrayOf(IntType, 3), 2).Bytes(); n != 24 {
+		t.Errorf("expected size is 24, but got %d", n)
+	}
+	if n, a := LongDoubleType.Bytes(), LongDoubleType.Align(); n != 16 || a != 16 {
+		t.Errorf("expected long double size and alignment 16, but got %d and %d", n, a)
+	}
+}
@@ -0,0 +1,28 @@
+int printf(char *fmt, ...);
+long labs(long n);
+
+long mix(char a, short b, int c, long d, char e, short f, int g, long h) {
+  return a + b + c + d + e + f + g + h;
+}
+
+char narrow(int x) {
+  return x;
+}
+
+long widen(long x) {
+  return x;
+}
+
+int sum9(int a, int b, int c, int d, int e, int f, int g, int h, int i) {
+  return a - b + c - d + e - f + g - h + i;
+}
+
+int main() {
+  long n = 0;
+  n = n + mix(-1, -2, -3, -4, 200, 40000, 7, 8);
+  n = n + labs(-5) + widen(-6) + 6;
+  n = n + (narrow(300) == 44) + (narrow(255) == -1);
+  n = n + 1 + sum9(1, 2, 3, 4, 5, 6, 7, 8, sum9(9, 8, 7, 6, 5, 4, 3, 2, 1));
+  n = n + (1 + printf("%d %ld %d\n", narrow(-129), widen(-1), 3));
+  return n;
+}
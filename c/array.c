@@ -1,6 +1,17 @@
+int dirty() {
+  int x[8] = {9, 9, 9, 9, 9, 9, 9, 9};
+  return x[7];
+}
+
+int partial() {
+  int c[8] = {1, 2};
+  return c[2] + c[7];
+}
+
 int main() {
   int a[4] = {0, 1, 2, 3};
   a[2] = 5;
   int b[] = {10, 11, 12, 13};
-  return a[2] + b[1];
+  dirty();
+  return a[2] + b[1] + partial();
 }
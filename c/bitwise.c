@@ -0,0 +1,24 @@
+int main() {
+  int a = 12;
+  int b = 10;
+  int r = 0;
+  if ((a & b) == 8) {
+    r = r + 1;
+  }
+  if ((a | b) == 14) {
+    r = r + 2;
+  }
+  if ((a ^ b) == 6) {
+    r = r + 4;
+  }
+  if ((1 << 4) == 16 && (a >> 2) == 3) {
+    r = r + 8;
+  }
+  if ((0 - 16 >> 2) == 0 - 4) {
+    r = r + 16;
+  }
+  if ((~a & 15) == 3) {
+    r = r + 32;
+  }
+  return r;
+}
@@ -0,0 +1,51 @@
+#include <stdbool.h>
+
+int printf(char *fmt, ...);
+
+bool yes = 42;
+_Bool no = 0.0;
+bool flags[3] = {0, 7, 0};
+
+int check(long got, long want, int line) {
+  if (got != want) {
+    printf("line %d: got %ld want %ld\n", line, got, want);
+    return 0;
+  }
+  return 1;
+}
+
+bool positive(int x) {
+  return x > 0;
+}
+
+int main() {
+  int ok = 0;
+  int x = 5;
+  bool b = &x;
+  bool c;
+  double d = 0.5;
+  ok += check(yes, 1, __LINE__);
+  ok += check(no, 0, __LINE__);
+  ok += check(flags[1], 1, __LINE__);
+  ok += check(b, 1, __LINE__);
+  ok += check(sizeof(bool), 1, __LINE__);
+  c = 256;
+  ok += check(c, 1, __LINE__);
+  c = d;
+  ok += check(c, 1, __LINE__);
+  c = (bool)0;
+  ok += check(c, 0, __LINE__);
+  c++;
+  c++;
+  ok += check(c, 1, __LINE__);
+  c--;
+  ok += check(c, 0, __LINE__);
+  c--;
+  ok += check(c, 1, __LINE__);
+  c += 2;
+  ok += check(c, 1, __LINE__);
+  ok += check(positive(-3), false, __LINE__);
+  ok += check(positive(3) + true, 2, __LINE__);
+  ok += check(b == true, 1, __LINE__);
+  return ok;
+}
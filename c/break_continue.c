@@ -0,0 +1,26 @@
+int main() {
+  int a = 0;
+  for (int i = 0; i < 10; i++) {
+    if (i == 3) {
+      continue;
+    }
+    int j = 0;
+    while (j < 10) {
+      j++;
+      if (j > i) {
+        break;
+      }
+      a++;
+    }
+    if (i == 7) {
+      break;
+    }
+  }
+  for (;;) {
+    a = a + 2;
+    if (a > 30) {
+      break;
+    }
+  }
+  return a;
+}
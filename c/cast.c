@@ -0,0 +1,67 @@
+int printf(char *fmt, ...);
+
+struct pair {
+  char c;
+  long l;
+};
+
+typedef int row[5];
+
+char buf[sizeof(struct pair)];
+
+int check(long got, long want) {
+  if (got != want) {
+    printf("got %ld, want %ld\n", got, want);
+    return 1;
+  }
+  return 0;
+}
+
+int main() {
+  int bad = 0;
+  int x = 300, n = -1;
+  long big = 0x123456789;
+  double d = -3.75;
+  float f = 1e10f;
+  row r;
+  int *p = &x;
+  long addr = (long)p;
+
+  bad += check(sizeof(int), 4);
+  bad += check(sizeof x, 4);
+  bad += check(sizeof(struct pair), 16);
+  bad += check(sizeof r, 20);
+  bad += check(sizeof r / sizeof r[0], 5);
+  bad += check(sizeof(row *), 8);
+  bad += check(sizeof "abc", 4);
+  bad += check(sizeof(char) + sizeof(short), 3);
+  bad += check(sizeof x++, 4);
+  bad += check(x, 300);
+  bad += check(sizeof buf, 16);
+  bad += check(_Alignof(struct pair), 8);
+  bad += check(_Alignof(short), 2);
+  bad += check(sizeof(int (*)[3]), 8);
+
+  bad += check((char)x, 44);
+  bad += check((unsigned char)n, 255);
+  bad += check((unsigned short)n, 65535);
+  bad += check((short)70000, 4464);
+  bad += check((int)big, 0x23456789);
+  bad += check((unsigned)n, 4294967295);
+  bad += check((long)n, -1);
+  bad += check((long)(unsigned)n, 4294967295);
+  bad += check((signed char)200 + 0, -56);
+  bad += check((int)d, -3);
+  bad += check((unsigned char)d, 253);
+  bad += check((long)f, 10000000000);
+  bad += check((int)(double)7 / 2, 3);
+  bad += check((double)7 / 2 * 2, 7);
+  bad += check((float)1 / 3 == (double)1 / 3, 0);
+  bad += check((unsigned long)1e19 / 1000, 10000000000000000);
+  bad += check((long)(double)(unsigned long)-1 == 0, 0);
+  bad += check(*(int *)addr, 300);
+  bad += check((long)(char *)8, 8);
+  bad += check((int *)16 - (int *)0, 4);
+  (void)x;
+  return bad;
+}
@@ -0,0 +1,28 @@
+int main() {
+  int a = 10;
+  a += 5;
+  a -= 3;
+  a *= 4;
+  a /= 6;
+  a %= 5;
+  int b = 3;
+  b <<= 4;
+  b >>= 1;
+  b |= 1;
+  b &= 13;
+  b ^= 6;
+  char c = 100;
+  c += 100;
+  char d = 7;
+  d *= -3;
+  int arr[4] = {1, 2, 3, 4};
+  int *p = arr;
+  p += 3;
+  p -= 1;
+  arr[1] += 20;
+  int r = (a += 1) + b;
+  if (c == -56 && d == -21) {
+    r = r + 100;
+  }
+  return r + *p + arr[1];
+}
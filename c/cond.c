@@ -0,0 +1,37 @@
+int touch(int *p) {
+  *p = *p + 1;
+  return 1;
+}
+
+int zero() {
+  return 0;
+}
+
+int main() {
+  int a = 0;
+  int n = 5;
+  int t = 0;
+  int *p = 0;
+  int *q = &n;
+
+  while (n--) {
+    a++;
+  }
+  if (!p) {
+    a = a + 10;
+  }
+  if (q) {
+    a = a + 10;
+  }
+  if (zero() || touch(&t)) {
+    a++;
+  }
+  if (zero() && touch(&t)) {
+    a = 0;
+  }
+  if (a && 0 || t) {
+    a++;
+  }
+  int b = (a > 20) + !a + (t == 1 && a);
+  return a * 2 + b + (n < 0 ? 10 : 20);
+}
@@ -0,0 +1,106 @@
+int printf(char *fmt, ...);
+
+enum {
+  SHIFT = 1 << 4,
+  MASK = SHIFT - 1,
+  NEG = -MASK / 2,
+  BIG = (int)(3000000000u / 2),
+  COND = MASK > 10 ? 'y' : 'n',
+  NOT = !MASK + ~0,
+  LAST = (SHIFT | MASK) ^ 3
+};
+
+struct rec {
+  char name[2 * 4 + 1];
+  int vals[MASK & 3];
+};
+
+int table[SHIFT + 2][3 * 2 - 1];
+char bytes[sizeof(struct rec) % 7 + 1];
+int neg = -2147483647 - 1;
+unsigned wrap = 0u - 1;
+long shifted = 1L << 40;
+unsigned long ulong = (unsigned long)-1 >> 60;
+int folded = (10 > 3) + (2.5 < 1) + (1 && 0) + (0 || 7);
+double ratio = 1.0 / 4 + 3;
+float third = 1.0f / 3;
+int trunc = (int)-7.9;
+char narrow = (char)300;
+int *null = (void *)0;
+int *zero = 1 - 1;
+int *const pneg = &neg;
+const char *const words[] = {"ab", "cd"};
+const int primes[] = {2, 3, 5};
+
+int check(long got, long want) {
+  if (got != want) {
+    printf("got %ld, want %ld\n", got, want);
+    return 1;
+  }
+  return 0;
+}
+
+int classify(int n) {
+  switch (n) {
+  case 1 << 2:
+    return 1;
+  case MASK * 2 + 1:
+    return 2;
+  case -SHIFT:
+    return 3;
+  case sizeof(long) > 4 ? 100 : 200:
+    return 4;
+  }
+  return 0;
+}
+
+int main() {
+  int bad = 0;
+  int x = 7;
+  unsigned u = 5;
+
+  bad += check(SHIFT, 16);
+  bad += check(MASK, 15);
+  bad += check(NEG, -7);
+  bad += check(BIG, 1500000000);
+  bad += check(COND, 'y');
+  bad += check(NOT, -1);
+  bad += check(LAST, 28);
+  bad += check(sizeof(struct rec), 24);
+  bad += check(sizeof table, 18 * 5 * 4);
+  bad += check(sizeof bytes, 4);
+  bad += check(neg, -2147483647 - 1);
+  bad += check(wrap, 4294967295);
+  bad += check(shifted, 1099511627776);
+  bad += check(ulong, 15);
+  bad += check(folded, 2);
+  bad += check((long)(ratio * 100), 325);
+  bad += check(third == 1.0f / 3, 1);
+  bad += check(trunc, -7);
+  bad += check(narrow, 44);
+  bad += check(null == 0, 1);
+  bad += check(zero == 0, 1);
+  bad += check(*pneg, -2147483647 - 1);
+  bad += check(words[1][0] + primes[2], 'c' + 5);
+  bad += check(classify(4) + classify(31) + classify(-16) + classify(100), 10);
+
+  bad += check(x * (3 + 4) - (1 << 3), 41);
+  bad += check(-1 < 0u, 0);
+  bad += check(-1L < 0u, 1);
+  bad += check((unsigned char)-1 + 1, 256);
+  bad += check(u / (6 - 4), 2);
+  bad += check(0x7fffffff + 0u + 1, 2147483648);
+  bad += check(-5 % 3 + -5 / 3, -3);
+  bad += check(-16 >> 2, -4);
+  bad += check(5 % 0 + (1 << -1) + (1u << 40), 0);
+  bad += check(4000000000u >> 30, 3);
+  bad += check((long)(1.5f * 3), 4);
+  bad += check((x > 3 && 2 > 1) + (0 ? x : 9), 10);
+  if (1 > 2) {
+    bad++;
+  }
+  while (0) {
+    bad++;
+  }
+  return bad;
+}
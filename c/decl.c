@@ -0,0 +1,52 @@
+typedef int myint;
+typedef struct point { myint x, y; } point;
+typedef point *pointp;
+typedef enum { OFF, ON } state;
+typedef int vec3[3];
+typedef int binop(int, int);
+
+int add(int a, int b) { return a + b; }
+binop mul;
+int scale();
+int mul(int a, int b) { return a * b; }
+
+static int count = 2, *none = 0, table[3] = {1, 2, 3};
+int (*rows)[3];
+int *(strs)[2];
+
+int sum(const vec3 v) {
+  int s = 0;
+  for (int i = 0, n = 3; i < n; i++) {
+    s += v[i];
+  }
+  return s;
+}
+
+int length(pointp p) {
+  return p->x + p->y;
+}
+
+int main() {
+  point pt = {3, 4};
+  pointp pp = &pt;
+  vec3 v = {1, 2, 3};
+  int grid[2][3], (*row)[3] = grid;
+  state s = ON;
+  register int r = 0;
+  myint myint = 5;
+  if (none != 0) {
+    return 1;
+  }
+  {
+    typedef char myint;
+    myint c = 300;
+    r += c;
+  }
+  rows = grid;
+  row[1][2] = 7;
+  r += rows[1][2] + sum(v) + length(pp) + s + myint + count + table[2];
+  r += scale(2, 3) - 6;
+  return r + add(1, mul(2, 3));
+}
+
+int scale(int a, int b) { return a * b; }
@@ -0,0 +1,11 @@
+int main() {
+  int a = 0;
+  do {
+    a++;
+  } while (a > 100);
+  do {
+    a = a * 2;
+  } while (a < 20);
+  do a--; while (a > 30);
+  return a;
+}
@@ -0,0 +1,40 @@
+enum color { RED, GREEN = 5, BLUE };
+enum { ONE = 1, TWO, FOUR = 4 };
+
+int table[BLUE];
+
+struct pixel {
+  enum color c;
+  int x;
+};
+
+int name(enum color c) {
+  switch (c) {
+  case RED:
+    return 1;
+  case GREEN:
+    return 2;
+  case BLUE:
+    return 3;
+  }
+  return 0;
+}
+
+int main() {
+  enum color c = BLUE;
+  struct pixel p;
+  int n = 0;
+  p.c = GREEN;
+  p.x = 1;
+  {
+    enum { RED = 10 };
+    n += RED;
+  }
+  n += RED;
+  n += name(c) + name(p.c);
+  table[BLUE - 1] = 4;
+  n += table[5];
+  enum local { A = -1, B, C } l = C;
+  n += l + B;
+  return n;
+}
@@ -0,0 +1,122 @@
+int printf(char *fmt, ...);
+
+double g = 2.5;
+float gf = -1.25f;
+double gi = 3;
+double ga[3] = {1, -0.5, 1e2};
+
+struct point {
+  double x, y;
+};
+
+struct mixed {
+  float f;
+  int i;
+};
+
+struct triple {
+  float a, b, c;
+};
+
+int check(int ok, int line) {
+  if (!ok) {
+    printf("line %d failed\n", line);
+  }
+  return ok;
+}
+
+double half(double x) {
+  return x / 2;
+}
+
+float twice(float x) {
+  return x * 2;
+}
+
+double sum10(double a, double b, double c, double d, double e, double f, double g, double h, double i, double j) {
+  return a + b + c + d + e + f + g + h + i - j;
+}
+
+double mix(int a, double b, long c, float d, char e) {
+  return a * b + c * d + e;
+}
+
+struct point scale(struct point p, double k) {
+  p.x = p.x * k;
+  p.y = p.y * k;
+  return p;
+}
+
+struct mixed bump(struct mixed m) {
+  m.f = m.f + 0.5f;
+  m.i = m.i + 1;
+  return m;
+}
+
+struct triple rot(struct triple t) {
+  struct triple r;
+  r.a = t.b;
+  r.b = t.c;
+  r.c = t.a;
+  return r;
+}
+
+int main() {
+  int ok = 0;
+  double d = 1.5;
+  float f = .25;
+  double zero = 0;
+  double nan = zero / zero;
+  unsigned long big = 0;
+  int i;
+  struct point p;
+  struct mixed m;
+  struct triple t;
+
+  ok += check(d + f == 1.75, __LINE__);
+  ok += check(d * 2 - 1 == 2, __LINE__);
+  ok += check(1e3 == 1000 && 1E-2 < 0.011 && 2.5e+1 == 25, __LINE__);
+  ok += check(g + gf == 1.25 && gi == 3, __LINE__);
+  ok += check(ga[0] + ga[1] + ga[2] == 100.5, __LINE__);
+  ok += check(-d == -1.5 && !zero && !!d, __LINE__);
+  ok += check(d > f && f < d && d >= 1.5 && f <= 0.25 && d != f, __LINE__);
+  ok += check(!(nan == nan) && nan != nan && !(nan < 1) && !(nan >= 1), __LINE__);
+  ok += check(nan ? 1 : 0, __LINE__);
+  i = 7.9;
+  ok += check(i == 7, __LINE__);
+  i = -7.9;
+  ok += check(i == -7, __LINE__);
+  d = 7 / 2;
+  ok += check(d == 3, __LINE__);
+  d = 7 / 2.0;
+  ok += check(d == 3.5, __LINE__);
+  big = big - 1;
+  d = big;
+  ok += check(d == 18446744073709551615.0, __LINE__);
+  d = 1.5;
+  d += 2;
+  d *= f;
+  ok += check(d == 0.875, __LINE__);
+  i = 10;
+  i *= 0.35;
+  ok += check(i == 3, __LINE__);
+  ok += check(d++ == 0.875 && d == 1.875 && --d == 0.875, __LINE__);
+  ok += check(half(5) == 2.5 && twice(1.5f) == 3, __LINE__);
+  ok += check(sum10(1, 2, 3, 4, 5, 6, 7, 8, 9, 10) == 35, __LINE__);
+  ok += check(mix(2, 1.25, 3, 0.5f, 'a') == 101, __LINE__);
+  p.x = 1.5;
+  p.y = -2;
+  p = scale(p, 2);
+  ok += check(p.x == 3 && p.y == -4, __LINE__);
+  m.f = 1;
+  m.i = 41;
+  m = bump(m);
+  ok += check(m.f == 1.5 && m.i == 42, __LINE__);
+  t.a = 1;
+  t.b = 2;
+  t.c = 3;
+  t = rot(t);
+  ok += check(t.a == 2 && t.b == 3 && t.c == 1, __LINE__);
+  ok += check(printf("%f %.2f %g %d\n", 1.5, f, 1e10, 3) == 22, __LINE__);
+  return ok;
+}
@@ -0,0 +1,63 @@
+#include <stdio.h>
+#include <stdlib.h>
+
+struct op {
+  char *name;
+  int (*fn)(int, int);
+};
+
+int add(int a, int b) {
+  return a + b;
+}
+
+int sub(int a, int b) {
+  return a - b;
+}
+
+static int mul(int a, int b) {
+  return a * b;
+}
+
+double scale(double x, int n) {
+  return x * n;
+}
+
+int (*pick(int i))(int, int) {
+  if (i) {
+    return sub;
+  }
+  return &add;
+}
+
+int apply(int (*f)(int, int), int a, int b) {
+  return f(a, b);
+}
+
+int cmp(const void *a, const void *b) {
+  return *(int *)a - *(int *)b;
+}
+
+int (*global)(int, int) = mul;
+int (*table[3])(int, int) = {add, &sub, mul};
+struct op op = {"mul", mul};
+
+int main() {
+  int (*fp)(int, int) = add;
+  double (*fs)(double, int) = scale;
+  int r = fp(3, 4);
+  r = r + (*fp)(1, 2);
+  fp = sub;
+  r = r + fp(10, 4);
+  r = r + apply(mul, 2, 5);
+  r = r + pick(1)(9, 3) + pick(0)(1, 1);
+  r = r + global(2, 3);
+  for (int i = 0; i < 3; i++) {
+    r = r + table[i](6, 2);
+  }
+  r = r + op.fn(2, 2) + (int)fs(1.5, 4);
+  r = r + (fp == sub) + (global != 0);
+  int a[5] = {5, 3, 9, 1, 7};
+  qsort(a, 5, sizeof(int), cmp);
+  r = r + a[0] * 10 + a[4];
+  return r;
+}
@@ -0,0 +1,39 @@
+int g = 3;
+int z;
+char c = 'a';
+int arr[4] = {1, 2};
+int *p = &g;
+int *q = &arr[2];
+int *r = arr + 1;
+struct point { char tag; int x; int y; };
+struct point pt = {'p', 5, 7};
+int *py = &pt.y;
+const int k = 10;
+int t;
+int t = 4;
+int t;
+int u;
+int u;
+int w[3];
+int w[3];
+
+int counter() {
+  static int n;
+  n = n + 1;
+  return n;
+}
+
+int seed() {
+  static int n = 100;
+  n = n - 1;
+  return n;
+}
+
+int main() {
+  *q = 4;
+  *r = *r + 1;
+  z = g + k;
+  counter();
+  counter();
+  return z + c - 'a' + arr[1] + arr[2] + arr[3] + *p + *py + pt.tag - 'p' + counter() + seed() - 99 + t + u + w[1];
+}
@@ -0,0 +1,20 @@
+int main() {
+  int a = 0;
+  int i = 0;
+  goto start;
+again:
+  a = a + 10;
+start:
+  i++;
+  if (i < 4) {
+    goto again;
+  }
+  for (int j = 0; j < 100; j++) {
+    while (j > 5) {
+      goto out;
+    }
+    a++;
+  }
+out:
+  return a;
+}
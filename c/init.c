@@ -0,0 +1,54 @@
+int printf(char *fmt, ...);
+
+struct In {
+  int a, b;
+};
+
+struct Out {
+  char name[4];
+  struct In in;
+  int v[3];
+};
+
+int gm[2][3] = {{1, 2}, {3, 4, 5}};
+int ge[2][2] = {1, 2, 3,};
+struct In gs[] = {{5, 6}, 7};
+struct Out go[2] = {{"ab", {1, 2}, {3}}, "cd", 4, 5, 6, 7};
+char names[][4] = {"x", "yz"};
+
+int check(long got, long want, int line) {
+  if (got != want) {
+    printf("line %d: got %ld want %ld\n", line, got, want);
+    return 0;
+  }
+  return 1;
+}
+
+int main() {
+  int ok = 0;
+  int m[2][2] = {{1, 2}, {3, 4}};
+  int e[2][2] = {1, 2, 3};
+  int u[][2] = {1, 2, 3};
+  struct In s = {8, 9};
+  struct In arr[3] = {{1, 2}, s, 3};
+  struct Out o = {"hi", 1, 2, {3, 4}};
+  char cs[2][3] = {"ab", "c"};
+  ok += check(m[1][0], 3, __LINE__);
+  ok += check(e[1][0] + e[1][1], 3, __LINE__);
+  ok += check(sizeof u, 16, __LINE__);
+  ok += check(u[1][1], 0, __LINE__);
+  ok += check(arr[0].b + arr[1].a, 10, __LINE__);
+  ok += check(arr[2].a + arr[2].b, 3, __LINE__);
+  ok += check(o.name[1], 'i', __LINE__);
+  ok += check(o.in.b + o.v[1] + o.v[2], 6, __LINE__);
+  ok += check(cs[1][0] + cs[1][1], 'c', __LINE__);
+  ok += check(gm[0][2] + gm[1][2], 5, __LINE__);
+  ok += check(ge[1][0] + ge[1][1], 3, __LINE__);
+  ok += check(sizeof gs, 16, __LINE__);
+  ok += check(gs[1].a + gs[1].b, 7, __LINE__);
+  ok += check(go[0].in.b + go[0].v[0], 5, __LINE__);
+  ok += check(go[1].name[1] + go[1].in.a, 'd' + 4, __LINE__);
+  ok += check(go[1].v[1], 7, __LINE__);
+  ok += check(names[1][1], 'z', __LINE__);
+  return ok;
+}
@@ -0,0 +1,36 @@
+int printf(char *fmt, ...);
+
+long big = 0x123456789;
+unsigned long max = 0xffffffffffffffff;
+
+int check(int ok, int line) {
+  if (!ok) {
+    printf("line %d failed\n", line);
+  }
+  return ok;
+}
+
+int main() {
+  int ok = 0;
+  long l;
+  ok += check(0xFF == 255 && 0XaBc == 2748 && 0x0 == 0, __LINE__);
+  ok += check(0755 == 493 && 0 == 00 && 010 == 8, __LINE__);
+  ok += check(0b101 == 5 && 0B11111111 == 255, __LINE__);
+  ok += check(10UL == 10 && 7u + 1LL == 8 && 3lu * 2Ull == 6, __LINE__);
+  ok += check(!(-1 < 0u), __LINE__);
+  ok += check(-1 < 0x7fffffff, __LINE__);
+  ok += check(!(-1 < 0xffffffff), __LINE__);
+  ok += check(-1 < 4294967295, __LINE__);
+  ok += check(!(-1L < 0xffffffffffffffff), __LINE__);
+  ok += check(1L << 40 == 1099511627776, __LINE__);
+  ok += check(0x100000000 >> 32 == 1, __LINE__);
+  ok += check(4000000000 % 7 == 3, __LINE__);
+  ok += check(2147483648 > 0 && -2147483648 < 0, __LINE__);
+  ok += check(big >> 32 == 1 && (big & 0xffffffff) == 0x23456789, __LINE__);
+  ok += check(max == -1 && max >> 63 == 1, __LINE__);
+  l = 0x7fffffffffffffff;
+  ok += check(l >> 62 == 1, __LINE__);
+  l = 18446744073709551615u;
+  ok += check(l == -1, __LINE__);
+  return ok;
+}
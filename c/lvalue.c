@@ -0,0 +1,54 @@
+struct S {
+  int x;
+  int arr[3];
+};
+
+int *first(int *p) {
+  return p;
+}
+
+int main() {
+  int a[4] = {1, 2, 3, 4};
+  int *p = a;
+  int r = *(p + 1);
+
+  int m[2][3];
+  for (int i = 0; i < 2; i++) {
+    for (int j = 0; j < 3; j++) {
+      m[i][j] = i * 3 + j;
+    }
+  }
+  r += m[1][2];
+
+  int *q = &a[2];
+  r += *q;
+  *first(a) = 10;
+  r += a[0];
+
+  int **pp = &p;
+  (*pp)[3] = 7;
+  r += a[3];
+
+  struct S s;
+  s.arr[1] = 4;
+  int *px = &s.x;
+  *px = 5;
+  r += s.arr[1] + s.x;
+
+  int i = 1;
+  a[i]++;
+  ++a[i];
+  r += a[1];
+  p++;
+  r += *p--;
+  r += p[1] + 1[p];
+
+  char c[3];
+  c[2] = 5;
+  char *cp = c;
+  cp[2]++;
+  r += c[2];
+
+  int d = &a[3] - &a[0];
+  return r + d;
+}
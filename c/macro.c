@@ -0,0 +1,12 @@
+#define N 3
+#define ADD(a, b) ((a) + (b))
+#define CAT(a, b) a##b
+
+#if N > 2
+int CAT(ma, in)() {
+  int x = ADD(N, 4);
+  return ADD(x, __LINE__);
+}
+#else
+#error N is too small
+#endif
@@ -0,0 +1,14 @@
+int set(int **pp, int v) {
+  int *p = *pp;
+  *p = v;
+  return 0;
+}
+
+int main() {
+  int a = 3;
+  int *p = &a;
+  int **pp = &p;
+  const int k = 4;
+  set(pp, 7);
+  return a + k;
+}
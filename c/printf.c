@@ -0,0 +1,25 @@
+#include <stdio.h>
+int add(int, int);
+static int twice(int x);
+extern int total;
+extern int table[];
+
+int total = 5;
+int table[3] = {1, 2, 3};
+
+int main(void) {
+  char c = 'x';
+  int n = 0;
+  n = n + printf("hello, world\n");
+  n = n + printf("%d %s %c\n", add(total, table[2]), "gocc", c);
+  n = n + printf("%d-%d\n", twice(21), -7);
+  return n;
+}
+
+int add(int a, int b) {
+  return a + b;
+}
+
+static int twice(int x) {
+  return x * 2;
+}
@@ -0,0 +1,69 @@
+#include <stdarg.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <string.h>
+
+int sum(int n, ...) {
+  va_list ap;
+  va_start(ap, n);
+  int s = 0;
+  for (int i = 0; i < n; i++) {
+    s = s + va_arg(ap, int);
+  }
+  va_end(ap);
+  return s;
+}
+
+double mean(int n, ...) {
+  va_list ap;
+  va_start(ap, n);
+  double s = 0;
+  for (int i = 0; i < n; i++) {
+    s = s + va_arg(ap, double);
+  }
+  va_end(ap);
+  return s / n;
+}
+
+long mixed(char *fmt, ...) {
+  va_list ap, copy;
+  va_start(ap, fmt);
+  va_copy(copy, ap);
+  int64_t s = 0;
+  for (; *fmt; fmt++) {
+    if (*fmt == 'd') {
+      s = s + va_arg(ap, int);
+    } else if (*fmt == 'l') {
+      s = s + va_arg(ap, long);
+    } else if (*fmt == 'f') {
+      s = s + (long)va_arg(ap, double);
+    } else if (*fmt == 's') {
+      s = s + strlen(va_arg(ap, char *));
+    }
+  }
+  va_end(ap);
+  s = s * 2 - va_arg(copy, int);
+  va_end(copy);
+  return s;
+}
+
+int format(char *buf, char *fmt, ...) {
+  va_list ap;
+  va_start(ap, fmt);
+  int n = vsprintf(buf, fmt, ap);
+  va_end(ap);
+  return n;
+}
+
+int main() {
+  char buf[32];
+  int r = sum(3, 1, 2, 3);
+  r = r + sum(9, 1, 2, 3, 4, 5, 6, 7, 8, 9);
+  r = r + mean(10, 1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0, 9.0, 10.0) * 2;
+  r = r + mixed("dlfsdlfsd", 1, 2L, 3.5, "four", 5, 6L, 7.5, "eight", 9);
+  r = r + format(buf, "%d-%s", 42, "x");
+  if (strcmp(buf, "42-x") != 0) {
+    r = 0;
+  }
+  return r;
+}
@@ -0,0 +1,26 @@
+char *greeting = "hello";
+char name[] = "gocc";
+char pad[8] = "ab";
+char *same = "hello";
+
+int length(char *s) {
+  int n = 0;
+  while (s[n]) {
+    n++;
+  }
+  return n;
+}
+
+int main() {
+  char local[] = "a\tb\n";
+  char buf[6] = {"xy"};
+  char *s = "con" "cat" "\x41\101";
+  int sum = 0;
+  sum = sum + length(greeting) + length(name) + length(pad);
+  sum = sum + (greeting == same);
+  sum = sum + length(s) + s[6] + s[7];
+  sum = sum + local[1] + local[3] + length(local);
+  sum = sum + buf[1] + buf[5] + pad[7];
+  sum = sum + "xyz"[2] - '\\' + '\'' + '\0';
+  return sum;
+}
@@ -0,0 +1,35 @@
+struct point {
+  int x;
+  int y;
+};
+
+struct rect {
+  char tag;
+  struct point min;
+  struct point max;
+};
+
+union value {
+  int i;
+  char c;
+};
+
+int main() {
+  struct point p = {1};
+  struct rect r;
+  struct point m;
+  struct point *q;
+  union value v;
+  struct { char a; int b; } anon;
+
+  p.y = 2;
+  r.tag = 3;
+  r.min = p;
+  q = &m;
+  q->x = 10;
+  q->y = r.min.x + r.min.y;
+  r.max = *q;
+  v.i = 256 + 4;
+  anon.b = 5;
+  return r.tag + r.max.x + r.max.y + v.c + anon.b;
+}
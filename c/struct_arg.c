@@ -0,0 +1,51 @@
+struct small {
+  char a;
+  int b;
+  char c;
+};
+
+struct pair {
+  int x;
+  int y;
+  int z;
+};
+
+struct big {
+  int a;
+  int b;
+  int c;
+  int d;
+  int e;
+};
+
+int sum(struct small s, struct pair p) {
+  return s.a + s.b + s.c + p.x + p.y + p.z;
+}
+
+struct pair make(int x, int y, int z) {
+  struct pair p;
+  p.x = x;
+  p.y = y;
+  p.z = z;
+  return p;
+}
+
+struct big scale(struct big b, int k) {
+  b.a = b.a * k;
+  b.e = b.e * k;
+  return b;
+}
+
+int last(int a, int b, int c, int d, int e, struct pair p, int f) {
+  return p.z + f;
+}
+
+int main() {
+  struct small s = {1, 2, 3};
+  struct big b = {1, 2, 3, 4, 5};
+  struct pair p;
+
+  p = make(4, 5, 6);
+  b = scale(b, 2);
+  return sum(s, p) + b.a + b.e + make(7, 8, 9).y + last(0, 0, 0, 0, 0, p, 1);
+}
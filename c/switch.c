@@ -0,0 +1,95 @@
+int f(int x) {
+  int a = 0;
+  switch (x) {
+  case 1:
+    a = 10;
+    break;
+  default:
+    a = 1;
+  case 100:
+    a = a + 20;
+    break;
+  case -5:
+    return 3;
+  }
+  return a;
+}
+
+int g(int x, int y) {
+  switch (x) {
+  case 0:
+    switch (y) {
+    case 0:
+      return 1;
+    case 1:
+      break;
+    }
+    return 2;
+  case 1: {
+    int i = 0;
+    for (;;) {
+      i++;
+      if (i == 4) {
+        break;
+      }
+    }
+    return i;
+  }
+  }
+  return 0;
+}
+
+int h(long x) {
+  switch (x) {
+  case 1:
+    return 1;
+  case 4294967297L:
+    return 2;
+  case -1:
+    return 3;
+  }
+  return 0;
+}
+
+int dense(long x) {
+  switch (x) {
+  case 0:
+    return 1;
+  case 1:
+    return 2;
+  case 2:
+    return 3;
+  case 3:
+    return 4;
+  }
+  return 0;
+}
+
+int far(long x, unsigned long u) {
+  int a = 0;
+  switch (x) {
+  case -9223372036854775807L - 1:
+    a = 1;
+    break;
+  case 0:
+  case 1:
+  case 2:
+    a = 2;
+    break;
+  }
+  switch (u) {
+  case 0x8000000000000000UL:
+    return a + 10;
+  case 0:
+  case 1:
+  case 2:
+    return a + 20;
+  }
+  return a;
+}
+
+int main() {
+  int wide = h(4294967297L) + h(4294967295L) * 10 + h(-1) + dense(4294967298L) * 10 + dense(3);
+  wide = wide + far(-9223372036854775807L - 1, 0x8000000000000000UL) + far(1, 3) * 2;
+  return f(1) + f(100) + f(7) + f(0 - 5) + g(0, 0) + g(0, 1) + g(1, 0) + g(9, 9) + wide;
+}
@@ -0,0 +1,33 @@
+int f(int x) {
+  int a = 0;
+  switch (x) {
+  case 3:
+    a = a + 1;
+  case 4:
+    a = a + 2;
+    break;
+  case 5:
+    return 40;
+  case 7:
+    a = 8;
+    break;
+  case 8:
+  case 9:
+    a = 16;
+    break;
+  default:
+    a = 100;
+  }
+  return a;
+}
+
+int main() {
+  int s = 0;
+  for (int i = 0; i < 12; i++) {
+    if (i == 6) {
+      continue;
+    }
+    s = s + f(i);
+  }
+  return s + f(6) - 600;
+}
@@ -0,0 +1,13 @@
+int neg(int x) {
+  return -x;
+}
+
+int main() {
+  int a = 5;
+  int b = -a + +10;
+  int c = a < b;
+  int d = a >= b;
+  int e = !a + !0 + !!b;
+  int f = -neg(3) % 2 + -7 / 2;
+  return b * 10 + c + d + e * 3 + f + ~-1 + 20;
+}
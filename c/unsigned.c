@@ -0,0 +1,102 @@
+int printf(char *fmt, ...);
+
+unsigned char uc = 200;
+signed char sc = -3;
+unsigned short us = 65535;
+short ss = -2;
+unsigned int ui = 4000000000;
+long long ll = -5;
+unsigned long long ull;
+
+int check(long got, long want, int line) {
+  if (got != want) {
+    printf("line %d: got %ld want %ld\n", line, got, want);
+    return 0;
+  }
+  return 1;
+}
+
+unsigned div(unsigned a, unsigned b) {
+  return a / b;
+}
+
+long long mul(short a, unsigned char b) {
+  return a * b;
+}
+
+int more();
+
+int main() {
+  int ok = 0;
+  unsigned u = 0;
+  int i = -1;
+  long unsigned int lu = 1;
+  unsigned short t;
+  ok += check(uc + 100, 300, __LINE__);
+  ok += check(sc, -3, __LINE__);
+  ok += check(us + 1, 65536, __LINE__);
+  ok += check(ss * 3, -6, __LINE__);
+  ok += check(ui / 2, 2000000000, __LINE__);
+  ok += check(ui >> 31, 1, __LINE__);
+  ok += check(ui > 5, 1, __LINE__);
+  ok += check(u < i, 1, __LINE__);
+  ok += check(i < 0, 1, __LINE__);
+  ok += check(i >> 1, -1, __LINE__);
+  ok += check(u - 1 > 0, 1, __LINE__);
+  ok += check(ll < lu, 0, __LINE__);
+  ok += check(ll < 0, 1, __LINE__);
+  ok += check(ui % 7, 3, __LINE__);
+  ok += check(div(4000000000, 3), 1333333333, __LINE__);
+  ok += check(mul(-2, 250), -500, __LINE__);
+  t = 70000;
+  ok += check(t, 4464, __LINE__);
+  uc = 511;
+  ok += check(uc, 255, __LINE__);
+  sc = 255;
+  ok += check(sc, -1, __LINE__);
+  ull = 0;
+  ull = ull - 1;
+  ok += check(ull >> 60, 15, __LINE__);
+  u = 7;
+  u /= 2;
+  ok += check(u, 3, __LINE__);
+  i = -7;
+  i /= 2;
+  ok += check(i, -3, __LINE__);
+  return ok + more();
+}
+
+int more() {
+  unsigned char a = 255;
+  unsigned short b = 65535;
+  short c = -1;
+  unsigned int d = 1;
+  long e = -1;
+  unsigned long f = 3;
+  int ok = 0;
+  ok += check(a << 1, 510, __LINE__);
+  ok += check(~a, -256, __LINE__);
+  ok += check(-b, -65535, __LINE__);
+  ok += check(c == b, 0, __LINE__);
+  ok += check(d > e, 1, __LINE__);
+  ok += check(f > e, 0, __LINE__);
+  ok += check(d + e, 0, __LINE__);
+  ok += check(b * b, -131071, __LINE__);
+  ok += check((d << 31) >> 30, 2, __LINE__);
+  ok += check(a == 255 && c < 0, 1, __LINE__);
+  e = d - 2;
+  ok += check(e >> 31, 1, __LINE__);
+  e = c;
+  ok += check(e, -1, __LINE__);
+  f = b;
+  ok += check(f, 65535, __LINE__);
+  a += 10;
+  ok += check(a, 9, __LINE__);
+  c >>= 1;
+  ok += check(c, -1, __LINE__);
+  b >>= 1;
+  ok += check(b, 32767, __LINE__);
+  e = a ? c : d;
+  ok += check(e >> 31, 1, __LINE__);
+  return ok;
+}
@@ -0,0 +1,13 @@
+int main() {
+  int i = 0;
+  int a = 0;
+  int n = 3;
+  while (i < 10) {
+    a = a + i;
+    i++;
+  }
+  while (n)
+    n--;
+  while (a > 100) break;
+  return a + n;
+}
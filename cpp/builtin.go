@@ -0,0 +1,121 @@
+package cpp
+
+import "gocc/gen"
+
+// BuiltinDir names the directory of the headers that come with the
+// compiler, e.g. <stddef.h>. It may appear in SystemPaths.
+const BuiltinDir = "<built-in>"
+
+// systemPaths are searched for #include after IncludePaths, by the
+// object file format of the target: ELF for Linux, Mach-O for macOS.
+var systemPaths = map[gen.Format][]string{
+	gen.ELF: {
+		"/usr/local/include",
+		BuiltinDir,
+		"/usr/include/x86_64-linux-gnu",
+		"/usr/include",
+	},
+	gen.MachO: {
+		"/usr/local/include",
+		BuiltinDir,
+		"/usr/include",
+	},
+}
+
+// systemMacros are the predefined macros naming the operating system of
+// the target, by its object file format.
+var systemMacros = map[gen.Format][][2]string{
+	gen.ELF: {
+		{"__linux__", "1"},
+		{"__linux", "1"},
+		{"__unix__", "1"},
+		{"__unix", "1"},
+		{"__ELF__", "1"},
+	},
+	gen.MachO: {
+		{"__APPLE__", "1"},
+		{"__MACH__", "1"},
+	},
+}
+
+var predefined = [][2]string{
+	{"__STDC__", "1"},
+	{"__STDC_HOSTED__", "1"},
+	{"__gocc__", "1"},
+	{"__x86_64__", "1"},
+	{"__x86_64", "1"},
+	{"__amd64__", "1"},
+	{"__amd64", "1"},
+	{"__LP64__", "1"},
+	{"_LP64", "1"},
+	{"__CHAR_BIT__", "8"},
+	{"__SIZEOF_SHORT__", "2"},
+	{"__SIZEOF_INT__", "4"},
+	{"__SIZEOF_LONG__", "8"},
+	{"__SIZEOF_LONG_LONG__", "8"},
+	{"__SIZEOF_POINTER__", "8"},
+	{"__SIZEOF_FLOAT__", "4"},
+	{"__SIZEOF_DOUBLE__", "8"},
+	{"__SIZE_TYPE__", "unsigned long"},
+	{"__PTRDIFF_TYPE__", "long"},
+	{"__WCHAR_TYPE__", "int"},
+	{"__WCHAR_MAX__", "0x7fffffff"},
+	{"__WCHAR_MIN__", "(-__WCHAR_MAX__ - 1)"},
+	{"__ORDER_LITTLE_ENDIAN__", "1234"},
+	{"__ORDER_BIG_ENDIAN__", "4321"},
+	{"__BYTE_ORDER__", "__ORDER_LITTLE_ENDIAN__"},
+}
+
+// builtinHeaders are the headers found in BuiltinDir. The C library
+// expects the compiler to provide these.
+var builtinHeaders = map[string]string{
+	"stddef.h": `#ifndef __STDDEF_H
+#define __STDDEF_H
+typedef unsigned long size_t;
+typedef long ptrdiff_t;
+typedef int wchar_t;
+#define NULL ((void *)0)
+#define offsetof(type, member) ((size_t)&((type *)0)->member)
+#endif
+#if defined __need_wint_t && !defined __WINT_TYPE_DEFINED
+#define __WINT_TYPE_DEFINED
+typedef unsigned int wint_t;
+#endif
+#undef __need_size_t
+#undef __need_ptrdiff_t
+#undef __need_wchar_t
+#undef __need_wint_t
+#undef __need_NULL
+`,
+	"stdarg.h": `#ifndef __GNUC_VA_LIST
+#define __GNUC_VA_LIST
+typedef struct __va_list_tag {
+	unsigned int gp_offset;
+	unsigned int fp_offset;
+	void *overflow_arg_area;
+	void *reg_save_area;
+} __gnuc_va_list[1];
+#endif
+#ifdef __need___va_list
+#undef __need___va_list
+#elif !defined __STDARG_H
+#define __STDARG_H
+#ifndef _VA_LIST_DEFINED
+#define _VA_LIST_DEFINED
+typedef __gnuc_va_list va_list;
+#endif
+#define va_start(ap, last) __builtin_va_start(ap, last)
+#define va_arg(ap, type) __builtin_va_arg(ap, type)
+#define va_copy(dest, src) ((dest)[0] = (src)[0])
+#define va_end(ap) ((void)(ap))
+#endif
+`,
+	"stdbool.h": `#ifndef __STDBOOL_H
+#define __STDBOOL_H
+#define bool _Bool
+#define true 1
+#define false 0
+#define __bool_true_false_are_defined 1
+#endif
+`,
+}
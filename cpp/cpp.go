@@ -0,0 +1,583 @@
+package cpp
+
+import (
+	"bytes"
+	"fmt"
+	"gocc/diag"
+	"gocc/gen"
+	"gocc/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxIncludeDepth guards against files that include themselves.
+const maxIncludeDepth = 200
+
+// Preprocessor executes the directives of a C source file and expands
+// its macros. The result is C source in which every token stays on its
+// original line; changes of file or line are recorded with
+//
+//	# line "file"
+//
+// markers, which the lexer understands.
+type Preprocessor struct {
+	IncludePaths []string // searched for #include before SystemPaths
+	SystemPaths  []string
+
+	diags   *diag.List
+	macros  map[string]*macro
+	stack   []*input
+	conds   []*cond
+	once    map[string]bool
+	sources map[string][]byte
+	out     printer
+}
+
+// input is a list of tokens being read. Files and macro arguments
+// are boundaries: a macro invocation cannot extend past their end.
+type input struct {
+	toks     []*Token
+	i        int
+	file     *file
+	conds    int // len(pp.conds) when file was entered
+	boundary bool
+}
+
+type condCtx int
+
+const (
+	inThen condCtx = iota
+	inElif
+	inElse
+)
+
+// cond is an #if, #ifdef or #ifndef whose #endif has not been seen.
+type cond struct {
+	tok      *Token
+	ctx      condCtx
+	included bool // one of its groups was included
+}
+
+// New returns a preprocessor for C code compiled for target, which
+// decides the system headers and the predefined macros.
+func New(target *gen.Target) *Preprocessor {
+	pp := &Preprocessor{
+		SystemPaths: systemPaths[target.Format],
+		diags:       diag.NewList(),
+		macros:      map[string]*macro{},
+		once:        map[string]bool{},
+		sources:     map[string][]byte{},
+	}
+	for _, m := range append(predefined, systemMacros[target.Format]...) {
+		pp.Define(m[0], m[1])
+	}
+	now := time.Now()
+	pp.defineBuiltin("__FILE__", func(t *Token) *Token {
+		return newToken(stringConst, strconv.Quote(t.Pos().File), t)
+	})
+	pp.defineBuiltin("__LINE__", func(t *Token) *Token {
+		return newToken(number, strconv.Itoa(t.Pos().Line), t)
+	})
+	pp.defineBuiltin("__DATE__", func(t *Token) *Token {
+		return newToken(stringConst, now.Format(`"Jan _2 2006"`), t)
+	})
+	pp.defineBuiltin("__TIME__", func(t *Token) *Token {
+		return newToken(stringConst, now.Format(`"15:04:05"`), t)
+	})
+	return pp
+}
+
+func (pp *Preprocessor) Diags() *diag.List {
+	return pp.diags
+}
+
+// Sources returns the contents of every file read, by name,
+// for printing diagnostics.
+func (pp *Preprocessor) Sources() map[string][]byte {
+	return pp.sources
+}
+
+// Define defines the object-like macro name, as -D does. name may also
+// be of the form "f(x)" to define a function-like macro.
+func (pp *Preprocessor) Define(name, value string) {
+	z := &tokenizer{
+		src:   []byte(name + " " + value),
+		pos:   token.Position{Line: 1, Column: 1},
+		file:  &file{name: "<command line>", dir: -1},
+		diags: pp.diags,
+	}
+	pp.define(z.tokenize())
+}
+
+func (pp *Preprocessor) Undef(name string) {
+	delete(pp.macros, name)
+}
+
+// Preprocess returns the preprocessed form of source, read from filename.
+func (pp *Preprocessor) Preprocess(filename string, source []byte) []byte {
+	pp.pushFile(&file{path: filename, name: filename, dir: -1}, source)
+	for {
+		t := pp.next()
+		if t == nil {
+			break
+		}
+		if t.bol && t.is("#") {
+			pp.directive(t)
+			continue
+		}
+		if pp.expand(t) {
+			continue
+		}
+		pp.out.token(t)
+	}
+	return pp.out.bytes()
+}
+
+func (pp *Preprocessor) errorf(t *Token, format string, a ...interface{}) *diag.Diagnostic {
+	return pp.diags.Errorf(t.Pos(), t.end(), format, a...)
+}
+
+func (pp *Preprocessor) warnf(t *Token, format string, a ...interface{}) *diag.Diagnostic {
+	return pp.diags.Warnf(t.Pos(), t.end(), format, a...)
+}
+
+func (pp *Preprocessor) pushFile(f *file, source []byte) {
+	pp.sources[f.name] = source
+	z := &tokenizer{src: source, pos: token.Position{Line: 1, Column: 1}, file: f, diags: pp.diags}
+	pp.stack = append(pp.stack, &input{toks: z.tokenize(), file: f, conds: len(pp.conds), boundary: true})
+}
+
+// push makes toks the next tokens to be read.
+func (pp *Preprocessor) push(toks []*Token) {
+	if len(toks) > 0 {
+		pp.stack = append(pp.stack, &input{toks: toks})
+	}
+}
+
+func (pp *Preprocessor) pop() {
+	in := pp.stack[len(pp.stack)-1]
+	pp.stack = pp.stack[:len(pp.stack)-1]
+	if in.file == nil {
+		return
+	}
+	for len(pp.conds) > in.conds {
+		c := pp.conds[len(pp.conds)-1]
+		pp.errorf(c.tok, "unterminated conditional directive")
+		pp.conds = pp.conds[:len(pp.conds)-1]
+	}
+}
+
+// fileInput returns the file being read.
+func (pp *Preprocessor) fileInput() *input {
+	for i := len(pp.stack) - 1; ; i-- {
+		if pp.stack[i].file != nil {
+			return pp.stack[i]
+		}
+	}
+}
+
+// next returns the next token, or nil at the end of the input.
+func (pp *Preprocessor) next() *Token {
+	for len(pp.stack) > 0 {
+		in := pp.stack[len(pp.stack)-1]
+		if in.i < len(in.toks) {
+			in.i++
+			return in.toks[in.i-1]
+		}
+		pp.pop()
+	}
+	return nil
+}
+
+// peek returns the token next would return, or nil if the current
+// file or macro argument ends first.
+func (pp *Preprocessor) peek() *Token {
+	for i := len(pp.stack) - 1; i >= 0; i-- {
+		in := pp.stack[i]
+		if in.i < len(in.toks) {
+			return in.toks[in.i]
+		}
+		if in.boundary {
+			return nil
+		}
+	}
+	return nil
+}
+
+// restOfLine reads the remaining tokens of a directive.
+func (pp *Preprocessor) restOfLine() []*Token {
+	var toks []*Token
+	for {
+		t := pp.peek()
+		if t == nil || t.bol {
+			return toks
+		}
+		toks = append(toks, pp.next())
+	}
+}
+
+// endOfDirective warns about tokens that follow a complete directive.
+func (pp *Preprocessor) endOfDirective(dir *Token) {
+	pp.extraTokens(dir, pp.restOfLine())
+}
+
+func (pp *Preprocessor) extraTokens(dir *Token, toks []*Token) {
+	if len(toks) > 0 {
+		pp.warnf(toks[0], "extra tokens at end of #%s directive", dir.Str)
+	}
+}
+
+func (pp *Preprocessor) directive(hash *Token) {
+	name := pp.peek()
+	if name == nil || name.bol {
+		// null directive
+		return
+	}
+	pp.next()
+
+	if name.kind == number {
+		// GNU line marker: # 42 "file"
+		pp.line(name, append([]*Token{name}, pp.restOfLine()...))
+		return
+	}
+
+	switch name.Str {
+	case "include", "include_next":
+		pp.include(name, name.Str == "include_next")
+	case "define":
+		toks := pp.restOfLine()
+		if len(toks) == 0 {
+			pp.errorf(name, "macro name missing")
+			return
+		}
+		pp.define(toks)
+	case "undef":
+		if m := pp.macroName(name); m != nil {
+			pp.Undef(m.Str)
+		}
+	case "if":
+		pp.pushCond(name, pp.evalLine(name))
+	case "ifdef", "ifndef":
+		m := pp.macroName(name)
+		if m == nil {
+			pp.pushCond(name, false)
+			return
+		}
+		_, defined := pp.macros[m.Str]
+		pp.pushCond(name, defined == (name.Str == "ifdef"))
+	case "elif":
+		c := pp.currentCond(name)
+		if c == nil {
+			return
+		}
+		if c.ctx == inElse {
+			pp.errorf(name, "#elif after #else")
+		}
+		c.ctx = inElif
+		if c.included {
+			pp.restOfLine()
+			pp.skip()
+		} else if pp.evalLine(name) {
+			c.included = true
+		} else {
+			pp.skip()
+		}
+	case "else":
+		c := pp.currentCond(name)
+		if c == nil {
+			return
+		}
+		if c.ctx == inElse {
+			pp.errorf(name, "#else after #else")
+		}
+		c.ctx = inElse
+		pp.endOfDirective(name)
+		if c.included {
+			pp.skip()
+		}
+		c.included = true
+	case "endif":
+		if pp.currentCond(name) == nil {
+			return
+		}
+		pp.conds = pp.conds[:len(pp.conds)-1]
+		pp.endOfDirective(name)
+	case "line":
+		pp.line(name, pp.expandList(pp.restOfLine()))
+	case "error":
+		pp.errorf(name, "%s", spell(pp.restOfLine()))
+	case "warning":
+		pp.warnf(name, "%s", spell(pp.restOfLine()))
+	case "pragma":
+		toks := pp.restOfLine()
+		if len(toks) == 1 && toks[0].Str == "once" {
+			pp.once[name.src.path] = true
+		}
+	default:
+		pp.errorf(name, "invalid preprocessing directive")
+		pp.restOfLine()
+	}
+}
+
+// macroName reads the identifier following #ifdef, #ifndef or #undef.
+func (pp *Preprocessor) macroName(dir *Token) *Token {
+	toks := pp.restOfLine()
+	if len(toks) == 0 {
+		pp.errorf(dir, "macro name missing")
+		return nil
+	}
+	if toks[0].kind != ident {
+		pp.errorf(toks[0], "macro name must be an identifier")
+		return nil
+	}
+	pp.extraTokens(dir, toks[1:])
+	return toks[0]
+}
+
+func (pp *Preprocessor) pushCond(dir *Token, included bool) {
+	pp.conds = append(pp.conds, &cond{tok: dir, included: included})
+	if !included {
+		pp.skip()
+	}
+}
+
+// currentCond returns the conditional an #elif, #else or #endif belongs to.
+func (pp *Preprocessor) currentCond(dir *Token) *cond {
+	in := pp.fileInput()
+	if len(pp.conds) <= in.conds {
+		pp.errorf(dir, "#%s without #if", dir.Str)
+		pp.restOfLine()
+		return nil
+	}
+	return pp.conds[len(pp.conds)-1]
+}
+
+// skip skips a group whose condition is false, up to the #elif,
+// #else or #endif that ends it.
+func (pp *Preprocessor) skip() {
+	in := pp.fileInput()
+	depth := 0
+	for ; in.i < len(in.toks); in.i++ {
+		t := in.toks[in.i]
+		if !t.bol || !t.is("#") || in.i+1 == len(in.toks) || in.toks[in.i+1].bol {
+			continue
+		}
+		switch in.toks[in.i+1].Str {
+		case "if", "ifdef", "ifndef":
+			depth++
+		case "elif", "else":
+			if depth == 0 {
+				return
+			}
+		case "endif":
+			if depth == 0 {
+				return
+			}
+			depth--
+		}
+	}
+}
+
+// line executes #line and GNU line markers.
+func (pp *Preprocessor) line(dir *Token, toks []*Token) {
+	if len(toks) == 0 || toks[0].kind != number || strings.Trim(toks[0].Str, "0123456789") != "" {
+		pp.errorf(dir, "#line directive requires a simple digit sequence")
+		return
+	}
+	n, _ := strconv.Atoi(toks[0].Str)
+	f := dir.src
+	if len(toks) > 1 {
+		name, err := strconv.Unquote(toks[1].Str)
+		if toks[1].kind != stringConst || err != nil {
+			pp.errorf(toks[1], "invalid filename for #line directive")
+			return
+		}
+		f.name = name
+	}
+	// the line following the directive gets number n
+	last := toks[len(toks)-1]
+	if last.src == f {
+		f.lineDelta = n - (last.pos.Line + 1)
+	} else {
+		f.lineDelta = n - (dir.pos.Line + 1)
+	}
+}
+
+func (pp *Preprocessor) include(dir *Token, next bool) {
+	toks := pp.restOfLine()
+	name, quoted, ok := pp.headerName(dir, toks, true)
+	if !ok {
+		return
+	}
+	cur := dir.src
+	if cur.depth >= maxIncludeDepth {
+		pp.errorf(dir, "#include nested too deeply")
+		return
+	}
+	path, index, found := pp.search(name, quoted, cur, next)
+	if !found {
+		pp.errorf(toks[0], "'%s' file not found", name)
+		return
+	}
+	if pp.once[path] {
+		return
+	}
+
+	var source []byte
+	if h, ok := builtinHeaders[name]; ok && index >= 0 && pp.dirs()[index] == BuiltinDir {
+		source = []byte(h)
+	} else {
+		var err error
+		if source, err = ioutil.ReadFile(path); err != nil {
+			pp.errorf(toks[0], "%v", err)
+			return
+		}
+	}
+	pp.pushFile(&file{path: path, name: path, dir: index, depth: cur.depth + 1}, source)
+}
+
+// headerName reads the "file" or <file> operand of #include.
+// If toks is neither, it is macro expanded first.
+func (pp *Preprocessor) headerName(dir *Token, toks []*Token, expand bool) (name string, quoted, ok bool) {
+	if len(toks) > 0 && toks[0].kind == stringConst {
+		pp.extraTokens(dir, toks[1:])
+		return strings.Trim(toks[0].Str, `"`), true, true
+	}
+	if len(toks) > 0 && toks[0].is("<") {
+		for i := 1; i < len(toks); i++ {
+			if toks[i].is(">") {
+				pp.extraTokens(dir, toks[i+1:])
+				return spell(toks[1:i]), false, true
+			}
+		}
+		pp.errorf(toks[len(toks)-1], "expected '>'")
+		return "", false, false
+	}
+	if expand && len(toks) > 0 {
+		return pp.headerName(dir, pp.expandList(toks), false)
+	}
+	pp.errorf(dir, "expected \"FILENAME\" or <FILENAME>")
+	return "", false, false
+}
+
+func (pp *Preprocessor) dirs() []string {
+	return append(append([]string{}, pp.IncludePaths...), pp.SystemPaths...)
+}
+
+// search finds the file to include. index is the position of the
+// directory it was found in, which #include_next continues after.
+func (pp *Preprocessor) search(name string, quoted bool, cur *file, next bool) (path string, index int, ok bool) {
+	if filepath.IsAbs(name) {
+		return name, -1, exists(name)
+	}
+	if quoted && !next {
+		path := filepath.Join(filepath.Dir(cur.path), name)
+		if exists(path) {
+			return path, -1, true
+		}
+	}
+	start := 0
+	if next {
+		start = cur.dir + 1
+	}
+	for i, dir := range pp.dirs() {
+		if i < start {
+			continue
+		}
+		if dir == BuiltinDir {
+			if _, ok := builtinHeaders[name]; ok {
+				return filepath.Join(dir, name), i, true
+			}
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if exists(path) {
+			return path, i, true
+		}
+	}
+	return "", -1, false
+}
+
+func exists(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
+
+// spell returns the source text of toks.
+func spell(toks []*Token) string {
+	var b strings.Builder
+	for i, t := range toks {
+		if i > 0 && t.space {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.Str)
+	}
+	return b.String()
+}
+
+func newToken(k kind, s string, at *Token) *Token {
+	return &Token{kind: k, Str: s, pos: at.pos, src: at.src, space: at.space}
+}
+
+// printer writes tokens back as text, each on the line it came from.
+type printer struct {
+	buf  bytes.Buffer
+	file string
+	line int
+	col  int
+	prev *Token
+}
+
+func (w *printer) token(t *Token) {
+	pos := t.Pos()
+	if w.prev == nil || pos.File != w.file || pos.Line < w.line || pos.Line > w.line+8 {
+		if w.col > 0 {
+			w.buf.WriteByte('\n')
+		}
+		fmt.Fprintf(&w.buf, "# %d %s\n", pos.Line, strconv.Quote(pos.File))
+		w.file, w.line, w.col = pos.File, pos.Line, 0
+	}
+	for w.line < pos.Line {
+		w.buf.WriteByte('\n')
+		w.line++
+		w.col = 0
+	}
+	switch {
+	case w.col < pos.Column-1 && (w.col == 0 || t.space):
+		// keep columns so that diagnostics point at the right place
+		w.buf.WriteString(strings.Repeat(" ", pos.Column-1-w.col))
+		w.col = pos.Column - 1
+	case w.col > 0 && (t.space || needSpace(w.prev, t)):
+		w.buf.WriteByte(' ')
+		w.col++
+	}
+	w.buf.WriteString(t.Str)
+	w.col += len(t.Str)
+	w.prev = t
+}
+
+func (w *printer) bytes() []byte {
+	if w.col > 0 {
+		w.buf.WriteByte('\n')
+		w.col = 0
+	}
+	return w.buf.Bytes()
+}
+
+// needSpace reports whether t would be read as part of prev if it
+// was printed right after it.
+func needSpace(prev, t *Token) bool {
+	if prev.src == t.src && prev.pos.Offset+len(prev.Str) == t.pos.Offset {
+		return false
+	}
+	a, b := prev.Str[len(prev.Str)-1], t.Str[0]
+	if isIdentChar(a) && (isIdentChar(b) || b == '.') {
+		return true
+	}
+	const ops = "+-*/%&|^!=<>.#:"
+	return strchr(ops, a) && strchr(ops, b)
+}
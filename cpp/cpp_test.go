@@ -0,0 +1,203 @@
+package cpp
+
+import (
+	"gocc/diag"
+	"gocc/gen"
+	"gocc/lexer"
+	"gocc/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tokens returns the preprocessed source without line markers,
+// with tokens separated by single spaces.
+func tokens(out []byte) string {
+	var lines []string
+	for _, l := range strings.Split(string(out), "\n") {
+		if !strings.HasPrefix(l, "#") {
+			lines = append(lines, l)
+		}
+	}
+	return strings.Join(strings.Fields(strings.Join(lines, " ")), " ")
+}
+
+func preprocess(t *testing.T, src string) string {
+	pp := New(gen.DefaultTarget)
+	out := pp.Preprocess("a.c", []byte(src))
+	if pp.Diags().HasErrors() {
+		t.Fatalf("%q: unexpected error: %s", src, pp.Diags().All()[0].Msg)
+	}
+	return tokens(out)
+}
+
+var cppTests = []struct {
+	source string
+	expect string
+}{
+	{"#define N 10\nint a[N];", "int a[10];"},
+	{"#define N 10\n#undef N\nN", "N"},
+	{"#define F(x, y) x * y\nF(1 + 2, 3)", "1 + 2 * 3"},
+	{"#define F() 1\nF() F", "1 F"},
+	{"#define F(x) (x)\n#define G F(\nG 1)", "(1)"},
+	{"#define STR(x) #x\nSTR(a  + \"b\\n\")", `"a + \"b\\n\""`},
+	{"#define CAT(a, b) a ## b\nCAT(x, 1) CAT(, y) CAT(<, <=)", "x1 y <<="},
+	{"#define X X + 1\nX", "X + 1"},
+	{"#define f(a) a*g\n#define g(a) f(a)\nf(2)(9)", "2*9*g"},
+	{"#define A B\n#define B A\nA B", "A B"},
+	{"#define N 2\n#define CAT(a, b) a ## b\n#define XCAT(a, b) CAT(a, b)\nCAT(N, 1) XCAT(N, 1)", "N1 21"},
+	{"#define P(fmt, ...) f(fmt, ## __VA_ARGS__)\nP(1) P(1, 2, 3)", "f(1) f(1, 2, 3)"},
+	{"#define P(args...) g(args)\nP(1, 2)", "g(1, 2)"},
+	{"#define E\n#if defined E && !defined(F)\nyes\n#else\nno\n#endif", "yes"},
+	{"#if 0\n#if 1\nno\n#endif\n#elif 2 > 1\nyes\n#else\nno\n#endif", "yes"},
+	{"#ifndef G\n#define G\na\n#endif\n#ifdef G\nb\n#endif", "a b"},
+	{"#if -1 > 0u\nyes\n#endif", "yes"},
+	{"#if (1 ? 2 : 1 / 0) == 2 && 0x10 == 020 && 'a' == 97\nyes\n#endif", "yes"},
+	{"#if 0 && 1 / 0 || (1 << 3) % 5 == 3\nyes\n#endif", "yes"},
+	{"#if UNDEFINED_MACRO\nno\n#endif", ""},
+	{"#ifdef __WCHAR_MAX__\nyes\n#elif L'\\0' - 1 > 0\nno\n#endif\n#if __WCHAR_MIN__ < 0\nsigned\n#endif", "yes signed"},
+	{"a = __LINE__;\nb = __LINE__;", "a = 1; b = 2;"},
+	{"__FILE__", `"a.c"`},
+	{"#line 100 \"b.c\"\n__LINE__ __FILE__", `100 "b.c"`},
+	{"a /* comment */ b // comment\nc", "a b c"},
+	{"#define LONG 1 + \\\n 2\nLONG", "1 + 2"},
+	{"#\n#pragma once\nx", "x"},
+}
+
+func TestPreprocess(t *testing.T) {
+	for _, test := range cppTests {
+		if out := preprocess(t, test.source); out != test.expect {
+			t.Errorf("%q: expected output is %q, but got %q", test.source, test.expect, out)
+		}
+	}
+}
+
+var cppErrorTests = []struct {
+	source string
+	msgs   []string
+}{
+	{"#error stop here", []string{"stop here"}},
+	{"#foo", []string{"invalid preprocessing directive"}},
+	{"#if 1\nx", []string{"unterminated conditional directive"}},
+	{"#endif", []string{"#endif without #if"}},
+	{"#if 1\n#else\n#else\n#endif", []string{"#else after #else"}},
+	{"#if 1 / 0\n#endif", []string{"division by zero in preprocessor expression"}},
+	{"#if\n#endif", []string{"expected value in expression"}},
+	{"#if 1 2\n#endif", []string{"token is not a valid binary operator in a preprocessor subexpression"}},
+	{"#define 1 2", []string{"macro name must be an identifier"}},
+	{"#define F(x) #y", []string{"'#' is not followed by a macro parameter"}},
+	{"#define F(x) ## x", []string{"'##' cannot appear at either end of a macro expansion"}},
+	{"#define F(x, x) x", []string{"duplicate macro parameter name 'x'"}},
+	{"#define F(x, y) x\nF(1)", []string{"too few arguments provided to function-like macro invocation"}},
+	{"#define F(x) x\nF(1, 2)", []string{"too many arguments provided to function-like macro invocation"}},
+	{"#define F(x) x\nF(1", []string{"unterminated function-like macro invocation"}},
+	{"#define CAT(a, b) a ## b\nCAT(+, /)", []string{"pasting formed '+/', an invalid preprocessing token"}},
+	{"#include \"no_such_file.h\"", []string{"'no_such_file.h' file not found"}},
+	{"#include", []string{"expected \"FILENAME\" or <FILENAME>"}},
+	{"#line x", []string{"#line directive requires a simple digit sequence"}},
+}
+
+func TestPreprocessErrors(t *testing.T) {
+	for _, test := range cppErrorTests {
+		pp := New(gen.DefaultTarget)
+		pp.Preprocess("a.c", []byte(test.source))
+		var msgs []string
+		for _, d := range pp.Diags().All() {
+			msgs = append(msgs, d.Msg)
+		}
+		if strings.Join(msgs, "\n") != strings.Join(test.msgs, "\n") {
+			t.Errorf("%q: expected errors are %q, but got %q", test.source, test.msgs, msgs)
+		}
+	}
+}
+
+func TestRedefinition(t *testing.T) {
+	pp := New(gen.DefaultTarget)
+	pp.Preprocess("a.c", []byte("#define A 1\n#define A 1\n#define A 2\n"))
+	diags := pp.Diags().All()
+	if len(diags) != 1 || diags[0].Msg != "'A' macro redefined" || diags[0].Severity != diag.Warning {
+		t.Fatalf("expected one redefinition warning, but got %v", diags)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"main.c":       "#include \"a.h\"\n#include <b.h>\n#include \"a.h\"\nint main;\n",
+		"a.h":          "#pragma once\nint a;\n",
+		"inc/b.h":      "#ifndef B_H\n#define B_H\n#include_next <b.h>\nint b = __LINE__;\n#endif\n",
+		"inc/next/b.h": "int next;\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pp := New(gen.DefaultTarget)
+	pp.IncludePaths = []string{filepath.Join(dir, "inc"), filepath.Join(dir, "inc/next")}
+	main := filepath.Join(dir, "main.c")
+	out := pp.Preprocess(main, []byte(files["main.c"]))
+	if pp.Diags().HasErrors() {
+		t.Fatalf("unexpected error: %s", pp.Diags().All()[0].Error())
+	}
+	expect := "int a; int next; int b = 4; int main;"
+	if tokens(out) != expect {
+		t.Errorf("expected output is %q, but got %q", expect, tokens(out))
+	}
+
+	// the lexer places tokens at their original positions
+	l := lexer.NewLexer(out)
+	var last token.Position
+	for tok := l.Next(); tok.Kind != token.EOF; tok = l.Next() {
+		if tok.String() == "main" {
+			last = tok.Pos
+		}
+	}
+	if last.File != main || last.Line != 4 || last.Column != 5 {
+		t.Errorf("expected position of main is %s:4:5, but got %s:%d:%d", main, last.File, last.Line, last.Column)
+	}
+}
+
+func TestBuiltinHeaders(t *testing.T) {
+	pp := New(gen.DefaultTarget)
+	pp.SystemPaths = []string{BuiltinDir}
+	out := pp.Preprocess("a.c", []byte("#include <stddef.h>\n#include <stdarg.h>\n#include <stdbool.h>\nva_list ap; size_t n = va_arg(ap, int); bool b = true;"))
+	if pp.Diags().HasErrors() {
+		t.Fatalf("unexpected error: %s", pp.Diags().All()[0].Error())
+	}
+	if s := tokens(out); !strings.HasSuffix(s, "va_list ap; size_t n = __builtin_va_arg(ap, int); _Bool b = 1;") || !strings.Contains(s, "typedef unsigned long size_t;") {
+		t.Errorf("unexpected output %q", s)
+	}
+}
+
+func TestTargetMacros(t *testing.T) {
+	src := "#if defined __linux__ && defined __ELF__\nlinux\n#endif\n#if defined __APPLE__ && defined __MACH__\napple\n#endif\n__x86_64__"
+	for _, triple := range []string{"x86_64-linux-gnu", "x86_64-apple-darwin"} {
+		target, err := gen.ParseTarget(triple)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pp := New(target)
+		want := "linux 1"
+		if target.Format == gen.MachO {
+			want = "apple 1"
+		}
+		if s := tokens(pp.Preprocess("a.c", []byte(src))); s != want {
+			t.Errorf("%s: expected %q, but got %q", triple, want, s)
+		}
+		for _, dir := range pp.SystemPaths {
+			if strings.Contains(dir, "linux") && target.Format == gen.MachO {
+				t.Errorf("%s: unexpected system path %s", triple, dir)
+			}
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package cpp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// value is the result of a #if subexpression. Like the compiler,
+// the preprocessor computes in the widest integer types.
+type value struct {
+	n        int64
+	unsigned bool
+}
+
+// evaluator evaluates the controlling expression of #if and #elif.
+type evaluator struct {
+	pp     *Preprocessor
+	toks   []*Token
+	i      int
+	skip   int // > 0 in operands that are not evaluated
+	failed bool
+}
+
+// evalLine reads and evaluates the expression of an #if or #elif.
+func (pp *Preprocessor) evalLine(dir *Token) bool {
+	line := pp.restOfLine()
+
+	// defined must be replaced before macro expansion
+	var toks []*Token
+	for i := 0; i < len(line); i++ {
+		t := line[i]
+		if t.kind != ident || t.Str != "defined" {
+			toks = append(toks, t)
+			continue
+		}
+		name, n := pp.defined(line[i+1:])
+		if name == nil {
+			pp.errorf(t, "macro name missing")
+			return false
+		}
+		i += n
+		v := "0"
+		if _, ok := pp.macros[name.Str]; ok {
+			v = "1"
+		}
+		toks = append(toks, newToken(number, v, t))
+	}
+	toks = pp.expandList(toks)
+
+	if len(toks) == 0 {
+		pp.errorf(dir, "expected value in expression")
+		return false
+	}
+	e := &evaluator{pp: pp, toks: toks}
+	v := e.cond()
+	if !e.failed && e.i < len(toks) {
+		e.errorf(toks[e.i], "token is not a valid binary operator in a preprocessor subexpression")
+	}
+	return !e.failed && v.n != 0
+}
+
+// defined parses the operand "X" or "(X)" of defined. It returns
+// the name and the number of tokens the operand spans.
+func (pp *Preprocessor) defined(toks []*Token) (*Token, int) {
+	if len(toks) > 0 && toks[0].kind == ident {
+		return toks[0], 1
+	}
+	if len(toks) > 2 && toks[0].is("(") && toks[1].kind == ident && toks[2].is(")") {
+		return toks[1], 3
+	}
+	return nil, 0
+}
+
+func (e *evaluator) errorf(t *Token, format string, a ...interface{}) {
+	if !e.failed {
+		e.pp.errorf(t, format, a...)
+	}
+	e.failed = true
+}
+
+func (e *evaluator) peek() *Token {
+	if e.i < len(e.toks) {
+		return e.toks[e.i]
+	}
+	return nil
+}
+
+func (e *evaluator) accept(op string) bool {
+	if t := e.peek(); t != nil && t.is(op) {
+		e.i++
+		return true
+	}
+	return false
+}
+
+func (e *evaluator) cond() value {
+	c := e.binary(1)
+	if !e.accept("?") {
+		return c
+	}
+	if c.n == 0 {
+		e.skip++
+	}
+	x := e.cond()
+	if c.n == 0 {
+		e.skip--
+	}
+	if !e.accept(":") {
+		e.expected("':'")
+		return value{}
+	}
+	if c.n != 0 {
+		e.skip++
+	}
+	y := e.cond()
+	if c.n != 0 {
+		e.skip--
+	}
+	u := x.unsigned || y.unsigned
+	if c.n != 0 {
+		return value{x.n, u}
+	}
+	return value{y.n, u}
+}
+
+func (e *evaluator) expected(what string) {
+	if t := e.peek(); t != nil {
+		e.errorf(t, "expected %s in preprocessor expression", what)
+	} else {
+		e.errorf(e.toks[len(e.toks)-1], "expected %s in preprocessor expression", what)
+	}
+}
+
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, ">": 7, "<=": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+}
+
+func (e *evaluator) binary(prec int) value {
+	x := e.unary()
+	for !e.failed {
+		op := e.peek()
+		if op == nil || op.kind != punct {
+			return x
+		}
+		p, ok := precedence[op.Str]
+		if !ok || p < prec {
+			return x
+		}
+		e.i++
+
+		// the right operand of && and || is only evaluated if needed
+		short := (op.Str == "&&" && x.n == 0) || (op.Str == "||" && x.n != 0)
+		if short {
+			e.skip++
+		}
+		y := e.binary(p + 1)
+		if short {
+			e.skip--
+		}
+		x = e.apply(op, x, y)
+	}
+	return x
+}
+
+func (e *evaluator) apply(op *Token, x, y value) value {
+	u := x.unsigned || y.unsigned
+	ux, uy := uint64(x.n), uint64(y.n)
+	b := func(c bool) value {
+		if c {
+			return value{n: 1}
+		}
+		return value{n: 0}
+	}
+	switch op.Str {
+	case "||":
+		return b(x.n != 0 || y.n != 0)
+	case "&&":
+		return b(x.n != 0 && y.n != 0)
+	case "|":
+		return value{x.n | y.n, u}
+	case "^":
+		return value{x.n ^ y.n, u}
+	case "&":
+		return value{x.n & y.n, u}
+	case "==":
+		return b(x.n == y.n)
+	case "!=":
+		return b(x.n != y.n)
+	case "<":
+		if u {
+			return b(ux < uy)
+		}
+		return b(x.n < y.n)
+	case ">":
+		if u {
+			return b(ux > uy)
+		}
+		return b(x.n > y.n)
+	case "<=":
+		if u {
+			return b(ux <= uy)
+		}
+		return b(x.n <= y.n)
+	case ">=":
+		if u {
+			return b(ux >= uy)
+		}
+		return b(x.n >= y.n)
+	case "<<":
+		return value{x.n << (uy & 63), x.unsigned}
+	case ">>":
+		if x.unsigned {
+			return value{int64(ux >> (uy & 63)), true}
+		}
+		return value{x.n >> (uy & 63), false}
+	case "+":
+		return value{x.n + y.n, u}
+	case "-":
+		return value{x.n - y.n, u}
+	case "*":
+		return value{x.n * y.n, u}
+	case "/", "%":
+		if y.n == 0 {
+			if e.skip == 0 {
+				e.errorf(op, "division by zero in preprocessor expression")
+			}
+			return value{0, u}
+		}
+		if u {
+			if op.Str == "/" {
+				return value{int64(ux / uy), true}
+			}
+			return value{int64(ux % uy), true}
+		}
+		if op.Str == "/" {
+			return value{x.n / y.n, false}
+		}
+		return value{x.n % y.n, false}
+	}
+	panic("unreachable")
+}
+
+func (e *evaluator) unary() value {
+	t := e.peek()
+	if t == nil {
+		e.expected("value")
+		return value{}
+	}
+	switch {
+	case t.is("+"):
+		e.i++
+		return e.unary()
+	case t.is("-"):
+		e.i++
+		v := e.unary()
+		return value{-v.n, v.unsigned}
+	case t.is("~"):
+		e.i++
+		v := e.unary()
+		return value{^v.n, v.unsigned}
+	case t.is("!"):
+		e.i++
+		if e.unary().n == 0 {
+			return value{n: 1}
+		}
+		return value{n: 0}
+	}
+	return e.primary()
+}
+
+func (e *evaluator) primary() value {
+	t := e.peek()
+	e.i++
+	switch {
+	case t.is("("):
+		v := e.cond()
+		if !e.accept(")") {
+			e.expected("')'")
+		}
+		return v
+	case t.kind == number:
+		return e.number(t)
+	case t.kind == charConst:
+		return e.char(t)
+	case t.kind == ident:
+		if t.Str == "defined" {
+			// defined produced by a macro expansion
+			name, n := e.pp.defined(e.toks[e.i:])
+			if name == nil {
+				e.errorf(t, "macro name missing")
+				return value{}
+			}
+			_, def := e.pp.macros[name.Str]
+			e.i += n
+			if def {
+				return value{n: 1}
+			}
+			return value{n: 0}
+		}
+		// identifiers that are not macros evaluate to 0
+		return value{}
+	}
+	e.errorf(t, "invalid token at start of a preprocessor expression")
+	return value{}
+}
+
+func (e *evaluator) number(t *Token) value {
+	s := strings.ToLower(t.Str)
+	unsigned := false
+	for len(s) > 0 && (strings.HasSuffix(s, "u") || strings.HasSuffix(s, "l")) {
+		if strings.HasSuffix(s, "u") {
+			unsigned = true
+		}
+		s = s[:len(s)-1]
+	}
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x"):
+		base, s = 16, s[2:]
+	case strings.HasPrefix(s, "0b"):
+		base, s = 2, s[2:]
+	case len(s) > 1 && s[0] == '0':
+		base, s = 8, s[1:]
+	}
+	n, err := strconv.ParseUint(s, base, 64)
+	if err != nil {
+		if strings.ContainsAny(t.Str, ".") || base == 10 && strings.ContainsAny(s, "e") {
+			e.errorf(t, "floating point literal in preprocessor expression")
+		} else {
+			e.errorf(t, "invalid integer constant '%s' in preprocessor expression", t.Str)
+		}
+		return value{}
+	}
+	return value{int64(n), unsigned || n > 1<<63-1}
+}
+
+func (e *evaluator) char(t *Token) value {
+	s := t.Str[1 : len(t.Str)-1]
+	if len(s) == 0 {
+		e.errorf(t, "empty character constant")
+		return value{}
+	}
+	if s[0] != '\\' {
+		return value{n: int64(int8(s[0]))}
+	}
+	if len(s) > 1 {
+		switch s[1] {
+		case 'n':
+			return value{n: '\n'}
+		case 't':
+			return value{n: '\t'}
+		case 'r':
+			return value{n: '\r'}
+		case 'a':
+			return value{n: 7}
+		case 'b':
+			return value{n: 8}
+		case 'f':
+			return value{n: 12}
+		case 'v':
+			return value{n: 11}
+		case 'x':
+			n, _ := strconv.ParseUint(s[2:], 16, 8)
+			return value{n: int64(int8(n))}
+		}
+		if '0' <= s[1] && s[1] <= '7' {
+			n, _ := strconv.ParseUint(s[1:], 8, 8)
+			return value{n: int64(int8(n))}
+		}
+		return value{n: int64(s[1])}
+	}
+	return value{}
+}
@@ -0,0 +1,374 @@
+package cpp
+
+import "strings"
+
+type macro struct {
+	name     string
+	funcLike bool
+	params   []string
+	variadic bool // the last parameter receives the variable arguments
+	body     []*Token
+	builtin  func(t *Token) *Token
+	def      *Token // name in the #define, nil for builtins
+}
+
+func (pp *Preprocessor) defineBuiltin(name string, fn func(t *Token) *Token) {
+	pp.macros[name] = &macro{name: name, builtin: fn}
+}
+
+// define executes "#define toks".
+func (pp *Preprocessor) define(toks []*Token) {
+	name := toks[0]
+	if name.kind != ident {
+		pp.errorf(name, "macro name must be an identifier")
+		return
+	}
+	if name.Str == "defined" {
+		pp.errorf(name, "'defined' cannot be used as a macro name")
+		return
+	}
+	m := &macro{name: name.Str, def: name}
+	body := toks[1:]
+
+	if len(body) > 0 && body[0].is("(") && !body[0].space {
+		m.funcLike = true
+		var ok bool
+		if body, ok = pp.params(m, body); !ok {
+			return
+		}
+	}
+	for i, t := range body {
+		c := *t
+		c.bol = false
+		if i == 0 {
+			c.space = false
+		}
+		body[i] = &c
+	}
+	m.body = body
+
+	for i, t := range body {
+		if t.is("##") && (i == 0 || i == len(body)-1) {
+			pp.errorf(t, "'##' cannot appear at either end of a macro expansion")
+			return
+		}
+		if m.funcLike && t.is("#") && (i == len(body)-1 || m.param(body[i+1]) < 0) {
+			pp.errorf(t, "'#' is not followed by a macro parameter")
+			return
+		}
+	}
+
+	if prev, ok := pp.macros[m.name]; ok && !prev.same(m) {
+		d := pp.warnf(name, "'%s' macro redefined", m.name)
+		if prev.def != nil {
+			d.Notef(prev.def.Pos(), prev.def.end(), "previous definition is here")
+		}
+	}
+	pp.macros[m.name] = m
+}
+
+// params reads the parameter list of a function-like macro
+// and returns the tokens following it.
+func (pp *Preprocessor) params(m *macro, toks []*Token) ([]*Token, bool) {
+	lparen := toks[0]
+	toks = toks[1:]
+	if len(toks) > 0 && toks[0].is(")") {
+		return toks[1:], true
+	}
+	for len(toks) > 0 {
+		t := toks[0]
+		switch {
+		case t.is("..."):
+			m.params = append(m.params, "__VA_ARGS__")
+			m.variadic = true
+		case t.kind == ident:
+			for _, p := range m.params {
+				if p == t.Str {
+					pp.errorf(t, "duplicate macro parameter name '%s'", t.Str)
+					return nil, false
+				}
+			}
+			m.params = append(m.params, t.Str)
+			if len(toks) > 1 && toks[1].is("...") {
+				// GNU named variable arguments: args...
+				m.variadic = true
+				toks = toks[1:]
+			}
+		default:
+			pp.errorf(t, "invalid token in macro parameter list")
+			return nil, false
+		}
+		toks = toks[1:]
+		if len(toks) > 0 && toks[0].is(")") {
+			return toks[1:], true
+		}
+		if len(toks) == 0 || !toks[0].is(",") || m.variadic {
+			break
+		}
+		toks = toks[1:]
+	}
+	if len(toks) == 0 {
+		pp.errorf(lparen, "missing ')' in macro parameter list")
+	} else {
+		pp.errorf(toks[0], "expected comma in macro parameter list")
+	}
+	return nil, false
+}
+
+func (m *macro) param(t *Token) int {
+	if t.kind != ident {
+		return -1
+	}
+	for i, p := range m.params {
+		if p == t.Str {
+			return i
+		}
+	}
+	return -1
+}
+
+// same reports whether m and o are identical definitions, which
+// may be repeated without a warning.
+func (m *macro) same(o *macro) bool {
+	if m.builtin != nil || m.funcLike != o.funcLike || m.variadic != o.variadic ||
+		len(m.params) != len(o.params) || len(m.body) != len(o.body) {
+		return false
+	}
+	for i := range m.params {
+		if m.params[i] != o.params[i] {
+			return false
+		}
+	}
+	for i := range m.body {
+		a, b := m.body[i], o.body[i]
+		if a.Str != b.Str || (i > 0 && a.space != b.space) {
+			return false
+		}
+	}
+	return true
+}
+
+// expand replaces the macro invocation starting at t by its expansion,
+// which is then rescanned together with the rest of the input.
+// It reports false if t does not start an invocation.
+func (pp *Preprocessor) expand(t *Token) bool {
+	if t.kind != ident || t.hide[t.Str] {
+		return false
+	}
+	m := pp.macros[t.Str]
+	if m == nil {
+		return false
+	}
+	if m.builtin != nil {
+		pp.push([]*Token{m.builtin(t)})
+		return true
+	}
+	if !m.funcLike {
+		pp.push(place(pp.subst(m, nil), t, t.hide.with(m.name)))
+		return true
+	}
+
+	if next := pp.peek(); next == nil || !next.is("(") {
+		return false
+	}
+	pp.next()
+	args, rparen := pp.args(m, t)
+	if rparen == nil {
+		return true
+	}
+	hs := t.hide.intersect(rparen.hide).with(m.name)
+	pp.push(place(pp.subst(m, args), t, hs))
+	return true
+}
+
+// args reads the arguments of an invocation of m up to the closing
+// parenthesis, which is returned.
+func (pp *Preprocessor) args(m *macro, name *Token) (args [][]*Token, rparen *Token) {
+	var arg []*Token
+	depth := 0
+	for rparen == nil {
+		t := pp.peek()
+		if t == nil {
+			pp.errorf(name, "unterminated function-like macro invocation").
+				Notef(m.def.Pos(), m.def.end(), "macro '%s' defined here", m.name)
+			return nil, nil
+		}
+		pp.next()
+		switch {
+		case depth == 0 && t.is(")"):
+			args = append(args, arg)
+			rparen = t
+			continue
+		case depth == 0 && t.is(",") && !(m.variadic && len(args) == len(m.params)-1):
+			args = append(args, arg)
+			arg = nil
+			continue
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		}
+		arg = append(arg, t)
+	}
+
+	if len(m.params) == 0 && len(args) == 1 && len(args[0]) == 0 {
+		// f() passes no arguments rather than an empty one
+		args = nil
+	}
+	if m.variadic && len(args) == len(m.params)-1 {
+		args = append(args, nil)
+	}
+	if len(args) != len(m.params) {
+		few := "few"
+		if len(args) > len(m.params) {
+			few = "many"
+		}
+		pp.errorf(name, "too %s arguments provided to function-like macro invocation", few).
+			Notef(m.def.Pos(), m.def.end(), "macro '%s' defined here", m.name)
+		return nil, nil
+	}
+	return args, rparen
+}
+
+// subst returns the body of m with the parameters replaced by args.
+func (pp *Preprocessor) subst(m *macro, args [][]*Token) []*Token {
+	var out []*Token
+	expanded := map[int][]*Token{}
+	body := m.body
+	va := len(m.params) - 1
+
+	for i := 0; i < len(body); i++ {
+		t := body[i]
+
+		if m.funcLike && t.is("#") {
+			out = append(out, stringize(args[m.param(body[i+1])], t))
+			i++
+			continue
+		}
+
+		// GNU extension: in ", ## __VA_ARGS__" the comma is deleted
+		// when there are no variable arguments.
+		if m.variadic && t.is(",") && i+2 < len(body) && body[i+1].is("##") && m.param(body[i+2]) == va {
+			if len(args[va]) > 0 {
+				out = append(out, t)
+				out = append(out, args[va]...)
+			}
+			i += 2
+			continue
+		}
+
+		if t.is("##") {
+			rhs := body[i+1]
+			i++
+			var toks []*Token
+			if n := m.param(rhs); n >= 0 {
+				toks = args[n]
+			} else {
+				toks = []*Token{rhs}
+			}
+			if len(toks) == 0 {
+				continue
+			}
+			if len(out) == 0 {
+				out = append(out, toks...)
+				continue
+			}
+			out[len(out)-1] = pp.paste(out[len(out)-1], toks[0])
+			out = append(out, toks[1:]...)
+			continue
+		}
+
+		n := m.param(t)
+		if n < 0 {
+			out = append(out, t)
+			continue
+		}
+		var toks []*Token
+		if i+1 < len(body) && body[i+1].is("##") {
+			// operands of ## are not expanded
+			toks = args[n]
+		} else {
+			if _, ok := expanded[n]; !ok {
+				expanded[n] = pp.expandList(args[n])
+			}
+			toks = expanded[n]
+		}
+		for j, a := range toks {
+			c := *a
+			if j == 0 {
+				c.space = t.space
+			}
+			out = append(out, &c)
+		}
+	}
+	return out
+}
+
+// expandList fully expands toks on their own.
+func (pp *Preprocessor) expandList(toks []*Token) []*Token {
+	saved := pp.stack
+	pp.stack = []*input{{toks: toks, boundary: true}}
+	var out []*Token
+	for {
+		t := pp.next()
+		if t == nil {
+			break
+		}
+		if !pp.expand(t) {
+			out = append(out, t)
+		}
+	}
+	pp.stack = saved
+	return out
+}
+
+// place positions the expansion of a macro at its invocation at
+// and adds hs to the hidesets of its tokens.
+func place(toks []*Token, at *Token, hs hideset) []*Token {
+	out := make([]*Token, len(toks))
+	for i, t := range toks {
+		c := t.copyAt(at)
+		c.hide = t.hide.union(hs)
+		if i == 0 {
+			c.space = at.space
+		}
+		out[i] = c
+	}
+	return out
+}
+
+func stringize(arg []*Token, hash *Token) *Token {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, t := range arg {
+		if i > 0 && t.space {
+			b.WriteByte(' ')
+		}
+		if t.kind == stringConst || t.kind == charConst {
+			for j := 0; j < len(t.Str); j++ {
+				if c := t.Str[j]; c == '"' || c == '\\' {
+					b.WriteByte('\\')
+				}
+				b.WriteByte(t.Str[j])
+			}
+		} else {
+			b.WriteString(t.Str)
+		}
+	}
+	b.WriteByte('"')
+	return newToken(stringConst, b.String(), hash)
+}
+
+// paste implements ##.
+func (pp *Preprocessor) paste(l, r *Token) *Token {
+	s := l.Str + r.Str
+	toks, ok := retokenize(s)
+	if !ok || len(toks) != 1 {
+		pp.errorf(l, "pasting formed '%s', an invalid preprocessing token", s)
+		return l
+	}
+	c := *l
+	c.kind = toks[0].kind
+	c.Str = toks[0].Str
+	return &c
+}
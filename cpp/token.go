@@ -0,0 +1,304 @@
+package cpp
+
+import (
+	"gocc/diag"
+	"gocc/token"
+)
+
+type kind int
+
+const (
+	ident kind = iota
+	number
+	charConst
+	stringConst
+	punct
+	other // a character that is not part of any other token
+)
+
+// Token is a preprocessing token.
+type Token struct {
+	kind  kind
+	Str   string
+	pos   token.Position // position in src, before #line adjustments
+	src   *file
+	space bool // preceded by whitespace
+	bol   bool // first token of a line
+	hide  hideset
+}
+
+// Pos returns the position of t as seen by the compiler, i.e. after
+// the #line directives of its file were applied.
+func (t *Token) Pos() token.Position {
+	p := t.pos
+	if t.src != nil {
+		p.File = t.src.name
+		p.Line += t.src.lineDelta
+	}
+	return p
+}
+
+func (t *Token) end() token.Position {
+	p := t.Pos()
+	p.Column += len(t.Str)
+	p.Offset += len(t.Str)
+	return p
+}
+
+func (t *Token) is(s string) bool {
+	return t.kind == punct && t.Str == s
+}
+
+// copy returns a copy of t that is placed at pos, the macro invocation
+// t was expanded from.
+func (t *Token) copyAt(pos *Token) *Token {
+	c := *t
+	if pos != nil {
+		c.pos = pos.pos
+		c.src = pos.src
+	}
+	c.bol = false
+	return &c
+}
+
+// hideset is the set of macros whose expansion produced a token.
+// A macro is not expanded again inside its own expansion.
+type hideset map[string]bool
+
+func (h hideset) union(o hideset) hideset {
+	r := hideset{}
+	for k := range h {
+		r[k] = true
+	}
+	for k := range o {
+		r[k] = true
+	}
+	return r
+}
+
+func (h hideset) intersect(o hideset) hideset {
+	r := hideset{}
+	for k := range h {
+		if o[k] {
+			r[k] = true
+		}
+	}
+	return r
+}
+
+func (h hideset) with(name string) hideset {
+	return h.union(hideset{name: true})
+}
+
+// file is a source file being preprocessed.
+type file struct {
+	path      string
+	name      string // name used in positions, changed by #line
+	lineDelta int    // added to lines by #line
+	dir       int    // index of the search path the file was found in, -1 if none
+	depth     int    // include depth
+}
+
+var puncts = []string{
+	"<<=", ">>=", "...",
+	"->", "++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"*=", "/=", "%=", "+=", "-=", "&=", "^=", "|=", "##",
+}
+
+// tokenizer splits a source file into preprocessing tokens.
+type tokenizer struct {
+	src   []byte
+	pos   token.Position
+	file  *file
+	diags *diag.List
+}
+
+func (z *tokenizer) peek(n int) byte {
+	if z.pos.Offset+n >= len(z.src) {
+		return 0
+	}
+	return z.src[z.pos.Offset+n]
+}
+
+func (z *tokenizer) step() {
+	if z.src[z.pos.Offset] == '\n' {
+		z.pos.Line++
+		z.pos.Column = 1
+	} else {
+		z.pos.Column++
+	}
+	z.pos.Offset++
+}
+
+func (z *tokenizer) isEnd() bool {
+	return z.pos.Offset >= len(z.src)
+}
+
+func (z *tokenizer) errorf(pos token.Position, format string, a ...interface{}) {
+	pos.File = z.file.name
+	z.diags.Errorf(pos, token.Position{}, format, a...)
+}
+
+// skipSpace skips whitespace, comments and escaped newlines.
+// It reports whether any was skipped and whether a newline was crossed.
+func (z *tokenizer) skipSpace() (space, newline bool) {
+	for !z.isEnd() {
+		c := z.peek(0)
+		switch {
+		case c == '\n':
+			newline = true
+			z.step()
+		case c == ' ' || c == '\t' || c == '\f' || c == '\r' || c == '\v':
+			z.step()
+		case c == '\\' && z.peek(1) == '\n':
+			z.step()
+			z.step()
+		case c == '\\' && z.peek(1) == '\r' && z.peek(2) == '\n':
+			z.step()
+			z.step()
+			z.step()
+		case c == '/' && z.peek(1) == '/':
+			for !z.isEnd() && z.peek(0) != '\n' {
+				z.step()
+			}
+		case c == '/' && z.peek(1) == '*':
+			start := z.pos
+			z.step()
+			z.step()
+			for !z.isEnd() && !(z.peek(0) == '*' && z.peek(1) == '/') {
+				z.step()
+			}
+			if z.isEnd() {
+				z.errorf(start, "unterminated /* comment")
+				return true, newline
+			}
+			z.step()
+			z.step()
+		default:
+			return space, newline
+		}
+		space = true
+	}
+	return space, newline
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func (z *tokenizer) tokenize() []*Token {
+	var toks []*Token
+	bol := true
+	for {
+		space, newline := z.skipSpace()
+		if newline {
+			bol = true
+		}
+		if z.isEnd() {
+			return toks
+		}
+		t := &Token{pos: z.pos, src: z.file, space: space || bol, bol: bol}
+		bol = false
+		start := z.pos.Offset
+		c := z.peek(0)
+
+		switch {
+		case isDigit(c) || c == '.' && isDigit(z.peek(1)):
+			// pp-number
+			t.kind = number
+			z.step()
+			for {
+				c := z.peek(0)
+				if (c == '+' || c == '-') && z.pos.Offset > start && strchr("eEpP", z.src[z.pos.Offset-1]) {
+					z.step()
+				} else if isIdentChar(c) || c == '.' {
+					z.step()
+				} else {
+					break
+				}
+			}
+		case isIdentChar(c):
+			t.kind = ident
+			for isIdentChar(z.peek(0)) {
+				z.step()
+			}
+		case c == '"' || c == '\'':
+			t.kind = stringConst
+			if c == '\'' {
+				t.kind = charConst
+			}
+			z.step()
+			for z.peek(0) != c {
+				if z.isEnd() || z.peek(0) == '\n' {
+					if c == '"' {
+						z.errorf(t.pos, "missing terminating '\"' character")
+					} else {
+						z.errorf(t.pos, "missing terminating ' character")
+					}
+					break
+				}
+				if z.peek(0) == '\\' && z.pos.Offset+1 < len(z.src) {
+					z.step()
+				}
+				z.step()
+			}
+			if z.peek(0) == c {
+				z.step()
+			}
+		default:
+			t.kind = other
+			for _, p := range puncts {
+				if z.hasPrefix(p) {
+					t.kind = punct
+					for range p {
+						z.step()
+					}
+					break
+				}
+			}
+			if t.kind == other {
+				if strchr("+-*/%&|^~!=<>?:;,.()[]{}#", c) {
+					t.kind = punct
+				}
+				z.step()
+			}
+		}
+		t.Str = string(z.src[start:z.pos.Offset])
+		toks = append(toks, t)
+	}
+}
+
+func (z *tokenizer) hasPrefix(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if z.peek(i) != s[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func strchr(s string, c byte) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			return true
+		}
+	}
+	return false
+}
+
+// retokenize splits s, e.g. the result of '##', into tokens.
+// ok is false if s is not made of valid tokens.
+func retokenize(s string) (toks []*Token, ok bool) {
+	z := &tokenizer{
+		src:   []byte(s),
+		pos:   token.Position{Line: 1, Column: 1},
+		file:  &file{},
+		diags: diag.NewList(),
+	}
+	toks = z.tokenize()
+	return toks, !z.diags.HasErrors()
+}
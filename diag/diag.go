@@ -0,0 +1,109 @@
+package diag
+
+import (
+	"fmt"
+	"gocc/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		panic("undefined Severity")
+	}
+}
+
+// Note is a secondary message attached to a diagnostic,
+// e.g. pointing at a previous declaration.
+type Note struct {
+	Pos token.Position
+	End token.Position
+	Msg string
+}
+
+// Diagnostic is a message reported by the lexer, parser or gen.
+// [Pos, End) is the source range the message refers to. End may be
+// the zero Position when only a single location is known.
+type Diagnostic struct {
+	Severity Severity
+	Pos      token.Position
+	End      token.Position
+	Msg      string
+	Notes    []Note
+}
+
+func (d *Diagnostic) Error() string {
+	s := fmt.Sprintf("%d:%d: %s: %s", d.Pos.Line, d.Pos.Column, d.Severity, d.Msg)
+	if d.Pos.File != "" {
+		s = d.Pos.File + ":" + s
+	}
+	return s
+}
+
+// Notef attaches a note to the diagnostic and returns it for chaining.
+func (d *Diagnostic) Notef(pos, end token.Position, format string, a ...interface{}) *Diagnostic {
+	d.Notes = append(d.Notes, Note{Pos: pos, End: end, Msg: fmt.Sprintf(format, a...)})
+	return d
+}
+
+// List collects the diagnostics of a compilation in reporting order.
+type List struct {
+	diags []*Diagnostic
+}
+
+func NewList() *List {
+	return &List{}
+}
+
+func (l *List) add(s Severity, pos, end token.Position, msg string) *Diagnostic {
+	// the parser backtracks over tokens, so the same message may be
+	// reported more than once for one location.
+	for _, d := range l.diags {
+		if d.Severity == s && d.Pos == pos && d.Msg == msg {
+			return d
+		}
+	}
+	d := &Diagnostic{Severity: s, Pos: pos, End: end, Msg: msg}
+	l.diags = append(l.diags, d)
+	return d
+}
+
+func (l *List) Errorf(pos, end token.Position, format string, a ...interface{}) *Diagnostic {
+	return l.add(Error, pos, end, fmt.Sprintf(format, a...))
+}
+
+func (l *List) Warnf(pos, end token.Position, format string, a ...interface{}) *Diagnostic {
+	return l.add(Warning, pos, end, fmt.Sprintf(format, a...))
+}
+
+func (l *List) All() []*Diagnostic {
+	return l.diags
+}
+
+func (l *List) Len() int {
+	return len(l.diags)
+}
+
+func (l *List) ErrorCount() int {
+	n := 0
+	for _, d := range l.diags {
+		if d.Severity == Error {
+			n++
+		}
+	}
+	return n
+}
+
+func (l *List) HasErrors() bool {
+	return l.ErrorCount() > 0
+}
@@ -0,0 +1,44 @@
+package diag
+
+import (
+	"bytes"
+	"gocc/token"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	src := []byte("int main() {\n\treturn a;\n}\n")
+	l := NewList()
+	d := l.Errorf(token.Position{File: "a.c", Line: 2, Column: 9}, token.Position{File: "a.c", Line: 2, Column: 10}, "use of undeclared identifier '%s'", "a")
+	d.Notef(token.Position{File: "a.c", Line: 1, Column: 5}, token.Position{File: "a.c", Line: 1, Column: 9}, "in function 'main'")
+
+	var b bytes.Buffer
+	Fprint(&b, map[string][]byte{"a.c": src}, l)
+
+	expect := "a.c:2:9: error: use of undeclared identifier 'a'\n" +
+		"\treturn a;\n" +
+		"\t       ^\n" +
+		"a.c:1:5: note: in function 'main'\n" +
+		"int main() {\n" +
+		"    ^~~~\n"
+	if b.String() != expect {
+		t.Errorf("expected output is\n%s\nbut got\n%s", expect, b.String())
+	}
+}
+
+func TestList(t *testing.T) {
+	l := NewList()
+	pos := token.Position{Line: 1, Column: 1}
+	l.Warnf(pos, pos, "unused variable")
+	if l.HasErrors() {
+		t.Errorf("expected list has no errors")
+	}
+	l.Errorf(pos, pos, "expected ';'")
+	l.Errorf(pos, pos, "expected ';'")
+	if l.ErrorCount() != 1 {
+		t.Errorf("expected error count is %d, but got %d", 1, l.ErrorCount())
+	}
+	if l.Len() != 2 {
+		t.Errorf("expected count of diagnostics is %d, but got %d", 2, l.Len())
+	}
+}
@@ -0,0 +1,73 @@
+package diag
+
+import (
+	"bytes"
+	"fmt"
+	"gocc/token"
+	"io"
+)
+
+// Fprint renders every diagnostic of l in the form
+//
+//	file:line:col: error: message
+//	    source line
+//	    ^~~~
+//
+// followed by its notes. sources holds the contents of the files
+// the positions refer to; lines of other files are not shown.
+func Fprint(w io.Writer, sources map[string][]byte, l *List) {
+	for _, d := range l.All() {
+		Render(w, sources, d)
+	}
+}
+
+func Render(w io.Writer, sources map[string][]byte, d *Diagnostic) {
+	render(w, sources, d.Pos, d.End, d.Severity.String(), d.Msg)
+	for _, n := range d.Notes {
+		render(w, sources, n.Pos, n.End, "note", n.Msg)
+	}
+}
+
+func render(w io.Writer, sources map[string][]byte, pos, end token.Position, kind, msg string) {
+	fmt.Fprintf(w, "%s:%d:%d: %s: %s\n", pos.File, pos.Line, pos.Column, kind, msg)
+
+	line, ok := sourceLine(sources[pos.File], pos.Line)
+	if !ok {
+		return
+	}
+	fmt.Fprintf(w, "%s\n", line)
+
+	var caret []byte
+	for i := 0; i < pos.Column-1 && i < len(line); i++ {
+		if line[i] == '\t' {
+			caret = append(caret, '\t')
+		} else {
+			caret = append(caret, ' ')
+		}
+	}
+	caret = append(caret, '^')
+	if end.Line == pos.Line && end.File == pos.File {
+		for i := pos.Column + 1; i < end.Column && i <= len(line); i++ {
+			caret = append(caret, '~')
+		}
+	}
+	fmt.Fprintf(w, "%s\n", caret)
+}
+
+// sourceLine returns line n of source without its newline.
+func sourceLine(source []byte, n int) ([]byte, bool) {
+	if source == nil || n < 1 {
+		return nil, false
+	}
+	for ; n > 1; n-- {
+		i := bytes.IndexByte(source, '\n')
+		if i < 0 {
+			return nil, false
+		}
+		source = source[i+1:]
+	}
+	if i := bytes.IndexByte(source, '\n'); i >= 0 {
+		source = source[:i]
+	}
+	return bytes.TrimRight(source, "\r"), true
+}
@@ -0,0 +1,169 @@
+package gen
+
+import (
+	"fmt"
+	"gocc/ast"
+	"gocc/token"
+)
+
+// Conditions are compiled to jumps rather than to values: branch jumps
+// to a label depending on the truth of a scalar expression, evaluating
+// the operands of && and || only as far as needed.
+
+// negate returns the comparison that holds if kind does not.
+func negate(kind token.TokenKind) token.TokenKind {
+	switch kind {
+	case token.EQ:
+		return token.NE
+	case token.NE:
+		return token.EQ
+	case token.LT:
+		return token.GE
+	case token.LE:
+		return token.GT
+	case token.GT:
+		return token.LE
+	default:
+		return token.LT
+	}
+}
+
+// jcc returns the jump taken if the comparison kind of signed or
+// unsigned operands holds.
+func jcc(kind token.TokenKind, unsigned bool) Opcode {
+	switch kind {
+	case token.EQ:
+		return JE
+	case token.NE:
+		return JNE
+	case token.LT:
+		if unsigned {
+			return JB
+		}
+		return JL
+	case token.LE:
+		if unsigned {
+			return JBE
+		}
+		return JLE
+	case token.GT:
+		if unsigned {
+			return JA
+		}
+		return JG
+	case token.GE:
+		if unsigned {
+			return JAE
+		}
+		return JGE
+	}
+	panic(fmt.Sprintf("unimplemented jump token %s", kind))
+}
+
+// setcc returns the instruction setting a byte to the result of the
+// comparison kind of signed or unsigned operands.
+func setcc(kind token.TokenKind, unsigned bool) Opcode {
+	switch kind {
+	case token.EQ:
+		return SETE
+	case token.NE:
+		return SETNE
+	case token.LT:
+		if unsigned {
+			return SETB
+		}
+		return SETL
+	case token.LE:
+		if unsigned {
+			return SETBE
+		}
+		return SETLE
+	case token.GT:
+		if unsigned {
+			return SETA
+		}
+		return SETG
+	case token.GE:
+		if unsigned {
+			return SETAE
+		}
+		return SETGE
+	}
+	panic(fmt.Sprintf("unimplemented comparison token %s", kind))
+}
+
+// branch jumps to the label l if e is true and when is true, or if e is
+// false and when is false. Otherwise it falls through.
+func (gen *Gen) branch(e ast.Expr, l int, when bool) {
+	if b, ok := ast.BoolConst(e); ok {
+		if b == when {
+			gen.jmp(l)
+		}
+		return
+	}
+	switch e := e.(type) {
+	case *ast.BinaryExpr:
+		switch {
+		case isComparison(e.Op.Kind) && !cmpType(e).IsFloat():
+			kind := e.Op.Kind
+			if !when {
+				kind = negate(kind)
+			}
+			gen.binary(e)
+			gen.emitf("\t%s\t%s\n", jcc(kind, cmpType(e).Unsigned), gen.target.local(l))
+			return
+		case e.Op.Kind == token.LAND && !when, e.Op.Kind == token.LOR && when:
+			// a false operand decides &&, a true operand decides ||
+			gen.branch(e.X, l, when)
+			gen.branch(e.Y, l, when)
+			return
+		case e.Op.Kind == token.LAND, e.Op.Kind == token.LOR:
+			skip := gen.newLabel()
+			gen.branch(e.X, skip, !when)
+			gen.branch(e.Y, l, when)
+			gen.label(skip)
+			return
+		}
+	case *ast.UnaryExpr:
+		if e.Op.Kind == token.NOT {
+			gen.branch(e.Expr, l, !when)
+			return
+		}
+	}
+
+	gen.expr(e)
+	t := e.Type().Decay()
+	if t.IsFloat() {
+		gen.floatZero(t, token.NE)
+		t = ast.IntType
+	}
+	gen.emit(test(t), registerA(t), registerA(t))
+	if when {
+		gen.emitf("\t%s\t%s\n", JNE, gen.target.local(l))
+	} else {
+		gen.emitf("\t%s\t%s\n", JE, gen.target.local(l))
+	}
+}
+
+// boolValue computes the value 0 or 1 of e1 && e2 or e1 || e2 in %eax.
+func (gen *Gen) boolValue(e ast.Expr) {
+	f, end := gen.newLabel(), gen.newLabel()
+	gen.branch(e, f, false)
+	gen.emitf("\t%s\t$1, %s\n", MOVL, EAX)
+	gen.jmp(end)
+	gen.label(f)
+	gen.emit(XORL, EAX, EAX)
+	gen.label(end)
+}
+
+func (gen *Gen) condExpr(e *ast.CondExpr) {
+	els, end := gen.newLabel(), gen.newLabel()
+	gen.branch(e.Cond, els, false)
+	gen.expr(e.L)
+	gen.convert(e.L.Type(), e.Type())
+	gen.jmp(end)
+	gen.label(els)
+	gen.expr(e.R)
+	gen.convert(e.R.Type(), e.Type())
+	gen.label(end)
+}
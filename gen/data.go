@@ -0,0 +1,267 @@
+package gen
+
+import (
+	"fmt"
+	"gocc/ast"
+	"strings"
+)
+
+// Variables of static storage duration live in .data if initialized,
+// .rodata if also const, and .bss otherwise. Const objects holding
+// addresses go to .data.rel.ro instead, as the addresses are only known
+// once the dynamic linker has relocated them. They are addressed relative
+// to %rip so that the code is position independent.
+
+// staticLabel returns the label of the object of static storage duration
+// obj. Objects with linkage are named by their symbol; static locals get
+// a label of their own, as different functions may declare the same name.
+func (gen *Gen) staticLabel(obj *ast.Object) string {
+	if l, ok := gen.statics[obj]; ok {
+		return l
+	}
+	if str, ok := obj.Decl.(*ast.StringVal); ok {
+		return gen.literal(str.Val)
+	}
+	l := gen.target.symbol(obj.Name)
+	if !obj.Linkage {
+		l = fmt.Sprintf("%s.%d", l, gen.newLabel())
+	}
+	gen.statics[obj] = l
+	return l
+}
+
+// internal reports whether obj has internal linkage, being declared static
+// at file scope.
+func internal(obj *ast.Object) bool {
+	switch d := obj.Decl.(type) {
+	case *ast.FuncDef:
+		return d.Static
+	case *ast.VarDef:
+		return d.Static
+	case *ast.ArrayDef:
+		return d.Static
+	}
+	return false
+}
+
+// staticDef defines the object obj of type t initialized by init, which
+// is nil if the object is zero-initialized. A global object is visible
+// to the other object files.
+func (gen *Gen) staticDef(obj *ast.Object, t *ast.CType, init ast.Expr, global bool) {
+	l := gen.staticLabel(obj)
+	switch {
+	case init == nil:
+		gen.section(bss)
+	case readOnly(t) && relocated(t, init):
+		gen.section(relro)
+	case readOnly(t):
+		gen.section(rodata)
+	default:
+		gen.section(data)
+	}
+	if global {
+		gen.emitf("\t.globl %s\n", l)
+	}
+	gen.emitf("\t.p2align %d\n", log2(t.Align()))
+	gen.Str += gen.target.typeOf(l, "object")
+	gen.emitf("%s:\n", l)
+	if init == nil {
+		gen.emitf("\t.zero %d\n", t.Bytes())
+	} else {
+		gen.initData(t, init)
+	}
+	gen.Str += gen.target.sizeOf(l, fmt.Sprint(t.Bytes()))
+	gen.section(text)
+	gen.flushLiterals()
+}
+
+// initData emits the bytes of an object of type t initialized by e.
+func (gen *Gen) initData(t *ast.CType, e ast.Expr) {
+	switch {
+	case t.IsArray():
+		if str, ok := ast.StringInit(t, e.(*ast.ArrayInit)); ok {
+			b := []byte(string(str.Val) + "\x00")
+			if len(b) > t.Len {
+				b = b[:t.Len]
+			}
+			gen.emitf("\t.ascii %s\n", quote(b))
+			gen.zeroData(t.Len - len(b))
+			return
+		}
+		list := e.(*ast.ArrayInit).List
+		for _, x := range list {
+			gen.initData(t.Elem(), x)
+		}
+		gen.zeroData((t.Len - len(list)) * t.Elem().Bytes())
+	case t.IsStruct():
+		off := 0
+		for i, x := range e.(*ast.ArrayInit).List {
+			f := t.Struct.Fields[i]
+			gen.zeroData(f.Offset - off)
+			gen.initData(f.Type, x)
+			off = f.Offset + f.Type.Bytes()
+		}
+		gen.zeroData(t.Bytes() - off)
+	case t.Kind == ast.C_bool:
+		gen.emitf("\t.byte %d\n", gen.boolConst(e))
+	case t.IsFloat():
+		f, _ := ast.FloatConst(e)
+		gen.emitf("\t%s %#x\n", directive(t.Bytes()), floatBits(t, f))
+	default:
+		if n, ok := ast.IntConst(e); ok {
+			gen.emitf("\t%s %d\n", directive(t.Bytes()), n)
+			return
+		}
+		if f, ok := ast.FloatConst(e); ok {
+			gen.emitf("\t%s %d\n", directive(t.Bytes()), int64(f))
+			return
+		}
+		obj, off, ok := ast.AddrConst(e)
+		if !ok {
+			gen.errorf(e.Pos(), "initializer element is not a compile-time constant")
+			return
+		}
+		if obj == nil {
+			gen.emitf("\t.quad %d\n", off)
+		} else if off != 0 {
+			gen.emitf("\t.quad %s%+d\n", gen.staticLabel(obj), off)
+		} else {
+			gen.emitf("\t.quad %s\n", gen.staticLabel(obj))
+		}
+	}
+}
+
+// boolConst evaluates the constant initializer e converted to _Bool. An
+// address constant is nonzero unless it is a null pointer.
+func (gen *Gen) boolConst(e ast.Expr) int {
+	if n, ok := ast.IntConst(e); ok {
+		return ast.ConvertInt(ast.BoolType, n)
+	}
+	f, ok := ast.FloatConst(e)
+	if !ok {
+		obj, off, ok := ast.AddrConst(e)
+		if !ok {
+			gen.errorf(e.Pos(), "initializer element is not a compile-time constant")
+		}
+		if obj != nil {
+			return 1
+		}
+		return ast.ConvertInt(ast.BoolType, off)
+	}
+	if f != 0 {
+		return 1
+	}
+	return 0
+}
+
+// readOnly reports whether an object of type t is const. An array is if
+// its elements are.
+func readOnly(t *ast.CType) bool {
+	for t.IsArray() {
+		t = t.Elem()
+	}
+	return t.Const
+}
+
+// relocated reports whether the initializer e of an object of type t
+// holds the address of an object or a function.
+func relocated(t *ast.CType, e ast.Expr) bool {
+	init, ok := e.(*ast.ArrayInit)
+	switch {
+	case ok && t.IsArray():
+		if _, ok := ast.StringInit(t, init); ok {
+			return false
+		}
+		for _, x := range init.List {
+			if relocated(t.Elem(), x) {
+				return true
+			}
+		}
+	case ok:
+		for i, x := range init.List {
+			if relocated(t.Struct.Fields[i].Type, x) {
+				return true
+			}
+		}
+	case t.IsPtr():
+		obj, _, ok := ast.AddrConst(e)
+		return ok && obj != nil
+	}
+	return false
+}
+
+// literal returns the label of the string literal with the contents s.
+// Literals with the same contents share their storage.
+func (gen *Gen) literal(s []byte) string {
+	if l, ok := gen.strings[string(s)]; ok {
+		return l
+	}
+	l := gen.target.local(gen.newLabel())
+	gen.strings[string(s)] = l
+	gen.pending = append(gen.pending, string(s))
+	return l
+}
+
+// flushLiterals emits the string literals used since the last flush.
+// They are not emitted where they are used, which may be in the middle
+// of the data of another object.
+func (gen *Gen) flushLiterals() {
+	if len(gen.pending) == 0 {
+		return
+	}
+	gen.section(cstring)
+	for _, s := range gen.pending {
+		gen.emitf("%s:\n", gen.strings[s])
+		gen.emitf("\t.asciz %s\n", quote([]byte(s)))
+	}
+	gen.section(text)
+	gen.pending = nil
+}
+
+// quote returns b as an assembler string.
+func quote(b []byte) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&sb, "\\%03o", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// log2 returns the exponent of the power of two n.
+func log2(n int) int {
+	k := 0
+	for ; n > 1; n >>= 1 {
+		k++
+	}
+	return k
+}
+
+func (gen *Gen) zeroData(n int) {
+	if n > 0 {
+		gen.emitf("\t.zero %d\n", n)
+	}
+}
+
+// directive returns the data directive emitting an integer of size bytes.
+func directive(size int) string {
+	switch size {
+	case 1:
+		return ".byte"
+	case 2:
+		return ".short"
+	case 4:
+		return ".long"
+	default:
+		return ".quad"
+	}
+}
@@ -0,0 +1,202 @@
+package gen
+
+import (
+	"fmt"
+	"gocc/ast"
+	"gocc/token"
+	"math"
+)
+
+// Floating-point values are kept in %rax like integers, as the bits of
+// a float in %eax or of a double in %rax, so they are loaded, stored,
+// pushed and passed on the stack the same way. They are moved to %xmm0
+// and %xmm1 to be operated on, and to %xmm0-%xmm7 to be passed to and
+// returned from functions.
+
+// precision returns s for operations on floats and d on doubles.
+func precision(t *ast.CType, s, d Opcode) Opcode {
+	if t.Kind == ast.C_float {
+		return s
+	}
+	return d
+}
+
+// floatBits returns the bits of f converted to the floating type t.
+func floatBits(t *ast.CType, f float64) uint64 {
+	if t.Kind == ast.C_float {
+		return uint64(math.Float32bits(float32(f)))
+	}
+	return math.Float64bits(f)
+}
+
+// toXMM moves the float of type t in %rax to the vector register x.
+func (gen *Gen) toXMM(t *ast.CType, x Register) {
+	gen.emit(sized(t, MOVD, MOVQ), registerA(t), x)
+}
+
+// fromXMM moves the float of type t in the vector register x to %rax.
+func (gen *Gen) fromXMM(t *ast.CType, x Register) {
+	gen.emit(sized(t, MOVD, MOVQ), x, registerA(t))
+}
+
+// convert converts the value of type from in %rax to the type to.
+func (gen *Gen) convert(from, to *ast.CType) {
+	from, to = from.Decay(), to.Decay()
+	switch {
+	case to.Kind == ast.C_bool && from.Kind != ast.C_bool:
+		// any nonzero scalar converts to 1
+		if from.IsFloat() {
+			gen.floatZero(from, token.NE)
+			return
+		}
+		gen.emit(test(from), registerA(from), registerA(from))
+		gen.emit(SETNE, AL)
+		gen.emit(MOVZBL, AL, EAX)
+	case from.IsFloat() && to.IsFloat():
+		if from.Kind != to.Kind {
+			gen.toXMM(from, XMM0)
+			gen.emit(precision(from, CVTSS2SD, CVTSD2SS), XMM0, XMM0)
+			gen.fromXMM(to, XMM0)
+		}
+	case from.IsFloat() && to.Unsigned && to.Bytes() == 8:
+		gen.floatToULong(from)
+	case from.IsFloat():
+		// truncates toward zero; the low bits are the narrower integers
+		gen.toXMM(from, XMM0)
+		gen.emit(precision(from, CVTTSS2SIQ, CVTTSD2SIQ), XMM0, RAX)
+	case to.IsFloat():
+		gen.intToFloat(from, to)
+	default:
+		gen.extend(from, to)
+	}
+}
+
+// floatToULong converts the float of type from in %rax to an unsigned
+// long. The conversion instructions are signed, so values of 2^63 and
+// above are converted less 2^63, which is added back to the result.
+func (gen *Gen) floatToULong(from *ast.CType) {
+	big, end := gen.newLabel(), gen.newLabel()
+	gen.toXMM(from, XMM0)
+	gen.emitf("\t%s\t$%#x, %s\n", sized(from, MOVL, MOVABSQ), floatBits(from, 1<<63), registerA(from))
+	gen.toXMM(from, XMM1)
+	gen.emit(precision(from, UCOMISS, UCOMISD), XMM1, XMM0)
+	gen.emitf("\t%s\t%s\n", JAE, gen.target.local(big))
+	gen.emit(precision(from, CVTTSS2SIQ, CVTTSD2SIQ), XMM0, RAX)
+	gen.jmp(end)
+	gen.label(big)
+	gen.emit(precision(from, SUBSS, SUBSD), XMM1, XMM0)
+	gen.emit(precision(from, CVTTSS2SIQ, CVTTSD2SIQ), XMM0, RAX)
+	gen.emitf("\t%s\t$63, %s\n", BTCQ, RAX)
+	gen.label(end)
+}
+
+// intToFloat converts the integer of type from in %rax to the floating
+// type to. The conversion instructions are signed, so unsigned longs of
+// 2^63 and above are halved, keeping the lowest bit for rounding, and
+// the result is doubled.
+func (gen *Gen) intToFloat(from, to *ast.CType) {
+	cvt := precision(to, CVTSI2SSQ, CVTSI2SDQ)
+	gen.extend(from, ast.LongType)
+	if from.Unsigned && from.Bytes() == 8 {
+		big, end := gen.newLabel(), gen.newLabel()
+		gen.emit(TESTQ, RAX, RAX)
+		gen.emitf("\t%s\t%s\n", JS, gen.target.local(big))
+		gen.emit(cvt, RAX, XMM0)
+		gen.jmp(end)
+		gen.label(big)
+		gen.emit(MOVQ, RAX, RDX)
+		gen.emitf("\t%s\t$1, %s\n", SHRQ, RDX)
+		gen.emitf("\t%s\t$1, %s\n", ANDL, EAX)
+		gen.emit(ORQ, RDX, RAX)
+		gen.emit(cvt, RAX, XMM0)
+		gen.emit(precision(to, ADDSS, ADDSD), XMM0, XMM0)
+		gen.label(end)
+	} else {
+		gen.emit(cvt, RAX, XMM0)
+	}
+	gen.fromXMM(to, XMM0)
+}
+
+// floatArith computes %rax op %rcx for floats of type t. Comparisons
+// only set the flags, for floatSetcc.
+func (gen *Gen) floatArith(op *token.Token, t *ast.CType) {
+	gen.toXMM(t, XMM0)
+	gen.emit(sized(t, MOVD, MOVQ), registerC(t), XMM1)
+	switch op.Kind {
+	case token.ADD:
+		gen.emit(precision(t, ADDSS, ADDSD), XMM1, XMM0)
+	case token.SUB:
+		gen.emit(precision(t, SUBSS, SUBSD), XMM1, XMM0)
+	case token.MUL:
+		gen.emit(precision(t, MULSS, MULSD), XMM1, XMM0)
+	case token.DIV:
+		gen.emit(precision(t, DIVSS, DIVSD), XMM1, XMM0)
+	case token.LT, token.LE:
+		// x < y is compared as y > x, which is false for NaNs like ja
+		gen.emit(precision(t, UCOMISS, UCOMISD), XMM0, XMM1)
+		return
+	case token.EQ, token.NE, token.GT, token.GE:
+		gen.emit(precision(t, UCOMISS, UCOMISD), XMM1, XMM0)
+		return
+	default:
+		gen.errorTok(op, "binary operator '%s' is not supported", op.String())
+		return
+	}
+	gen.fromXMM(t, XMM0)
+}
+
+// floatSetcc sets %eax to the result of the comparison kind of the
+// floats compared by floatArith. Comparisons involving a NaN are false,
+// except !=.
+func (gen *Gen) floatSetcc(kind token.TokenKind) {
+	switch kind {
+	case token.EQ:
+		gen.emit(SETE, AL)
+		gen.emit(SETNP, CL)
+		gen.emit(ANDB, CL, AL)
+	case token.NE:
+		gen.emit(SETNE, AL)
+		gen.emit(SETP, CL)
+		gen.emit(ORB, CL, AL)
+	case token.LT, token.GT:
+		gen.emit(SETA, AL)
+	case token.LE, token.GE:
+		gen.emit(SETAE, AL)
+	default:
+		panic(fmt.Sprintf("unimplemented comparison token %s", kind))
+	}
+	gen.emit(MOVZBL, AL, EAX)
+}
+
+// floatZero sets %eax to the result of comparing the float of type t
+// in %rax to zero with kind, which is EQ or NE.
+func (gen *Gen) floatZero(t *ast.CType, kind token.TokenKind) {
+	gen.toXMM(t, XMM0)
+	gen.emit(XORPS, XMM1, XMM1)
+	gen.emit(precision(t, UCOMISS, UCOMISD), XMM1, XMM0)
+	gen.floatSetcc(kind)
+}
+
+// floatNeg negates the float of type t in %rax by flipping its sign bit.
+func (gen *Gen) floatNeg(t *ast.CType) {
+	gen.emitf("\t%s\t$%d, %s\n", sized(t, BTCL, BTCQ), t.Bytes()*8-1, registerA(t))
+}
+
+// floatIncDec adds delta to the float lvalue x and leaves its new value
+// in %rax, or its old value if postfix.
+func (gen *Gen) floatIncDec(x ast.Expr, postfix bool, delta int) {
+	t := x.Type()
+	gen.address(x)
+	gen.emit(MOVQ, RAX, RCX)
+	gen.load(t)
+	gen.toXMM(t, XMM0)
+	gen.emitf("\t%s\t$%d, %s\n", MOVQ, delta, RAX)
+	gen.emit(precision(t, CVTSI2SSQ, CVTSI2SDQ), RAX, XMM1)
+	gen.emit(precision(t, ADDSS, ADDSD), XMM0, XMM1)
+	gen.emitf("\t%s\t%s, (%s)\n", sized(t, MOVD, MOVQ), XMM1, RCX)
+	if postfix {
+		gen.fromXMM(t, XMM0)
+	} else {
+		gen.fromXMM(t, XMM1)
+	}
+}
@@ -3,33 +3,77 @@ package gen
 import (
 	"fmt"
 	"gocc/ast"
+	"gocc/diag"
 	"gocc/token"
 	"reflect"
 )
 
-// [key: var name, value: offset from ebp]
+// [key: declared object, value: offset from ebp]
 type Column struct {
 	pos int
-	ty  ast.CType
+	ty  *ast.CType
 }
 
-type Map map[string]Column
+type Map map[*ast.Object]Column
 
 type Gen struct {
-	Str string
-	pos int
-	m   Map
+	Str    string
+	pos    int // size of the stack frame allocated so far
+	m      Map
+	retPtr int // slot of the buffer for a struct returned in memory
+	depth  int // bytes pushed below the frame, to align %rsp at calls
+	fn     *ast.FuncDef
+	va     vaFrame // where the variable arguments of fn are
+	diags  *diag.List
+
+	labels    int   // number of labels allocated so far
+	ret       int   // label of the epilogue of the current function
+	breaks    []int // targets of break, innermost last
+	continues []int // targets of continue, innermost last
+	cases     map[*ast.CaseStmt]int
+	named     map[*ast.LabeledStmt]int
+
+	statics map[*ast.Object]string // labels of objects of static storage duration
+	strings map[string]string      // labels of string literals by contents
+	pending []string               // string literals not emitted yet
+
+	target *Target
 }
 
-func NewGen() *Gen {
-	return &Gen{Str: "", pos: 0, m: Map{}}
+func NewGen(target *Target) *Gen {
+	return &Gen{Str: target.prelude(), pos: 0, m: Map{}, diags: diag.NewList(), cases: map[*ast.CaseStmt]int{}, named: map[*ast.LabeledStmt]int{},
+		statics: map[*ast.Object]string{}, strings: map[string]string{}, target: target}
 }
 
-var labelCount = 0
+func (gen *Gen) Diags() *diag.List {
+	return gen.diags
+}
+
+func (gen *Gen) errorf(pos token.Position, format string, a ...interface{}) {
+	gen.diags.Errorf(pos, token.Position{}, format, a...)
+}
+
+// errorTok reports an error underlining the whole token t.
+func (gen *Gen) errorTok(t *token.Token, format string, a ...interface{}) {
+	gen.diags.Errorf(t.Pos, t.End(), format, a...)
+}
+
+// lookupTok is lookup of the object an identifier token refers to
+// that reports undefined names.
+func (gen *Gen) lookupTok(t *token.Token, obj *ast.Object) (Column, bool) {
+	col, ok := gen.lookup(obj)
+	if !ok {
+		gen.errorTok(t, "use of undeclared identifier '%s'", t.String())
+	}
+	return col, ok
+}
 
 var ARG_COUNT = 6
 
-func argsRegister(i int, t ast.CType) Register {
+// SSE_ARG_COUNT is the number of vector registers for arguments.
+var SSE_ARG_COUNT = 8
+
+func argsRegister(i int, t *ast.CType) Register {
 	switch i {
 	case 0:
 		return registerDI(t)
@@ -73,17 +117,13 @@ type Operand interface {
 
 func (r Register) Str() string { return r.String() }
 
-func (gen *Gen) add(n string, p int, ty ast.CType) {
-	gen.m[n] = Column{p, ty}
+func (gen *Gen) add(obj *ast.Object, p int, ty *ast.CType) {
+	gen.m[obj] = Column{p, ty}
 }
 
-func (gen *Gen) lookup(n string) (Column, bool) {
-	for k, v := range gen.m {
-		if k == n {
-			return v, true
-		}
-	}
-	return Column{}, false
+func (gen *Gen) lookup(obj *ast.Object) (Column, bool) {
+	col, ok := gen.m[obj]
+	return col, ok
 }
 
 func (gen *Gen) emit(c Opcode, ops ...Operand) {
@@ -101,9 +141,26 @@ func (gen *Gen) emitf(format string, a ...interface{}) {
 	gen.Str += fmt.Sprintf(format, a...)
 }
 
+func (gen *Gen) push(r Register) {
+	gen.emit(PUSH, r)
+	gen.depth += 8
+}
+
+func (gen *Gen) pop(r Register) {
+	gen.emit(POP, r)
+	gen.depth -= 8
+}
+
+// grow reserves n bytes below %rsp.
+func (gen *Gen) grow(n int) {
+	gen.emitf("\t%s\t$%d, %s\n", SUBQ, n, RSP)
+	gen.depth += n
+}
+
 func (gen *Gen) prologue() {
 	gen.emit(PUSH, RBP)
 	gen.emit(MOVQ, RSP, RBP)
+	gen.depth = 0
 }
 
 func (gen *Gen) epilogue() {
@@ -111,97 +168,246 @@ func (gen *Gen) epilogue() {
 	gen.emit(RET)
 }
 
-func (gen *Gen) emitFuncDef(n string) {
-	gen.Str += ".global _" + n + "\n"
-	gen.Str += "_" + n + ":\n"
+// newLabel allocates a local label, unique in the whole output.
+func (gen *Gen) newLabel() int {
+	gen.labels++
+	return gen.labels
+}
+
+// namedLabel returns the label of a labeled statement, which gotos may
+// refer to before it is generated.
+func (gen *Gen) namedLabel(l *ast.LabeledStmt) int {
+	if _, ok := gen.named[l]; !ok {
+		gen.named[l] = gen.newLabel()
+	}
+	return gen.named[l]
+}
+
+func (gen *Gen) label(l int) {
+	gen.emitf("%s:\n", gen.target.local(l))
+}
+
+func (gen *Gen) jmp(l int) {
+	gen.emitf("\t%s\t%s\n", JMP, gen.target.local(l))
+}
+
+func (gen *Gen) emitFuncDef(n string, global bool) {
+	sym := gen.target.symbol(n)
+	if global {
+		gen.Str += ".global " + sym + "\n"
+	}
+	gen.Str += gen.target.typeOf(sym, "function")
+	gen.Str += sym + ":\n"
+}
+
+func (gen *Gen) section(s section) {
+	gen.emitf("\t%s\n", gen.target.section(s))
 }
 
 func (gen *Gen) Generate(n ast.Node) {
 	switch v := n.(type) {
-	case ast.VarDef:
+	case *ast.VarDef:
 		gen.varDef(v)
-	case ast.ArrayDef:
+	case *ast.ArrayDef:
 		gen.arrayDef(v)
-	case ast.FuncDef:
+	case *ast.FuncDef:
 		gen.funcDef(v)
+	case *ast.TypeDecl:
+	case *ast.DeclList:
+		for _, d := range v.List {
+			gen.Generate(d)
+		}
 	case ast.Expr:
 		gen.expr(v)
 	case ast.Stmt:
 		gen.stmt(v)
 	default:
-		panic("unimplemented")
+		gen.errorf(n.Pos(), "unsupported declaration")
 	}
 }
 
-func (gen *Gen) varDef(n ast.VarDef) {
-	if n.Init != nil {
-		gen.expr(*n.Init)
+// checkType reports variable types whose size is not known yet.
+func (gen *Gen) checkType(pos token.Position, t *ast.CType) bool {
+	switch t.Kind {
+	case ast.C_ptr, ast.C_bool, ast.C_char, ast.C_short, ast.C_int, ast.C_long, ast.C_float, ast.C_double, ast.C_struct, ast.C_enum:
+		return true
+	case ast.C_array:
+		return gen.checkType(pos, t.Elem())
 	}
-	gen.pos += n.Type.Bytes()
-	gen.add(n.Token.String(), gen.pos, n.Type)
-	gen.emitf("\t%s\t$%d, %s\n", SUBQ, n.Type.Bytes(), RSP)
-	gen.emitf("\t%s\t%s, %d(%s)\n", mov(n.Type), registerA(n.Type), -gen.pos, RBP)
+	gen.errorf(pos, "variables of type '%s' are not supported", t)
+	return false
 }
 
-func (gen *Gen) arrayDef(a ast.ArrayDef) {
-	if a.Subscript == nil {
-		// e.g.) int a[] = {0, 1}
-		s := len(a.Init.List) * a.Type.Bytes()
+// alloc reserves a stack slot and returns its offset below %rbp.
+// The frame is allocated in the prologue once its size is known.
+func (gen *Gen) alloc(size, align int) int {
+	gen.pos = alignTo(gen.pos+size, align)
+	return gen.pos
+}
 
-		gen.pos += s
-		gen.add(a.Token.String(), gen.pos, a.Type)
-		gen.emitf("\t%s\t$%d, %s\n", SUBQ, s, RSP)
+func (gen *Gen) varDef(n *ast.VarDef) {
+	if n.Extern && n.Init == nil || n.Obj.Linkage && n.Obj.Decl != ast.Node(n) {
+		return // defined elsewhere
+	}
+	if !gen.checkType(n.Pos(), n.Type) {
+		return
+	}
+	if n.Obj.Static {
+		var init ast.Expr
+		if n.Init != nil {
+			init = *n.Init
+		}
+		gen.staticDef(n.Obj, n.Type, init, n.Obj.Linkage && !n.Static)
+		return
+	}
+	pos := gen.alloc(n.Type.Bytes(), n.Type.Align())
+	if n.Init == nil {
+		gen.add(n.Obj, pos, n.Type)
+		return
+	}
+	if init, ok := (*n.Init).(*ast.ArrayInit); ok {
+		gen.add(n.Obj, pos, n.Type)
+		gen.zero(pos, n.Type.Bytes()) // members without an initializer
+		gen.initAuto(-pos, n.Type, init)
+		return
+	}
+	gen.expr(*n.Init)
+	gen.convert((*n.Init).Type(), n.Type)
+	gen.add(n.Obj, pos, n.Type)
+	if n.Type.IsStruct() {
+		gen.emitf("\t%s\t%d(%s), %s\n", LEAQ, -pos, RBP, RCX)
+		gen.copy(n.Type.Bytes())
+		return
+	}
+	gen.emitf("\t%s\t%s, %d(%s)\n", mov(n.Type), registerA(n.Type), -pos, RBP)
+}
 
-		for idx, v := range a.Init.List {
-			gen.expr(v)
-			gen.emitf("\t%s\t%s, %d(%s)\n", mov(a.Type), registerA(a.Type), a.Type.Bytes()*idx-gen.pos, RBP)
+// initAuto stores the initializer e of an object of type t at off(%rbp).
+// A list has an entry for each element or member it initializes, see
+// sema; the others are expected to be zeroed already.
+func (gen *Gen) initAuto(off int, t *ast.CType, e ast.Expr) {
+	init, ok := e.(*ast.ArrayInit)
+	switch {
+	case ok && t.IsArray():
+		if str, ok := ast.StringInit(t, init); ok {
+			for i, c := range str.Val {
+				if i < t.Len && c != 0 {
+					gen.emitf("\t%s\t$%d, %d(%s)\n", MOVB, c, off+i, RBP)
+				}
+			}
+			return
 		}
-	} else {
-		// e.g.) int a[5]
-		i, ok := (*a.Subscript).(ast.IntVal)
-		if !ok {
-			panic("subscript is not intVal")
+		for i, x := range init.List {
+			gen.initAuto(off+i*t.Elem().Bytes(), t.Elem(), x)
 		}
-		s := i.Num * a.Type.Bytes()
-
-		gen.pos += s
-		gen.add(a.Token.String(), gen.pos, a.Type)
-		gen.emitf("\t%s\t$%d, %s\n", SUBQ, s, RSP)
+	case ok:
+		for i, x := range init.List {
+			f := t.Struct.Fields[i]
+			gen.initAuto(off+f.Offset, f.Type, x)
+		}
+	default:
+		gen.expr(e)
+		gen.convert(e.Type(), t)
+		gen.emitf("\t%s\t%d(%s), %s\n", LEAQ, off, RBP, RCX)
+		gen.store(t)
+	}
+}
 
-		if a.Init != nil {
-			for idx, v := range a.Init.List {
-				gen.expr(v)
-				gen.emitf("\t%s\t%s, %d(%s)\n", mov(a.Type), registerA(a.Type), a.Type.Bytes()*idx-gen.pos, RBP)
-			}
+func (gen *Gen) arrayDef(a *ast.ArrayDef) {
+	elem := a.Type.Elem()
+	if !gen.checkType(a.Pos(), elem) {
+		return
+	}
+	if a.Extern && a.Init == nil || a.Obj.Linkage && a.Obj.Decl != ast.Node(a) {
+		return // defined elsewhere
+	}
+	if a.Type.Len < 0 {
+		gen.errorf((*a.Subscript).Pos(), "array size must be an integer constant")
+		return
+	}
+	if a.Obj.Static {
+		global := a.Obj.Linkage && !a.Static
+		if a.Init == nil {
+			gen.staticDef(a.Obj, a.Type, nil, global)
+		} else {
+			gen.staticDef(a.Obj, a.Type, a.Init, global)
 		}
+		return
+	}
+
+	pos := gen.alloc(a.Type.Bytes(), a.Type.Align())
+	gen.add(a.Obj, pos, a.Type)
+	if a.Init != nil {
+		gen.zero(pos, a.Type.Bytes()) // elements without an initializer
+		gen.initAuto(-pos, a.Type, a.Init)
 	}
 }
 
-func (gen *Gen) argDef(a ast.FuncArg) {
-	gen.pos += a.Type.Bytes()
-	gen.add(a.Name.String(), gen.pos, a.Type)
-	gen.emitf("\t%s\t$%d, %s\n", SUBQ, a.Type.Bytes(), RSP)
+// argDefs stores the arguments passed in registers to the stack.
+// Arguments passed on the stack are used in place, at positive offsets
+// from %rbp. It returns the numbers of general purpose and vector
+// registers taken and the offset following the stack arguments.
+func (gen *Gen) argDefs(v *ast.FuncDef) (int, int, int) {
+	gp, fp := 0, 0
+	stack := 16 // offset of the first stack argument
+	if inMemory(v.Type.Base) {
+		gen.retPtr = gen.alloc(8, 8)
+		gen.emitf("\t%s\t%s, %d(%s)\n", MOVQ, RDI, -gen.retPtr, RBP)
+		gp++
+	}
+	for _, arg := range v.Args {
+		t := arg.Type
+		if !gen.checkType(arg.Pos(), t) {
+			continue
+		}
+		cs := classify(t)
+		if cs == nil || gp+count(cs, INTEGER) > ARG_COUNT || fp+count(cs, SSE) > SSE_ARG_COUNT {
+			gen.add(arg.Obj, -stack, t)
+			stack += alignTo(t.Bytes(), 8)
+			continue
+		}
+		pos := gen.alloc(t.Bytes(), t.Align())
+		gen.add(arg.Obj, pos, t)
+		switch {
+		case t.IsStruct():
+			gen.emitf("\t%s\t%d(%s), %s\n", LEAQ, -pos, RBP, RAX)
+			for i, c := range cs {
+				if c == SSE {
+					gen.storeSSE(xmm(fp), RAX, i, t.Bytes())
+					fp++
+				} else {
+					gen.storeEightbyte(argRegister(gp), RAX, i, t.Bytes())
+					gp++
+				}
+			}
+		case t.IsFloat():
+			gen.emitf("\t%s\t%s, %d(%s)\n", sized(t, MOVD, MOVQ), xmm(fp), -pos, RBP)
+			fp++
+		default:
+			gen.emitf("\t%s\t%s, %d(%s)\n", mov(t), argsRegister(gp, t), -pos, RBP)
+			gp++
+		}
+	}
+	return gp, fp, stack
 }
 
-func (gen *Gen) funcDef(v ast.FuncDef) {
+func (gen *Gen) funcDef(v *ast.FuncDef) {
+	if v.Block == nil {
+		return // declared only
+	}
 	gen.pos = 0
 	gen.m = Map{}
+	gen.fn = v
 
-	gen.emitFuncDef(v.Name)
+	gen.ret = gen.newLabel()
+
+	gen.emitFuncDef(v.Name, !v.Static)
 	gen.prologue()
+	start := len(gen.Str)
 
-	for i, arg := range v.Args {
-		gen.argDef(arg)
-		if col, ok := gen.lookup(arg.Name.String()); ok {
-			if i < ARG_COUNT {
-				gen.emitf("\t%s\t%s, %d(%s)\n", mov(arg.Type), argsRegister(i, arg.Type), -col.pos, RBP)
-			} else {
-				gen.emitf("\t%s\t%d(%s), %s\n", MOVL, (i-ARG_COUNT+1)*8+8, RBP, EAX)
-				gen.emitf("\t%s\t%s, %d(%s)\n", MOVL, EAX, -col.pos, RBP)
-			}
-		} else {
-			panic("ident is not defined")
-		}
+	gp, fp, stack := gen.argDefs(v)
+	if v.Type.Variadic {
+		gen.saveArgs(gp, fp, stack)
 	}
 
 	count := -1
@@ -215,278 +421,743 @@ func (gen *Gen) funcDef(v ast.FuncDef) {
 		gen.emit(XORL, EAX, EAX)
 	}
 
+	gen.label(gen.ret)
 	gen.epilogue()
+
+	if frame := alignTo(gen.pos, 16); frame > 0 {
+		body := gen.Str[start:]
+		gen.Str = gen.Str[:start]
+		gen.emitf("\t%s\t$%d, %s\n", SUBQ, frame, RSP)
+		gen.Str += body
+	}
+	sym := gen.target.symbol(v.Name)
+	gen.Str += gen.target.sizeOf(sym, ".-"+sym)
+	gen.flushLiterals()
 }
 
 func (gen *Gen) expr(e ast.Expr) {
+	if gen.fold(e) {
+		return
+	}
 	switch v := e.(type) {
-	case ast.BinaryExpr:
-		gen.binary(v)
-	case ast.Ident:
-		if col, ok := gen.lookup(v.Token.String()); ok {
-			if col.ty.Array {
+	case *ast.BinaryExpr:
+		switch {
+		case v.Op.Kind == token.LAND || v.Op.Kind == token.LOR:
+			gen.boolValue(v)
+		case isComparison(v.Op.Kind) && cmpType(v).IsFloat():
+			gen.binary(v)
+			gen.floatSetcc(v.Op.Kind)
+		case isComparison(v.Op.Kind):
+			gen.binary(v)
+			gen.emit(setcc(v.Op.Kind, cmpType(v).Unsigned), AL)
+			gen.emit(MOVZBL, AL, EAX)
+		default:
+			gen.binary(v)
+		}
+	case *ast.CondExpr:
+		gen.condExpr(v)
+	case *ast.Ident:
+		if v.Obj != nil && (v.Obj.Static || v.Obj.Kind == ast.FuncObj) {
+			gen.address(v)
+			gen.load(v.Type())
+		} else if col, ok := gen.lookupTok(v.Token, v.Obj); ok {
+			if col.ty.IsArray() || col.ty.IsStruct() {
 				gen.emitf("\t%s \t%d(%s), %s\n", LEAQ, -col.pos, RBP, RAX)
 			} else {
 				gen.emitf("\t%s \t%d(%s), %s\n", mov(col.ty), -col.pos, RBP, registerA(col.ty))
 			}
-		} else {
-			panic("ident is not defined")
 		}
-	case ast.IntVal:
-		gen.emit(MOVL, v, EAX)
-	case ast.CharVal:
-		gen.emit(MOVB, v, AL)
-	case ast.FuncCall:
+	case *ast.StringVal:
+		gen.address(v)
+	case *ast.FuncCall:
 		gen.funcCall(v)
-	case ast.UnaryExpr:
+	case *ast.UnaryExpr:
 		gen.unaryExpr(v)
-	case ast.PtrVal:
-		gen.pointerVal(v)
-	case ast.AddressVal:
-		gen.addressVal(v)
-	case ast.AssignExpr:
+	case *ast.PtrVal, *ast.SubscriptExpr, *ast.MemberExpr:
+		gen.address(v)
+		gen.load(v.Type())
+	case *ast.AddressVal:
+		gen.address(v.X)
+	case *ast.AssignExpr:
 		gen.assignExpr(v)
-	case ast.SubscriptExpr:
-		gen.subscriptExpr(v)
-	case ast.IncExpr:
-		if col, ok := gen.lookup(v.Ident.Token.String()); ok {
-			if col.ty.Ptr {
-				gen.emitf("\t%s\t$%d, %d(%s)\n", ADDQ, col.ty.Primitive.Bytes(), -col.pos, RBP)
-			} else {
-				gen.emitf("\t%s\t%s, %d(%s)\n", ADDL, "$1", -col.pos, RBP)
-			}
-		} else {
-			panic("ident is not defined")
+	case *ast.IncExpr:
+		gen.incDec(v.X, v.Postfix, true)
+	case *ast.DecExpr:
+		gen.incDec(v.X, v.Postfix, false)
+	case *ast.CastExpr:
+		gen.expr(v.X)
+		if !v.To.IsVoid() {
+			gen.convert(v.X.Type(), v.To)
 		}
-	case ast.DecExpr:
-		if col, ok := gen.lookup(v.Ident.Token.String()); ok {
-			if col.ty.Ptr {
-				gen.emitf("\t%s\t%s, %d(%s)\n", SUBQ, "$8", -col.pos, RBP)
-			} else {
-				gen.emitf("\t%s\t%s, %d(%s)\n", SUBL, "$1", -col.pos, RBP)
-			}
-		} else {
-			panic("ident is not defined")
+	case *ast.VaStartExpr:
+		gen.vaStart(v)
+	case *ast.VaArgExpr:
+		gen.vaArg(v)
+	default:
+		gen.errorf(e.Pos(), "unsupported expression %s", reflect.TypeOf(e).Name())
+	}
+}
+
+// fold loads the value of e if it is a constant expression, so that
+// no arithmetic is done at run time on constants, literals included.
+func (gen *Gen) fold(e ast.Expr) bool {
+	t := e.Type()
+	switch {
+	case t.IsInteger():
+		n, ok := ast.IntConst(e)
+		if !ok {
+			n, ok = undefinedConst(e)
+		}
+		if !ok {
+			return false
+		}
+		switch {
+		case t.Bytes() <= 4:
+			gen.emitf("\t%s\t$%d, %s\n", MOVL, n, EAX)
+		case n == int(int32(n)):
+			gen.emitf("\t%s\t$%d, %s\n", MOVQ, n, RAX) // sign extends the immediate
+		default:
+			gen.emitf("\t%s\t$%d, %s\n", MOVABSQ, n, RAX)
+		}
+		return true
+	case t.IsFloat():
+		f, ok := ast.FloatConst(e)
+		if !ok {
+			return false
 		}
+		gen.emitf("\t%s\t$%#x, %s\n", sized(t, MOVL, MOVABSQ), floatBits(t, f), registerA(t))
+		return true
+	}
+	return false
+}
+
+// incDec increments or decrements the lvalue x and leaves its new value
+// in %rax, or its old value if postfix.
+func (gen *Gen) incDec(x ast.Expr, postfix, inc bool) {
+	t := x.Type()
+	delta := 1
+	if t.IsPtr() {
+		delta = t.Elem().Bytes()
+	}
+	if !inc {
+		delta = -delta
+	}
+	if t.IsFloat() {
+		gen.floatIncDec(x, postfix, delta)
+		return
+	}
+
+	gen.address(x)
+	gen.emit(MOVQ, RAX, RCX)
+	if postfix {
+		gen.emitf("\t%s\t(%s), %s\n", mov(t), RCX, registerA(t))
+	}
+	switch {
+	case t.Kind == ast.C_bool && inc:
+		gen.emitf("\t%s\t$1, (%s)\n", MOVB, RCX)
+	case t.Kind == ast.C_bool:
+		gen.emitf("\t%s\t$1, (%s)\n", XORB, RCX) // 0 - 1 converts to 1
 	default:
-		panic(fmt.Sprintf("unimplemented expr type: %s", reflect.TypeOf(e)))
+		gen.emitf("\t%s\t$%d, (%s)\n", add(t), delta, RCX)
+	}
+	if !postfix {
+		gen.emitf("\t%s\t(%s), %s\n", mov(t), RCX, registerA(t))
 	}
 }
 
 func (gen *Gen) stmt(e ast.Stmt) {
 	switch v := e.(type) {
-	case ast.ExprStmt:
-		gen.expr(v.Expr)
-	case ast.ReturnStmt:
+	case *ast.BlockStmt:
+		gen.blockStmt(v)
+	case *ast.ExprStmt:
 		gen.expr(v.Expr)
-	case ast.IfStmt:
+	case *ast.ReturnStmt:
+		if v.Expr != nil {
+			gen.expr(v.Expr)
+			ret := gen.fn.Type.Base
+			if t := v.Expr.Type(); t.IsStruct() {
+				gen.returnStruct(t)
+			} else {
+				gen.convert(t, ret)
+			}
+			if ret.IsFloat() {
+				gen.toXMM(ret, XMM0)
+			}
+		}
+		gen.jmp(gen.ret)
+	case *ast.IfStmt:
 		gen.ifStmt(v)
-	case ast.ForStmt:
+	case *ast.ForStmt:
 		gen.forStmt(v)
+	case *ast.WhileStmt:
+		gen.whileStmt(v)
+	case *ast.DoWhileStmt:
+		gen.doWhileStmt(v)
+	case *ast.SwitchStmt:
+		gen.switchStmt(v)
+	case *ast.CaseStmt:
+		gen.label(gen.cases[v])
+		gen.stmt(v.Stmt)
+	case *ast.LabeledStmt:
+		gen.label(gen.namedLabel(v))
+		gen.stmt(v.Stmt)
+	case *ast.GotoStmt:
+		gen.jmp(gen.namedLabel(v.Target))
+	case *ast.BreakStmt:
+		gen.jmp(gen.breaks[len(gen.breaks)-1])
+	case *ast.ContinueStmt:
+		gen.jmp(gen.continues[len(gen.continues)-1])
 	}
 }
 
-func (gen *Gen) blockStmt(b ast.BlockStmt) {
+func (gen *Gen) blockStmt(b *ast.BlockStmt) {
 	for _, n := range b.Nodes {
 		gen.Generate(n)
 	}
 }
 
-func (gen *Gen) ifStmt(v ast.IfStmt) {
-	if e := v.Expr; e != nil { // if (...) { ... }
-		switch e := (*v.Expr).(type) {
-		case ast.BinaryExpr:
-			gen.binary(e)
-
-			gen.invertJump(e.Op.Kind, labelCount)
+func (gen *Gen) ifStmt(v *ast.IfStmt) {
+	if v.Expr == nil { // else { ... }
+		gen.blockStmt(v.Block)
+		return
+	}
 
-			gen.blockStmt(v.Block)
-			if v.Else != nil {
-				gen.emitf("\t%s\t.L%d\n", JMP, labelCount+1)
-			}
+	els := gen.newLabel()
+	gen.branch(*v.Expr, els, false)
+	gen.blockStmt(v.Block)
+	if v.Else == nil {
+		gen.label(els)
+		return
+	}
 
-			gen.emitf(".L%d:\n", labelCount)
-			labelCount++
+	end := gen.newLabel()
+	gen.jmp(end)
+	gen.label(els)
+	gen.ifStmt(v.Else)
+	gen.label(end)
+}
 
-			if el := v.Else; el != nil {
-				gen.ifStmt(*el)
-			}
-		case ast.IntVal:
-			panic("unimplemented if ast.IntVal")
-		default:
-			panic("unimplemented if expr type")
-		}
-	} else { // else { ... }
-		gen.blockStmt(v.Block)
-		gen.emitf(".L%d:\n", labelCount)
-	}
+// loop generates the body of a loop in which break jumps to brk and
+// continue jumps to cont.
+func (gen *Gen) loop(b ast.Stmt, brk, cont int) {
+	gen.breaks = append(gen.breaks, brk)
+	gen.continues = append(gen.continues, cont)
+	gen.stmt(b)
+	gen.breaks = gen.breaks[:len(gen.breaks)-1]
+	gen.continues = gen.continues[:len(gen.continues)-1]
 }
 
-func (gen *Gen) forStmt(v ast.ForStmt) {
+func (gen *Gen) forStmt(v *ast.ForStmt) {
+	body, cont, cond, brk := gen.newLabel(), gen.newLabel(), gen.newLabel(), gen.newLabel()
+
 	if v.E1 != nil {
 		gen.Generate(v.E1)
 	}
-	gen.emitf("\t%s\t.L%d\n", JMP, labelCount)
-	gen.emitf(".L%d:\n", labelCount+1)
-	gen.blockStmt(v.Block)
+	gen.jmp(cond)
+	gen.label(body)
+	gen.loop(v.Block, brk, cont)
+	gen.label(cont)
 	if v.E3 != nil {
 		gen.expr(*v.E3)
 	}
-	gen.emitf(".L%d:\n", labelCount)
+	gen.label(cond)
 	if v.E2 != nil {
-		gen.expr(*v.E2)
-		if b, ok := (*v.E2).(ast.BinaryExpr); ok {
-			gen.jump(b.Op.Kind, labelCount+1)
-		}
+		gen.branch(*v.E2, body, true)
+	} else {
+		gen.jmp(body)
 	}
-	labelCount += 2
+	gen.label(brk)
 }
 
-func (gen *Gen) jump(kind token.TokenKind, label int) {
-	var op Opcode
-	switch kind {
-	case token.NE:
-		op = JNE
-	case token.EQ:
-		op = JE
-	case token.LT:
-		op = JL
-	case token.LE:
-		op = JLE
-	case token.GT:
-		op = JG
-	case token.GE:
-		op = JGE
+func (gen *Gen) whileStmt(v *ast.WhileStmt) {
+	body, cond, brk := gen.newLabel(), gen.newLabel(), gen.newLabel()
+
+	gen.jmp(cond)
+	gen.label(body)
+	gen.loop(v.Body, brk, cond)
+	gen.label(cond)
+	gen.branch(v.Cond, body, true)
+	gen.label(brk)
+}
+
+func (gen *Gen) doWhileStmt(v *ast.DoWhileStmt) {
+	body, cond, brk := gen.newLabel(), gen.newLabel(), gen.newLabel()
+
+	gen.label(body)
+	gen.loop(v.Body, brk, cond)
+	gen.label(cond)
+	gen.branch(v.Cond, body, true)
+	gen.label(brk)
+}
+
+// undefinedConst evaluates the division or shift e of integer constants
+// whose result C leaves undefined, as in 5 % 0 or 1 << -1, which sema
+// warns about. It gets the result ast.IntOp gives it instead of trapping
+// or depending on the machine at run time.
+func undefinedConst(e ast.Expr) (int, bool) {
+	b, ok := e.(*ast.BinaryExpr)
+	if !ok {
+		return 0, false
+	}
+	op, t := b.Op.Kind, b.Type()
+	x, okx := ast.IntConst(b.X)
+	y, oky := ast.IntConst(b.Y)
+	if !okx || !oky {
+		return 0, false
+	}
+	switch op {
+	case token.DIV, token.REM:
+		y = ast.ConvertInt(t, y)
+	case token.LSHIFT, token.RSHIFT:
 	default:
-		panic(fmt.Sprintf("unimplemented jump token %s", kind))
+		return 0, false
 	}
-	gen.emitf("\t%s\t.L%d\n", op, label)
+	n, _ := ast.IntOp(op, t, ast.ConvertInt(t, x), y)
+	return n, true
 }
 
-func (gen *Gen) invertJump(kind token.TokenKind, label int) {
-	var op Opcode
+func isComparison(kind token.TokenKind) bool {
 	switch kind {
-	case token.NE:
-		op = JE
-	case token.EQ:
-		op = JNE
-	case token.LT:
-		op = JLE
-	case token.LE:
-		op = JL
-	case token.GT:
-		op = JGE
-	case token.GE:
-		op = JG
+	case token.EQ, token.NE, token.LT, token.LE, token.GT, token.GE:
+		return true
 	default:
-		panic(fmt.Sprintf("unimplemented jump token %s", kind))
+		return false
 	}
-	gen.emitf("\t%s\t.L%d\n", op, label)
 }
 
-func (gen *Gen) binary(e ast.BinaryExpr) {
-	gen.expr(e.X)
-	gen.emit(PUSH, RAX)
+// cmpType returns the type in which the operands of a comparison are
+// compared. Pointers compare as unsigned addresses.
+func cmpType(e *ast.BinaryExpr) *ast.CType {
+	x, y := e.X.Type().Decay(), e.Y.Type().Decay()
+	if x.IsPtr() || y.IsPtr() {
+		return ast.ULongType
+	}
+	return ast.UsualArith(x, y)
+}
 
+// binary computes X op Y in %eax or %rax. Comparisons only set the flags.
+func (gen *Gen) binary(e *ast.BinaryExpr) {
+	t := e.Type()
+	if isComparison(e.Op.Kind) {
+		t = cmpType(e)
+	}
+
+	gen.expr(e.X)
+	gen.convert(e.X.Type(), t)
+	gen.push(RAX)
 	gen.expr(e.Y)
-	gen.emit(MOVL, EAX, EBX)
+	gen.convert(e.Y.Type(), t)
+	gen.emit(MOVQ, RAX, RCX)
+	gen.pop(RAX)
 
-	gen.emit(POP, RAX)
+	// pointer arithmetic counts in elements
+	x, y := e.X.Type().Decay(), e.Y.Type().Decay()
+	switch {
+	case isComparison(e.Op.Kind):
+	case x.IsPtr() && y.IsPtr():
+		gen.arith(e.Op, t)
+		if size := x.Elem().Bytes(); size != 1 {
+			gen.emitf("\t%s\t$%d, %s\n", MOVQ, size, RCX)
+			gen.emit(CQTO)
+			gen.emit(IDIV, RCX)
+		}
+		return
+	case x.IsPtr():
+		gen.scale(RCX, x.Elem().Bytes())
+	case y.IsPtr():
+		gen.scale(RAX, y.Elem().Bytes())
+	}
+	gen.arith(e.Op, t)
+}
 
-	switch e.Op.Kind {
+// scale multiplies the index in r by the size of an element.
+func (gen *Gen) scale(r Register, size int) {
+	if size != 1 {
+		gen.emitf("\t%s\t$%d, %s\n", IMUL, size, r)
+	}
+}
+
+// arith computes %eax op %ecx, or %rax op %rcx, for operands of type t.
+func (gen *Gen) arith(op *token.Token, t *ast.CType) {
+	if t.IsFloat() {
+		gen.floatArith(op, t)
+		return
+	}
+	a, c := registerA(t), registerC(t)
+	switch op.Kind {
 	case token.ADD:
-		gen.emit(ADDL, EBX, EAX)
+		gen.emit(sized(t, ADDL, ADDQ), c, a)
 	case token.SUB:
-		gen.emit(SUBL, EBX, EAX)
+		gen.emit(sized(t, SUBL, SUBQ), c, a)
 	case token.MUL:
-		gen.emit(IMUL, EBX, EAX)
+		gen.emit(IMUL, c, a)
 	case token.DIV, token.REM:
-		gen.emit(CLTD)
-		gen.emit(IDIV, EBX)
-		if e.Op.Kind == token.REM {
-			gen.emit(MOVL, EDX, EAX)
+		if t.Unsigned {
+			gen.emit(XORL, EDX, EDX)
+			gen.emit(DIV, c)
+		} else {
+			gen.emit(sized(t, CLTD, CQTO))
+			gen.emit(IDIV, c)
+		}
+		if op.Kind == token.REM {
+			gen.emit(mov(t), registerD(t), a)
+		}
+	case token.AND:
+		gen.emit(sized(t, ANDL, ANDQ), c, a)
+	case token.OR:
+		gen.emit(sized(t, ORL, ORQ), c, a)
+	case token.XOR:
+		gen.emit(sized(t, XORL, XORQ), c, a)
+	case token.LSHIFT:
+		gen.emit(sized(t, SHLL, SHLQ), CL, a)
+	case token.RSHIFT:
+		if t.Unsigned {
+			gen.emit(sized(t, SHRL, SHRQ), CL, a)
+		} else {
+			gen.emit(sized(t, SARL, SARQ), CL, a)
 		}
 	case token.EQ, token.NE, token.LT, token.LE, token.GT, token.GE:
-		gen.emit(CMPL, EBX, EAX)
+		gen.emit(sized(t, CMPL, CMPQ), c, a)
 	default:
-		panic("unimplemented binary op")
+		gen.errorTok(op, "binary operator '%s' is not supported", op.String())
 	}
 }
 
-func (gen *Gen) funcCall(e ast.FuncCall) {
-	for i := len(e.Args) - 1; i >= 0; i-- {
-		gen.expr(e.Args[i])
-		if i > ARG_COUNT-1 {
-			gen.emit(PUSH, RAX)
+// funcCall calls a function by name, or through a pointer kept in %r10.
+func (gen *Gen) funcCall(e *ast.FuncCall) {
+	ret := e.Type()
+	ft := e.Func.Type().Decay().Base
+	params := ft.Params
+
+	// assign the arguments to registers, the rest goes on the stack
+	var regs, stack []int
+	var dests []Register // registers of the eightbytes of regs in order
+	gp, fp, size := 0, 0, 0
+	if inMemory(ret) {
+		gp++ // %rdi holds the address of the result
+	}
+	for i, a := range e.Args {
+		t := argType(a, params, i)
+		cs := classify(t)
+		if cs == nil || gp+count(cs, INTEGER) > ARG_COUNT || fp+count(cs, SSE) > SSE_ARG_COUNT {
+			stack = append(stack, i)
+			size += alignTo(t.Bytes(), 8)
+			continue
+		}
+		regs = append(regs, i)
+		for _, c := range cs {
+			if c == SSE {
+				dests = append(dests, xmm(fp))
+				fp++
+			} else {
+				dests = append(dests, argsRegisterPtr(gp))
+				gp++
+			}
+		}
+	}
+
+	// %rsp must be 16-byte aligned at the call, once the stack
+	// arguments are pushed
+	if pad := alignTo(gen.depth+size, 16) - gen.depth - size; pad > 0 {
+		gen.grow(pad)
+		size += pad
+	}
+	for k := len(stack) - 1; k >= 0; k-- {
+		i := stack[k]
+		gen.arg(e.Args[i], params, i)
+		if t := e.Args[i].Type(); t.IsStruct() {
+			gen.grow(alignTo(t.Bytes(), 8))
+			gen.emit(MOVQ, RSP, RCX)
+			gen.copy(t.Bytes())
+		} else {
+			gen.push(RAX)
+		}
+	}
+
+	// push the register arguments and pop them into place once all are
+	// evaluated
+	for k := len(regs) - 1; k >= 0; k-- {
+		i := regs[k]
+		gen.arg(e.Args[i], params, i)
+		if t := e.Args[i].Type(); t.IsStruct() {
+			for j := eightbytes(t) - 1; j >= 0; j-- {
+				gen.loadEightbyte(registerD, RAX, j, t.Bytes())
+				gen.push(RDX)
+			}
 		} else {
-			gen.emit(MOVQ, RAX, argsRegisterPtr(i))
+			gen.push(RAX)
 		}
 	}
-	gen.emit(CALL, e.Ident)
+	fn := calledFunc(e.Func)
+	if fn == nil {
+		// the arguments are on the stack, so no register needs saving
+		gen.expr(e.Func)
+		gen.emit(MOVQ, RAX, R10)
+	}
+	for _, r := range dests {
+		if r >= XMM0 {
+			gen.pop(RAX)
+			gen.emit(MOVQ, RAX, r)
+		} else {
+			gen.pop(r)
+		}
+	}
+
+	var tmp int
+	if ret.IsStruct() {
+		tmp = gen.alloc(ret.Bytes(), ret.Align())
+	}
+	if inMemory(ret) {
+		gen.emitf("\t%s\t%d(%s), %s\n", LEAQ, -tmp, RBP, RDI)
+	}
+	if ft.Variadic || ft.NoProto {
+		// %al holds the number of vector registers used by the arguments
+		gen.emitf("\t%s\t$%d, %s\n", MOVL, fp, EAX)
+	}
+	if fn != nil {
+		sym := gen.target.symbol(fn.Name)
+		gen.emitf("\t%s\t%s\n", CALL, gen.target.call(sym, internal(fn)))
+	} else {
+		gen.emitf("\t%s\t*%s\n", CALL, R10)
+	}
+	if size > 0 {
+		gen.emitf("\t%s\t$%d, %s\n", ADDQ, size, RSP)
+		gen.depth -= size
+	}
+
+	switch {
+	case ret.IsFloat():
+		gen.fromXMM(ret, XMM0)
+	case ret.IsStruct() && !inMemory(ret):
+		// store the eightbytes returned in %rax and %rdx, or in %xmm0
+		// and %xmm1
+		gen.emitf("\t%s\t%d(%s), %s\n", LEAQ, -tmp, RBP, RCX)
+		gp, fp := 0, 0
+		for i, c := range classify(ret) {
+			if c == SSE {
+				gen.storeSSE(xmm(fp), RCX, i, ret.Bytes())
+				fp++
+			} else {
+				gen.storeEightbyte(retRegisters[gp], RCX, i, ret.Bytes())
+				gp++
+			}
+		}
+		gen.emit(MOVQ, RCX, RAX)
+	}
 }
 
-func (gen *Gen) unaryExpr(e ast.UnaryExpr) {
-	panic("gen.unaryExpr")
+// calledFunc returns the function called by name in a call of e, or nil
+// for a call through a pointer.
+func calledFunc(e ast.Expr) *ast.Object {
+	if id, ok := e.(*ast.Ident); ok && id.Obj != nil && id.Obj.Kind == ast.FuncObj {
+		return id.Obj
+	}
+	return nil
 }
 
-func (gen *Gen) assignExpr(e ast.AssignExpr) {
+func (gen *Gen) unaryExpr(e *ast.UnaryExpr) {
+	gen.expr(e.Expr)
+	t := e.Type()
+	switch e.Op.Kind {
+	case token.ADD:
+		gen.convert(e.Expr.Type(), t)
+	case token.SUB:
+		gen.convert(e.Expr.Type(), t)
+		if t.IsFloat() {
+			gen.floatNeg(t)
+		} else {
+			gen.emit(sized(t, NEGL, NEGQ), registerA(t))
+		}
+	case token.TILDE:
+		gen.convert(e.Expr.Type(), t)
+		gen.emit(sized(t, NOTL, NOTQ), registerA(t))
+	case token.NOT:
+		x := e.Expr.Type().Decay()
+		if x.IsFloat() {
+			gen.floatZero(x, token.EQ)
+			return
+		}
+		gen.emit(test(x), registerA(x), registerA(x))
+		gen.emit(SETE, AL)
+		gen.emit(MOVZBL, AL, EAX)
+	}
+}
+
+func (gen *Gen) assignExpr(e *ast.AssignExpr) {
+	if e.Op.Kind != token.ASSIGN {
+		gen.compoundAssign(e)
+		return
+	}
 	gen.expr(e.R)
+	gen.convert(e.R.Type(), e.L.Type())
+	gen.push(RAX)
+	gen.address(e.L)
+	gen.emit(MOVQ, RAX, RCX)
+	gen.pop(RAX)
+	gen.store(e.L.Type())
+}
 
-	switch v := e.L.(type) {
-	case ast.PtrVal:
-		if col, ok := gen.lookup(v.Token.String()); ok {
-			gen.emitf("\t%s\t%d(%s), %s\n", mov(col.ty), -col.pos, RBP, registerB(col.ty))
-		} else {
-			panic("ident is not defined")
-		}
-		gen.emitf("\t%s\t%s, (%s)\n", MOVQ, RAX, RBX)
-	case ast.SubscriptExpr:
-		if col, ok := gen.lookup(v.Token.String()); ok {
-			i, ok := v.Expr.(ast.IntVal)
-			if !ok {
-				panic("subscript expr is not intVal")
-			}
-			gen.emitf("\t%s\t%s, %d(%s)\n", mov(col.ty), registerA(col.ty), (i.Num*col.ty.Bytes() - col.pos), RBP)
-		} else {
-			panic("ident is not defined")
+// compoundOps maps compound assignment operators to their binary operator.
+var compoundOps = map[token.TokenKind]token.TokenKind{
+	token.ADD_ASSIGN:   token.ADD,
+	token.SUB_ASSIGN:   token.SUB,
+	token.MUL_ASSIGN:   token.MUL,
+	token.DIV_ASSIGN:   token.DIV,
+	token.REM_ASSIGN:   token.REM,
+	token.LEFT_ASSIGN:  token.LSHIFT,
+	token.RIGHT_ASSIGN: token.RSHIFT,
+	token.AND_ASSIGN:   token.AND,
+	token.OR_ASSIGN:    token.OR,
+	token.XOR_ASSIGN:   token.XOR,
+}
+
+// compoundAssign computes L op= R. The address of L is computed once and
+// kept on the stack while R is evaluated.
+func (gen *Gen) compoundAssign(e *ast.AssignExpr) {
+	l, r := e.L.Type(), e.R.Type().Decay()
+	op := *e.Op
+	op.Kind = compoundOps[e.Op.Kind]
+
+	// the type the operation is done in
+	t := ast.UsualArith(l, r)
+	switch {
+	case l.IsPtr():
+		t = ast.LongType
+	case op.Kind == token.LSHIFT || op.Kind == token.RSHIFT:
+		t = ast.Promote(l)
+	}
+
+	gen.address(e.L)
+	gen.push(RAX)
+	gen.expr(e.R)
+	gen.convert(r, t)
+	gen.emit(MOVQ, RAX, RCX)
+	if l.IsPtr() {
+		gen.scale(RCX, l.Elem().Bytes())
+	}
+	gen.emitf("\t%s\t(%s), %s\n", MOVQ, RSP, RAX)
+	gen.load(l)
+	gen.convert(l, t)
+	gen.arith(&op, t)
+	gen.convert(t, l)
+	gen.pop(RCX)
+	gen.store(l)
+}
+
+// arg computes the i-th argument a of a call in %rax, converted to the
+// type of its parameter. An argument matching "..." or with narrow type
+// is promoted, as the callee expects at least 32 bits to be extended.
+func (gen *Gen) arg(a ast.Expr, params []*ast.CType, i int) {
+	gen.expr(a)
+	t := argType(a, params, i)
+	gen.convert(a.Type(), t)
+	if t.IsInteger() && t.Bytes() < 4 {
+		gen.extend(t, ast.IntType)
+	}
+}
+
+// argType returns the type the i-th argument a is passed as: the type
+// of its parameter, or double for a float matching "...".
+func argType(a ast.Expr, params []*ast.CType, i int) *ast.CType {
+	if i < len(params) {
+		return params[i]
+	}
+	if t := a.Type().Decay(); t.Kind != ast.C_float {
+		return t
+	}
+	return ast.DoubleType
+}
+
+// extend sign or zero extends the integer of type from in %rax to the
+// wider type to, depending on the signedness of from.
+func (gen *Gen) extend(from, to *ast.CType) {
+	if !from.IsInteger() || from.Bytes() >= to.Bytes() {
+		return
+	}
+	switch from.Bytes() {
+	case 1:
+		switch {
+		case from.Unsigned:
+			gen.emit(MOVZBL, AL, EAX)
+		case to.Bytes() == 8:
+			gen.emit(MOVSBQ, AL, RAX)
+		default:
+			gen.emit(MOVSBL, AL, EAX)
 		}
-	case ast.Ident:
-		if col, ok := gen.lookup(v.Token.String()); ok {
-			gen.emitf("\t%s\t%s, %d(%s)\n", mov(col.ty), registerA(col.ty), -col.pos, RBP)
+	case 2:
+		switch {
+		case from.Unsigned:
+			gen.emit(MOVZWL, AX, EAX)
+		case to.Bytes() == 8:
+			gen.emit(MOVSWQ, AX, RAX)
+		default:
+			gen.emit(MOVSWL, AX, EAX)
+		}
+	case 4:
+		if from.Unsigned {
+			gen.emit(MOVL, EAX, EAX) // clears the upper half
 		} else {
-			panic("ident is not defined")
+			gen.emit(MOVSLQ, EAX, RAX)
 		}
-	default:
-		panic("unimplemented assignExpr L type")
 	}
 }
 
-func (gen *Gen) subscriptExpr(e ast.SubscriptExpr) {
-	if col, ok := gen.lookup(e.Token.String()); ok {
-		i, ok := e.Expr.(ast.IntVal)
-		if !ok {
-			panic("subscript should be intVal")
+// address computes the address of the object designated by e in %rax.
+func (gen *Gen) address(e ast.Expr) {
+	switch v := e.(type) {
+	case *ast.Ident:
+		if v.Obj != nil && v.Obj.Linkage && gen.target.got(internal(v.Obj), ast.IsDefinition(v.Obj.Decl)) {
+			gen.emitf("\t%s\t%s@GOTPCREL(%s), %s\n", MOVQ, gen.staticLabel(v.Obj), RIP, RAX)
+		} else if v.Obj != nil && (v.Obj.Static || v.Obj.Kind == ast.FuncObj) {
+			gen.emitf("\t%s\t%s(%s), %s\n", LEAQ, gen.staticLabel(v.Obj), RIP, RAX)
+		} else if col, ok := gen.lookupTok(v.Token, v.Obj); ok {
+			gen.emitf("\t%s\t%d(%s), %s\n", LEAQ, -col.pos, RBP, RAX)
 		}
-
-		gen.emitf("\t%s\t%d(%s), %s\n", mov(col.ty), (i.Num*col.ty.Bytes() - col.pos), RBP, registerA(col.ty))
-	} else {
-		panic("ident is not defined")
+	case *ast.StringVal:
+		gen.emitf("\t%s\t%s(%s), %s\n", LEAQ, gen.staticLabel(v.Obj), RIP, RAX)
+	case *ast.PtrVal:
+		gen.expr(v.X)
+	case *ast.SubscriptExpr:
+		// x[i] is *(x + i), where either operand may be the pointer
+		x, i := v.X, v.Index
+		if i.Type().Decay().IsPtr() {
+			x, i = i, x
+		}
+		gen.expr(x)
+		gen.push(RAX)
+		gen.expr(i)
+		gen.extend(i.Type(), ast.LongType)
+		gen.scale(RAX, v.Type().Bytes())
+		gen.pop(RCX)
+		gen.emit(ADDQ, RCX, RAX)
+	case *ast.MemberExpr:
+		// a struct value evaluates to its address, like the pointer of ->
+		gen.expr(v.X)
+		if v.Field.Offset != 0 {
+			gen.emitf("\t%s\t$%d, %s\n", ADDQ, v.Field.Offset, RAX)
+		}
+	default:
+		gen.errorf(e.Pos(), "expression is not assignable")
 	}
 }
 
-func (gen *Gen) pointerVal(e ast.PtrVal) {
-	if col, ok := gen.lookup(e.Token.String()); ok {
-		gen.emitf("\t%s\t%d(%s), %s\n", mov(col.ty), -col.pos, RBP, registerB(col.ty))
-		gen.emitf("\t%s\t(%s), %s\n", mov(col.ty), registerB(col.ty), registerA(col.ty))
-	} else {
-		panic("ident is not defined")
+// load replaces the address in %rax by the value of type t stored there.
+// Arrays, structs and functions are left as addresses.
+func (gen *Gen) load(t *ast.CType) {
+	if t.IsArray() || t.IsStruct() || t.IsFunc() {
+		return
 	}
+	gen.emitf("\t%s\t(%s), %s\n", mov(t), RAX, registerA(t))
 }
 
-func (gen *Gen) addressVal(e ast.AddressVal) {
-	if col, ok := gen.lookup(e.Token.String()); ok {
-		gen.emitf("\t%s\t%d(%s), %s\n", LEAQ, -col.pos, RBP, RAX)
-	} else {
-		panic("ident is not defined")
+// store writes the value of type t in %rax to the address in %rcx.
+// A struct is copied from the address in %rax, which becomes the
+// address of the copy.
+func (gen *Gen) store(t *ast.CType) {
+	if t.IsStruct() {
+		gen.copy(t.Bytes())
+		gen.emit(MOVQ, RCX, RAX)
+		return
 	}
+	gen.emitf("\t%s\t%s, (%s)\n", mov(t), registerA(t), RCX)
 }
@@ -9,13 +9,45 @@ const (
 	MOVW
 	MOVL
 	MOVQ
+	MOVABSQ
+	MOVSLQ
+	MOVZBL
+	MOVZWL
+	MOVSBL
+	MOVSBQ
+	MOVSWL
+	MOVSWQ
+	ADDB
+	ADDW
 	ADDL
 	ADDQ
 	SUBL
 	SUBQ
+	SHLQ
+	SHRQ
+	SHLL
+	SARL
+	SARQ
+	SHRL
+	ANDL
+	ANDQ
+	ANDB
+	ORL
+	ORQ
+	ORB
+	XORB
+	XORQ
+	NEGL
+	NEGQ
+	NOTL
+	NOTQ
+	BTCL
+	BTCQ
 	IMUL
 	IDIV
+	DIV
 	CLTD
+	CQTO
 	XORL
 	JMP
 	JE
@@ -24,16 +56,58 @@ const (
 	JLE
 	JG
 	JGE
+	JA
+	JB
+	JBE
+	JAE
+	JS
+	SETE
+	SETNE
+	SETL
+	SETLE
+	SETG
+	SETGE
+	SETB
+	SETBE
+	SETA
+	SETAE
+	SETP
+	SETNP
 	CMPL
+	CMPQ
+	TESTB
+	TESTW
+	TESTL
+	TESTQ
 	PUSH
 	POP
 	LEAQ
 	CALL
 	LEAVE
 	RET
+
+	// SSE
+	MOVD
+	ADDSS
+	ADDSD
+	SUBSS
+	SUBSD
+	MULSS
+	MULSD
+	DIVSS
+	DIVSD
+	UCOMISS
+	UCOMISD
+	XORPS
+	CVTSI2SSQ
+	CVTSI2SDQ
+	CVTTSS2SIQ
+	CVTTSD2SIQ
+	CVTSS2SD
+	CVTSD2SS
 )
 
-func mov(t ast.CType) Opcode {
+func mov(t *ast.CType) Opcode {
 	switch t.Bytes() {
 	case 1:
 		return MOVB
@@ -46,6 +120,40 @@ func mov(t ast.CType) Opcode {
 	}
 }
 
+func add(t *ast.CType) Opcode {
+	switch t.Bytes() {
+	case 1:
+		return ADDB
+	case 2:
+		return ADDW
+	case 4:
+		return ADDL
+	default:
+		return ADDQ
+	}
+}
+
+// sized returns l for operations on 32-bit values and q on 64-bit ones.
+func sized(t *ast.CType, l, q Opcode) Opcode {
+	if t.Bytes() == 8 {
+		return q
+	}
+	return l
+}
+
+func test(t *ast.CType) Opcode {
+	switch t.Bytes() {
+	case 1:
+		return TESTB
+	case 2:
+		return TESTW
+	case 4:
+		return TESTL
+	default:
+		return TESTQ
+	}
+}
+
 func (c Opcode) String() string {
 	switch c {
 	case MOVB:
@@ -56,6 +164,26 @@ func (c Opcode) String() string {
 		return "movl"
 	case MOVQ:
 		return "movq"
+	case MOVABSQ:
+		return "movabsq"
+	case MOVSLQ:
+		return "movslq"
+	case MOVZBL:
+		return "movzbl"
+	case MOVZWL:
+		return "movzwl"
+	case MOVSBL:
+		return "movsbl"
+	case MOVSBQ:
+		return "movsbq"
+	case MOVSWL:
+		return "movswl"
+	case MOVSWQ:
+		return "movswq"
+	case ADDB:
+		return "addb"
+	case ADDW:
+		return "addw"
 	case ADDL:
 		return "addl"
 	case ADDQ:
@@ -64,12 +192,56 @@ func (c Opcode) String() string {
 		return "subl"
 	case SUBQ:
 		return "subq"
+	case SHLQ:
+		return "shlq"
+	case SHRQ:
+		return "shrq"
+	case SHLL:
+		return "shll"
+	case SARL:
+		return "sarl"
+	case SARQ:
+		return "sarq"
+	case SHRL:
+		return "shrl"
+	case ANDL:
+		return "andl"
+	case ANDQ:
+		return "andq"
+	case ANDB:
+		return "andb"
+	case ORL:
+		return "orl"
+	case ORQ:
+		return "orq"
+	case ORB:
+		return "orb"
+	case XORB:
+		return "xorb"
+	case XORQ:
+		return "xorq"
+	case NEGL:
+		return "negl"
+	case NEGQ:
+		return "negq"
+	case NOTL:
+		return "notl"
+	case NOTQ:
+		return "notq"
+	case BTCL:
+		return "btcl"
+	case BTCQ:
+		return "btcq"
 	case IMUL:
 		return "imul"
 	case IDIV:
 		return "idiv"
+	case DIV:
+		return "div"
 	case CLTD:
 		return "cltd"
+	case CQTO:
+		return "cqto"
 	case XORL:
 		return "xorl"
 	case JMP:
@@ -86,8 +258,52 @@ func (c Opcode) String() string {
 		return "jg	"
 	case JGE:
 		return "jge	"
+	case JA:
+		return "ja	"
+	case JB:
+		return "jb	"
+	case JBE:
+		return "jbe	"
+	case JAE:
+		return "jae	"
+	case JS:
+		return "js"
+	case SETE:
+		return "sete"
+	case SETNE:
+		return "setne"
+	case SETL:
+		return "setl"
+	case SETLE:
+		return "setle"
+	case SETG:
+		return "setg"
+	case SETGE:
+		return "setge"
+	case SETB:
+		return "setb"
+	case SETBE:
+		return "setbe"
+	case SETA:
+		return "seta"
+	case SETAE:
+		return "setae"
+	case SETP:
+		return "setp"
+	case SETNP:
+		return "setnp"
 	case CMPL:
 		return "cmpl"
+	case CMPQ:
+		return "cmpq"
+	case TESTB:
+		return "testb"
+	case TESTW:
+		return "testw"
+	case TESTL:
+		return "testl"
+	case TESTQ:
+		return "testq"
 	case PUSH:
 		return "push"
 	case POP:
@@ -100,6 +316,42 @@ func (c Opcode) String() string {
 		return "leave"
 	case RET:
 		return "ret"
+	case MOVD:
+		return "movd"
+	case ADDSS:
+		return "addss"
+	case ADDSD:
+		return "addsd"
+	case SUBSS:
+		return "subss"
+	case SUBSD:
+		return "subsd"
+	case MULSS:
+		return "mulss"
+	case MULSD:
+		return "mulsd"
+	case DIVSS:
+		return "divss"
+	case DIVSD:
+		return "divsd"
+	case UCOMISS:
+		return "ucomiss"
+	case UCOMISD:
+		return "ucomisd"
+	case XORPS:
+		return "xorps"
+	case CVTSI2SSQ:
+		return "cvtsi2ssq"
+	case CVTSI2SDQ:
+		return "cvtsi2sdq"
+	case CVTTSS2SIQ:
+		return "cvttss2siq"
+	case CVTTSD2SIQ:
+		return "cvttsd2siq"
+	case CVTSS2SD:
+		return "cvtss2sd"
+	case CVTSD2SS:
+		return "cvtsd2ss"
 	default:
 		panic("undefined code")
 	}
@@ -49,11 +49,28 @@ const (
 	R9D
 	R9
 
+	R10
+
 	RBP
 	RSP
+	RIP
+
+	XMM0
+	XMM1
+	XMM2
+	XMM3
+	XMM4
+	XMM5
+	XMM6
+	XMM7
 )
 
-func registerA(t ast.CType) Register {
+// xmm returns the i-th vector register.
+func xmm(i int) Register {
+	return XMM0 + Register(i)
+}
+
+func registerA(t *ast.CType) Register {
 	switch t.Bytes() {
 	case 1:
 		return AL
@@ -66,7 +83,7 @@ func registerA(t ast.CType) Register {
 	}
 }
 
-func registerB(t ast.CType) Register {
+func registerB(t *ast.CType) Register {
 	switch t.Bytes() {
 	case 1:
 		return BL
@@ -79,7 +96,7 @@ func registerB(t ast.CType) Register {
 	}
 }
 
-func registerC(t ast.CType) Register {
+func registerC(t *ast.CType) Register {
 	switch t.Bytes() {
 	case 1:
 		return CL
@@ -92,7 +109,7 @@ func registerC(t ast.CType) Register {
 	}
 }
 
-func registerD(t ast.CType) Register {
+func registerD(t *ast.CType) Register {
 	switch t.Bytes() {
 	case 1:
 		return DL
@@ -105,7 +122,7 @@ func registerD(t ast.CType) Register {
 	}
 }
 
-func registerDI(t ast.CType) Register {
+func registerDI(t *ast.CType) Register {
 	switch t.Bytes() {
 	case 1:
 		return DIL
@@ -118,7 +135,7 @@ func registerDI(t ast.CType) Register {
 	}
 }
 
-func registerSI(t ast.CType) Register {
+func registerSI(t *ast.CType) Register {
 	switch t.Bytes() {
 	case 1:
 		return SIL
@@ -131,7 +148,7 @@ func registerSI(t ast.CType) Register {
 	}
 }
 
-func registerR8(t ast.CType) Register {
+func registerR8(t *ast.CType) Register {
 	switch t.Bytes() {
 	case 1:
 		return R8B
@@ -144,7 +161,7 @@ func registerR8(t ast.CType) Register {
 	}
 }
 
-func registerR9(t ast.CType) Register {
+func registerR9(t *ast.CType) Register {
 	switch t.Bytes() {
 	case 1:
 		return R9B
@@ -239,10 +256,31 @@ func (r Register) String() string {
 	case R9:
 		return "%r9"
 
+	case R10:
+		return "%r10"
+
 	case RBP:
 		return "%rbp"
 	case RSP:
 		return "%rsp"
+	case RIP:
+		return "%rip"
+	case XMM0:
+		return "%xmm0"
+	case XMM1:
+		return "%xmm1"
+	case XMM2:
+		return "%xmm2"
+	case XMM3:
+		return "%xmm3"
+	case XMM4:
+		return "%xmm4"
+	case XMM5:
+		return "%xmm5"
+	case XMM6:
+		return "%xmm6"
+	case XMM7:
+		return "%xmm7"
 
 	default:
 		panic("undefined Register")
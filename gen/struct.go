@@ -0,0 +1,226 @@
+package gen
+
+import "gocc/ast"
+
+// Struct and union values are represented by their address in %rax.
+// They are passed and returned following the System V ABI: a struct of
+// at most 16 bytes is split into eightbytes passed in registers, larger
+// ones are passed in memory. An eightbyte made of floats only goes in a
+// vector register, any other one in a general purpose register.
+
+// eightbytes returns the number of registers a struct of type t is
+// passed in, or 0 if it is passed in memory.
+func eightbytes(t *ast.CType) int {
+	if t.Bytes() == 0 || t.Bytes() > 16 {
+		return 0
+	}
+	return (t.Bytes() + 7) / 8
+}
+
+// class is the register class of an eightbyte.
+type class int
+
+const (
+	INTEGER class = iota
+	SSE
+)
+
+// classify returns the classes of the eightbytes of a value of type t,
+// or nil if it is passed in memory.
+func classify(t *ast.CType) []class {
+	if !t.IsStruct() {
+		if t.IsFloat() {
+			return []class{SSE}
+		}
+		return []class{INTEGER}
+	}
+	if inMemory(t) {
+		return nil
+	}
+	cs := make([]class, eightbytes(t))
+	for i := range cs {
+		cs[i] = SSE
+	}
+	scalars(t, 0, func(off int, s *ast.CType) {
+		if !s.IsFloat() {
+			cs[off/8] = INTEGER
+		}
+	})
+	return cs
+}
+
+// count returns the number of eightbytes of class c in cs.
+func count(cs []class, c class) int {
+	n := 0
+	for _, x := range cs {
+		if x == c {
+			n++
+		}
+	}
+	return n
+}
+
+// scalars calls f with the offset and the type of each scalar member of
+// a value of type t at offset off, including array elements.
+func scalars(t *ast.CType, off int, f func(int, *ast.CType)) {
+	switch {
+	case t.IsStruct():
+		for _, fl := range t.Struct.Fields {
+			scalars(fl.Type, off+fl.Offset, f)
+		}
+	case t.IsArray():
+		for i := 0; i < t.Len; i++ {
+			scalars(t.Base, off+i*t.Base.Bytes(), f)
+		}
+	default:
+		f(off, t)
+	}
+}
+
+// inMemory reports whether a value of type t is passed and returned
+// in memory.
+func inMemory(t *ast.CType) bool {
+	return t.IsStruct() && eightbytes(t) == 0
+}
+
+// scalar returns an integer type of n bytes.
+func scalar(n int) *ast.CType {
+	switch n {
+	case 1:
+		return ast.CharType
+	case 2:
+		return ast.ShortType
+	case 4:
+		return ast.IntType
+	default:
+		return ast.LongType
+	}
+}
+
+// chunk returns the widest move of at most n bytes.
+func chunk(n int) int {
+	switch {
+	case n >= 8:
+		return 8
+	case n >= 4:
+		return 4
+	case n >= 2:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func alignTo(n, align int) int {
+	return (n + align - 1) / align * align
+}
+
+// copy copies size bytes from the address in %rax to the address in %rcx.
+func (gen *Gen) copy(size int) {
+	for off := 0; off < size; {
+		t := scalar(chunk(size - off))
+		gen.emitf("\t%s\t%d(%s), %s\n", mov(t), off, RAX, registerD(t))
+		gen.emitf("\t%s\t%s, %d(%s)\n", mov(t), registerD(t), off, RCX)
+		off += t.Bytes()
+	}
+}
+
+// zero clears size bytes of the stack slot at -pos(%rbp).
+func (gen *Gen) zero(pos, size int) {
+	for off := 0; off < size; {
+		t := scalar(chunk(size - off))
+		gen.emitf("\t%s\t$0, %d(%s)\n", mov(t), off-pos, RBP)
+		off += t.Bytes()
+	}
+}
+
+// eightbyte returns the offset and the size of the i-th eightbyte
+// of a struct of size bytes.
+func eightbyte(i, size int) (int, int) {
+	off := i * 8
+	if size-off < 8 {
+		return off, size - off
+	}
+	return off, 8
+}
+
+// loadEightbyte loads the i-th eightbyte of the struct of size bytes at
+// the address in base into the register reg. Bits beyond the struct are
+// undefined, as the ABI allows.
+func (gen *Gen) loadEightbyte(reg func(*ast.CType) Register, base Register, i, size int) {
+	off, n := eightbyte(i, size)
+	if n == chunk(n) {
+		t := scalar(n)
+		gen.emitf("\t%s\t%d(%s), %s\n", mov(t), off, base, reg(t))
+		return
+	}
+	for j := n - 1; j >= 0; j-- {
+		if j < n-1 {
+			gen.emitf("\t%s\t$8, %s\n", SHLQ, reg(scalar(8)))
+		}
+		gen.emitf("\t%s\t%d(%s), %s\n", MOVB, off+j, base, reg(scalar(1)))
+	}
+}
+
+// storeEightbyte stores the register reg as the i-th eightbyte of the
+// struct of size bytes at the address in base. reg may be clobbered.
+func (gen *Gen) storeEightbyte(reg func(*ast.CType) Register, base Register, i, size int) {
+	off, n := eightbyte(i, size)
+	if n == chunk(n) {
+		t := scalar(n)
+		gen.emitf("\t%s\t%s, %d(%s)\n", mov(t), reg(t), off, base)
+		return
+	}
+	for j := 0; j < n; j++ {
+		if j > 0 {
+			gen.emitf("\t%s\t$8, %s\n", SHRQ, reg(scalar(8)))
+		}
+		gen.emitf("\t%s\t%s, %d(%s)\n", MOVB, reg(scalar(1)), off+j, base)
+	}
+}
+
+// loadSSE loads the i-th eightbyte, made of floats, of the struct of
+// size bytes at the address in base into the vector register x.
+func (gen *Gen) loadSSE(x, base Register, i, size int) {
+	off, n := eightbyte(i, size)
+	gen.emitf("\t%s\t%d(%s), %s\n", sized(scalar(n), MOVD, MOVQ), off, base, x)
+}
+
+// storeSSE stores the vector register x as the i-th eightbyte, made of
+// floats, of the struct of size bytes at the address in base.
+func (gen *Gen) storeSSE(x, base Register, i, size int) {
+	off, n := eightbyte(i, size)
+	gen.emitf("\t%s\t%s, %d(%s)\n", sized(scalar(n), MOVD, MOVQ), x, off, base)
+}
+
+// argRegister returns the register family of the i-th integer argument.
+func argRegister(i int) func(*ast.CType) Register {
+	return func(t *ast.CType) Register { return argsRegister(i, t) }
+}
+
+// returnStruct returns the struct of type t at the address in %rax
+// from the current function.
+func (gen *Gen) returnStruct(t *ast.CType) {
+	if inMemory(t) {
+		// copy to the buffer passed by the caller and return its address
+		gen.emitf("\t%s\t%d(%s), %s\n", MOVQ, -gen.retPtr, RBP, RCX)
+		gen.copy(t.Bytes())
+		gen.emit(MOVQ, RCX, RAX)
+		return
+	}
+	gen.emit(MOVQ, RAX, RCX)
+	gp, fp := 0, 0
+	for i, c := range classify(t) {
+		if c == SSE {
+			gen.loadSSE(xmm(fp), RCX, i, t.Bytes())
+			fp++
+		} else {
+			gen.loadEightbyte(retRegisters[gp], RCX, i, t.Bytes())
+			gp++
+		}
+	}
+}
+
+// retRegisters are the register families of the integer eightbytes of
+// a returned struct.
+var retRegisters = []func(*ast.CType) Register{registerA, registerD}
@@ -0,0 +1,115 @@
+package gen
+
+import (
+	"fmt"
+	"gocc/ast"
+	"sort"
+)
+
+// A switch statement jumps to its case labels through a jump table if
+// the case values are dense, and through a chain of comparisons if not.
+
+// minJumpTable is the least number of cases worth a jump table, and
+// maxJumpTable the most entries a jump table may have.
+const (
+	minJumpTable = 4
+	maxJumpTable = 1 << 12
+)
+
+// span returns the difference between the greatest and the least of
+// cases sorted by value. It cannot overflow, as values wrap around.
+func span(cases []*ast.CaseStmt) uint64 {
+	return uint64(cases[len(cases)-1].Value) - uint64(cases[0].Value)
+}
+
+// dense reports whether a jump table for cases sorted by value would be
+// at most 3 times as large as a comparison chain.
+func dense(cases []*ast.CaseStmt) bool {
+	if len(cases) < minJumpTable {
+		return false
+	}
+	n := span(cases)
+	return n < maxJumpTable && n < 3*uint64(len(cases))
+}
+
+func (gen *Gen) switchStmt(v *ast.SwitchStmt) {
+	brk := gen.newLabel()
+	dflt := brk
+	if v.Default != nil {
+		dflt = gen.newLabel()
+		gen.cases[v.Default] = dflt
+	}
+	cases := make([]*ast.CaseStmt, len(v.Cases))
+	for i, c := range v.Cases {
+		gen.cases[c] = gen.newLabel()
+		cases[i] = c
+	}
+	// case values are converted to t, so unsigned long values of 2^63
+	// and above are negative
+	t := ast.Promote(v.Expr.Type())
+	sort.Slice(cases, func(i, j int) bool {
+		if t.Unsigned {
+			return uint64(cases[i].Value) < uint64(cases[j].Value)
+		}
+		return cases[i].Value < cases[j].Value
+	})
+
+	gen.expr(v.Expr)
+	if dense(cases) {
+		gen.jumpTable(t, cases, dflt)
+	} else {
+		for _, c := range cases {
+			gen.emitf("\t%s\t%s, %s\n", sized(t, CMPL, CMPQ), gen.immediate(t, c.Value), registerA(t))
+			gen.emitf("\t%s\t%s\n", JE, gen.target.local(gen.cases[c]))
+		}
+		gen.jmp(dflt)
+	}
+
+	gen.breaks = append(gen.breaks, brk)
+	gen.blockStmt(v.Block)
+	gen.breaks = gen.breaks[:len(gen.breaks)-1]
+	gen.label(brk)
+}
+
+// immediate returns the operand for the case value v of type t, which
+// is loaded to %rcx if it does not fit in a sign-extended immediate.
+func (gen *Gen) immediate(t *ast.CType, v int) string {
+	if t.Bytes() == 8 && v != int(int32(v)) {
+		gen.emitf("\t%s\t$%d, %s\n", MOVABSQ, v, RCX)
+		return RCX.String()
+	}
+	return fmt.Sprintf("$%d", v)
+}
+
+// jumpTable jumps to the label of the case whose value of type t is in
+// %eax or %rax, or to dflt if there is none. The table in .rodata holds
+// the offsets of the labels from the table, so that the code is
+// position independent.
+func (gen *Gen) jumpTable(t *ast.CType, cases []*ast.CaseStmt, dflt int) {
+	table := gen.newLabel()
+	min, n := cases[0].Value, span(cases)
+
+	// values below min wrap around to large unsigned indexes; subl
+	// clears the upper half of %rax
+	gen.emitf("\t%s\t%s, %s\n", sized(t, SUBL, SUBQ), gen.immediate(t, min), registerA(t))
+	gen.emitf("\t%s\t$%d, %s\n", sized(t, CMPL, CMPQ), n, registerA(t))
+	gen.emitf("\t%s\t%s\n", JA, gen.target.local(dflt))
+	gen.emitf("\t%s\t%s(%s), %s\n", LEAQ, gen.target.local(table), RIP, RCX)
+	gen.emitf("\t%s\t(%s,%s,4), %s\n", MOVSLQ, RCX, RAX, RAX)
+	gen.emit(ADDQ, RCX, RAX)
+	gen.emitf("\t%s\t*%s\n", JMP, RAX)
+
+	gen.section(rodata)
+	gen.emitf("\t.p2align 2\n")
+	gen.label(table)
+	i := 0
+	for k := uint64(0); k <= n; k++ {
+		l := dflt
+		if cases[i].Value == min+int(k) {
+			l = gen.cases[cases[i]]
+			i++
+		}
+		gen.emitf("\t.long %s-%s\n", gen.target.local(l), gen.target.local(table))
+	}
+	gen.section(text)
+}
@@ -0,0 +1,144 @@
+package gen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format is an object file format.
+type Format int
+
+const (
+	ELF Format = iota
+	MachO
+)
+
+// Target is the platform the assembly is written for. Its object file
+// format decides how symbols are named, which sections exist and how
+// code refers to symbols defined in other modules.
+type Target struct {
+	Triple string
+	Format Format
+}
+
+// DefaultTarget is x86-64 Linux.
+var DefaultTarget = &Target{Triple: "x86_64-linux-gnu", Format: ELF}
+
+// ParseTarget returns the target described by a triple such as
+// x86_64-linux-gnu or x86_64-apple-darwin.
+func ParseTarget(triple string) (*Target, error) {
+	parts := strings.Split(triple, "-")
+	if len(parts) >= 2 && parts[0] == "x86_64" {
+		for _, p := range parts[1:] {
+			switch {
+			case p == "linux":
+				return &Target{Triple: triple, Format: ELF}, nil
+			case p == "apple" || strings.HasPrefix(p, "darwin") || strings.HasPrefix(p, "macos"):
+				return &Target{Triple: triple, Format: MachO}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown target triple '%s'", triple)
+}
+
+type section int
+
+const (
+	text section = iota
+	data
+	bss
+	rodata
+	relro   // const data holding addresses, which are relocated at load time
+	cstring // string literals
+)
+
+// section returns the directive switching to the section s.
+func (t *Target) section(s section) string {
+	switch s {
+	case text:
+		return ".text"
+	case data:
+		return ".data"
+	case bss:
+		return ".bss"
+	}
+	if s == relro {
+		if t.Format == MachO {
+			return ".section __DATA,__const"
+		}
+		return ".section .data.rel.ro,\"aw\""
+	}
+	if t.Format == MachO {
+		if s == cstring {
+			return ".section __TEXT,__cstring,cstring_literals"
+		}
+		return ".section __TEXT,__const"
+	}
+	return ".section .rodata"
+}
+
+// symbol returns the assembler symbol of the C name. Mach-O prefixes
+// C names with an underscore.
+func (t *Target) symbol(name string) string {
+	if t.Format == MachO {
+		return "_" + name
+	}
+	return name
+}
+
+// local returns the n-th local label, which is not kept in the symbol
+// table.
+func (t *Target) local(n int) string {
+	if t.Format == MachO {
+		return fmt.Sprintf("L%d", n)
+	}
+	return fmt.Sprintf(".L%d", n)
+}
+
+// On ELF, a symbol with external linkage may be preempted by a definition
+// in another module when linked into a shared object, so it is accessed
+// through the GOT or called through the PLT like the symbols defined in
+// another module. local symbols have internal linkage.
+
+// call returns the operand of a call to the function sym.
+func (t *Target) call(sym string, local bool) string {
+	if t.Format == ELF && !local {
+		return sym + "@PLT"
+	}
+	return sym
+}
+
+// got reports whether the address of the object sym is loaded from the
+// GOT.
+func (t *Target) got(local, defined bool) bool {
+	if t.Format == ELF {
+		return !local
+	}
+	return !defined
+}
+
+// typeOf returns the directive telling that sym is a function or an
+// object, which only ELF has.
+func (t *Target) typeOf(sym, kind string) string {
+	if t.Format != ELF {
+		return ""
+	}
+	return fmt.Sprintf("\t.type %s, @%s\n", sym, kind)
+}
+
+// sizeOf returns the directive giving the size of sym, which only ELF has.
+func (t *Target) sizeOf(sym, size string) string {
+	if t.Format != ELF {
+		return ""
+	}
+	return fmt.Sprintf("\t.size %s, %s\n", sym, size)
+}
+
+// prelude returns the directives starting the file. On ELF the stack is
+// marked as not executable.
+func (t *Target) prelude() string {
+	if t.Format == ELF {
+		return "\t.section .note.GNU-stack,\"\",@progbits\n\t.text\n"
+	}
+	return "\t.text\n"
+}
@@ -0,0 +1,74 @@
+package gen
+
+import (
+	"gocc/ast"
+)
+
+// A variadic function saves all argument registers to a register save
+// area in its frame. A va_list, declared by <stdarg.h>, then tracks the
+// next argument as in the System V ABI:
+//
+//	struct __va_list_tag {
+//		unsigned int gp_offset;  // of the next general purpose register in the save area
+//		unsigned int fp_offset;  // of the next vector register in the save area
+//		void *overflow_arg_area; // next argument passed on the stack
+//		void *reg_save_area;
+//	};
+
+// gpSaveSize is the size of the general purpose registers in the
+// register save area, which the vector registers follow in 16 bytes each.
+var gpSaveSize = 8 * ARG_COUNT
+
+// vaFrame is where the variable arguments of a function are.
+type vaFrame struct {
+	save   int // slot of the register save area
+	gp, fp int // registers taken by the named parameters
+	stack  int // offset of the first variable argument on the stack from %rbp
+}
+
+// saveArgs stores the argument registers not taken by the named
+// parameters to the register save area.
+func (gen *Gen) saveArgs(gp, fp, stack int) {
+	gen.va = vaFrame{save: gen.alloc(gpSaveSize+16*SSE_ARG_COUNT, 16), gp: gp, fp: fp, stack: stack}
+	for i := gp; i < ARG_COUNT; i++ {
+		gen.emitf("\t%s\t%s, %d(%s)\n", MOVQ, argsRegisterPtr(i), 8*i-gen.va.save, RBP)
+	}
+	for i := fp; i < SSE_ARG_COUNT; i++ {
+		gen.emitf("\t%s\t%s, %d(%s)\n", MOVQ, xmm(i), gpSaveSize+16*i-gen.va.save, RBP)
+	}
+}
+
+// vaStart initializes the va_list to the first variable argument.
+func (gen *Gen) vaStart(v *ast.VaStartExpr) {
+	gen.expr(v.Ap)
+	gen.emitf("\t%s\t$%d, (%s)\n", MOVL, 8*gen.va.gp, RAX)
+	gen.emitf("\t%s\t$%d, 4(%s)\n", MOVL, gpSaveSize+16*gen.va.fp, RAX)
+	gen.emitf("\t%s\t%d(%s), %s\n", LEAQ, gen.va.stack, RBP, RCX)
+	gen.emitf("\t%s\t%s, 8(%s)\n", MOVQ, RCX, RAX)
+	gen.emitf("\t%s\t%d(%s), %s\n", LEAQ, -gen.va.save, RBP, RCX)
+	gen.emitf("\t%s\t%s, 16(%s)\n", MOVQ, RCX, RAX)
+}
+
+// vaArg loads the next argument of the va_list, from the register save
+// area while registers of its class are left, then from the stack.
+func (gen *Gen) vaArg(v *ast.VaArgExpr) {
+	t := v.To
+	off, end, size := 0, gpSaveSize, 8 // gp_offset
+	if t.IsFloat() {
+		off, end, size = 4, gpSaveSize+16*SSE_ARG_COUNT, 16 // fp_offset
+	}
+	stack, load := gen.newLabel(), gen.newLabel()
+	gen.expr(v.Ap)
+	gen.emit(MOVQ, RAX, RCX)
+	gen.emitf("\t%s\t%d(%s), %s\n", MOVL, off, RCX, EDX)
+	gen.emitf("\t%s\t$%d, %s\n", CMPL, end, EDX)
+	gen.emitf("\t%s\t%s\n", JAE, gen.target.local(stack))
+	gen.emitf("\t%s\t$%d, %d(%s)\n", ADDL, size, off, RCX)
+	gen.emitf("\t%s\t16(%s), %s\n", ADDQ, RCX, RDX)
+	gen.jmp(load)
+	gen.label(stack)
+	gen.emitf("\t%s\t8(%s), %s\n", MOVQ, RCX, RDX)
+	gen.emitf("\t%s\t$8, 8(%s)\n", ADDQ, RCX)
+	gen.label(load)
+	gen.emitf("\t%s\t(%s), %s\n", mov(t), RDX, registerA(t))
+}
@@ -1,13 +1,27 @@
 package lexer
 
-import "gocc/token"
+import (
+	"gocc/diag"
+	"gocc/token"
+	"strconv"
+	"strings"
+)
 
 type Lexer struct {
 	scanner *Scanner
+	diags   *diag.List
 }
 
 func NewLexer(source []byte) *Lexer {
-	return &Lexer{scanner: NewScanner(source)}
+	return &Lexer{scanner: NewScanner(source), diags: diag.NewList()}
+}
+
+func (l *Lexer) Diags() *diag.List {
+	return l.diags
+}
+
+func (l *Lexer) errorf(pos token.Position, format string, a ...interface{}) {
+	l.diags.Errorf(pos, l.scanner.Pos(), format, a...)
 }
 
 func (l *Lexer) Pos() token.Position {
@@ -24,6 +38,12 @@ func (l *Lexer) Next() *token.Token {
 
 	c := l.skipSpace()
 	pos := l.scanner.Pos()
+	t.Pos = pos
+
+	if c == '#' && pos.Column == 1 {
+		l.lineMarker()
+		return l.Next()
+	}
 
 	if isAlpha(c) || c == '_' {
 		l.parseAlpha(t)
@@ -41,8 +61,12 @@ func (l *Lexer) Next() *token.Token {
 		l.parseOperator(t)
 	} else if isPeriod(c) {
 		l.parsePeriod(t)
-	} else {
+	} else if l.scanner.IsEnd() {
 		t.Kind = token.EOF
+	} else {
+		l.consume()
+		l.errorf(pos, "invalid character '%c' in source", c)
+		return l.Next()
 	}
 	if t.Kind == token.COMMENT {
 		return l.Next()
@@ -51,6 +75,46 @@ func (l *Lexer) Next() *token.Token {
 	return t
 }
 
+// lineMarker reads a line
+//
+//	# 42 "file.h"
+//
+// written by the preprocessor, which gives the position of the line
+// following it in the original source.
+func (l *Lexer) lineMarker() {
+	pos := l.scanner.Pos()
+	var line []byte
+	for !l.scanner.IsEnd() && l.scanner.Get() != '\n' {
+		line = append(line, l.scanner.Get())
+		l.scanner.Step()
+	}
+	if !l.scanner.IsEnd() {
+		l.scanner.Step()
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(string(line), "#"))
+	if len(fields) > 0 && fields[0] == "line" {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		l.errorf(pos, "invalid preprocessing directive")
+		return
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil {
+		l.errorf(pos, "invalid preprocessing directive")
+		return
+	}
+	file := pos.File
+	if len(fields) > 1 {
+		if file, err = strconv.Unquote(fields[1]); err != nil {
+			l.errorf(pos, "invalid filename in line marker")
+			return
+		}
+	}
+	l.scanner.SetLine(n, file)
+}
+
 func (l *Lexer) Reset(pos token.Position) {
 	l.scanner.Reset(pos)
 }
@@ -88,18 +152,39 @@ func checkKeyword(s string) token.TokenKind {
 	return token.IDENT
 }
 
+// parseNumber reads a number with its suffix, e.g. "42", "0x1fUL",
+// "1.5e-3f" or ".5". The parser checks the digits and converts the value.
 func (l *Lexer) parseNumber(t *token.Token) {
 	var s []byte
 	c := l.scanner.Get()
-	var ok bool
-	for isDigit(c) {
-		s = append(s, c)
-		if c, ok = l.consume(); !ok {
-			break
+	t.Kind = token.INT_CONST
+	hex := false
+	for ok := true; ok; c, ok = l.consume() {
+		switch {
+		case c == '.':
+			t.Kind = token.FLOAT_CONST
+		case (c == '+' || c == '-') && isExponent(s[len(s)-1], hex):
+		case isAlpha(c) || isDigit(c) || c == '_':
+			if isExponent(c, hex) {
+				t.Kind = token.FLOAT_CONST
+			}
+			hex = hex || string(s) == "0" && (c == 'x' || c == 'X')
+		default:
+			t.Str = s
+			return
 		}
+		s = append(s, c)
 	}
 	t.Str = s
-	t.Kind = token.INT_CONST
+}
+
+// isExponent reports whether c starts the exponent of a decimal or a
+// hexadecimal floating constant.
+func isExponent(c byte, hex bool) bool {
+	if hex {
+		return c == 'p' || c == 'P'
+	}
+	return c == 'e' || c == 'E'
 }
 
 func (l *Lexer) skipSpace() byte {
@@ -143,22 +228,112 @@ func isSingleQuote(c byte) bool {
 func (l *Lexer) parseChar(t *token.Token) {
 	var c byte
 	var ok bool
+	t.Kind = token.CHAR_CONST
 	if c, ok = l.consume(); !ok {
+		l.errorf(t.Pos, "missing terminating ' character")
 		return
 	}
-	if !isSingleQuote(c) {
+	if isSingleQuote(c) {
+		l.consume()
+		l.errorf(t.Pos, "empty character constant")
+		t.Str = append(t.Str, 0)
+		return
+	}
+	if c == '\\' {
+		t.Str = append(t.Str, l.readEscape())
+	} else {
 		t.Str = append(t.Str, c)
-		if c, ok = l.consume(); !ok {
-			return
-		}
+		l.scanner.Step()
 	}
-	if !isSingleQuote(c) {
-		panic("parseChar")
+	if l.scanner.IsEnd() {
+		l.errorf(t.Pos, "missing terminating ' character")
+		return
 	}
-	t.Kind = token.CHAR_CONST
-	if c, ok = l.consume(); !ok {
+	if c = l.scanner.Get(); !isSingleQuote(c) {
+		// skip the rest of the constant so that lexing resumes after it
+		ok = true
+		for !isSingleQuote(c) && !isReturn(c) {
+			if c, ok = l.consume(); !ok {
+				break
+			}
+		}
+		if ok && isSingleQuote(c) {
+			l.consume()
+			l.errorf(t.Pos, "multi-character character constant")
+		} else {
+			l.errorf(t.Pos, "missing terminating ' character")
+		}
 		return
 	}
+	l.consume()
+}
+
+var escapes = map[byte]byte{
+	'n': '\n', 't': '\t', 'r': '\r', 'a': '\a', 'b': '\b', 'f': '\f', 'v': '\v',
+	'e': 0x1b, '\\': '\\', '\'': '\'', '"': '"', '?': '?',
+}
+
+func isOctal(c byte) bool {
+	return '0' <= c && c <= '7'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func hexValue(c byte) int {
+	switch {
+	case isDigit(c):
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10
+	default:
+		return int(c-'A') + 10
+	}
+}
+
+// readEscape decodes the escape sequence starting at the backslash under
+// the scanner, and leaves the scanner just after it.
+func (l *Lexer) readEscape() byte {
+	pos := l.scanner.Pos()
+	c, ok := l.consume()
+	if !ok {
+		return '\\'
+	}
+	switch {
+	case c == 'x':
+		n, digits, over := 0, 0, false
+		for c, ok = l.consume(); ok && isHex(c); c, ok = l.consume() {
+			n = n<<4 | hexValue(c)
+			if n > 0xff {
+				over = true
+				n &= 0xff
+			}
+			digits++
+		}
+		if digits == 0 {
+			l.errorf(pos, "\\x used with no following hex digits")
+		} else if over {
+			l.errorf(pos, "hex escape sequence out of range")
+		}
+		return byte(n)
+	case isOctal(c):
+		n := 0
+		for i := 0; i < 3 && ok && isOctal(c); i++ {
+			n = n<<3 | int(c-'0')
+			c, ok = l.consume()
+		}
+		if n > 0xff {
+			l.errorf(pos, "octal escape sequence out of range")
+		}
+		return byte(n)
+	}
+	l.scanner.Step()
+	if e, ok := escapes[c]; ok {
+		return e
+	}
+	l.diags.Warnf(pos, l.scanner.Pos(), "unknown escape sequence '\\%c'", c)
+	return c
 }
 
 func isDoubleQuote(c byte) bool {
@@ -166,11 +341,11 @@ func isDoubleQuote(c byte) bool {
 }
 
 func (l *Lexer) parseString(t *token.Token) {
-	t.Str = l.readString()
+	t.Str = l.readString(t.Pos)
 	t.Kind = token.STRING_CONST
 }
 
-func (l *Lexer) readString() []byte {
+func (l *Lexer) readString(pos token.Position) []byte {
 	ok := false
 	c := l.scanner.Get()
 
@@ -181,14 +356,22 @@ func (l *Lexer) readString() []byte {
 	var s []byte
 
 	if c, ok = l.consume(); !ok {
+		l.errorf(pos, "missing terminating '\"' character")
 		return s
 	}
 
 	for c != '"' {
-		s = append(s, l.scanner.Get())
-		if c, ok = l.consume(); !ok {
-			break
+		if c == '\\' {
+			s = append(s, l.readEscape())
+		} else {
+			s = append(s, c)
+			l.scanner.Step()
+		}
+		if l.scanner.IsEnd() {
+			l.errorf(pos, "missing terminating '\"' character")
+			return s
 		}
+		c = l.scanner.Get()
 	}
 
 	l.consume()
@@ -262,9 +445,14 @@ func (l *Lexer) readDIV(t *token.Token) {
 		t.Kind = token.COMMENT
 	case '*': // /* comment */
 		t.Str = append(t.Str, c)
-		l.scanner.Step()
-		prevC := l.scanner.Get()
+		t.Kind = token.COMMENT
+		var prevC byte
+		if prevC, ok = l.consume(); !ok {
+			l.errorf(t.Pos, "unterminated /* comment")
+			return
+		}
 		if c, ok = l.consume(); !ok {
+			l.errorf(t.Pos, "unterminated /* comment")
 			return
 		}
 
@@ -274,6 +462,7 @@ func (l *Lexer) readDIV(t *token.Token) {
 			t.Str = append(t.Str, c)
 			prevC = c
 			if c, ok = l.consume(); !ok {
+				l.errorf(t.Pos, "unterminated /* comment")
 				return
 			}
 		}
@@ -504,19 +693,20 @@ func (l *Lexer) parsePeriod(t *token.Token) {
 
 	if isPeriod(c) {
 		s = append(s, c)
-		if c, ok = l.consume(); !ok {
+		c, ok = l.consume()
+		if !ok || !isPeriod(c) {
+			l.errorf(t.Pos, "invalid token '..'")
+			t.Str = s
+			t.Kind = token.PERIOD
 			return
 		}
-		if !isPeriod(c) {
-			panic("parsePeriod")
-		}
 		s = append(s, c)
 		l.scanner.Step()
 		t.Str = s
 		t.Kind = token.ELLIPSIS
 	} else if isDigit(c) {
-		//  - TODO:
-		panic("unimplemented parsePeriod")
+		l.scanner.Reset(t.Pos)
+		l.parseNumber(t)
 	} else {
 		t.Str = s
 		t.Kind = token.PERIOD
@@ -12,15 +12,28 @@ var lexerTests = []struct {
 	{
 		`a "aaa111" 12 'c'`,
 		[]TokenKind{
-			IDENT, STRING_CONST, INT_CONST, CHAR_CONST, EOF, // - TODO: FLOAT_CONST
+			IDENT, STRING_CONST, INT_CONST, CHAR_CONST, EOF,
 		},
 	},
 	{
-		`a int void char float long short do while if else for auto return switch case default continue break goto const extern register signed unsigned sizeof static struct typedef union volatile`,
+		`1.5 .5 2. 1e10 1.5E-3f 3e+2 x.y 1..2`,
+		[]TokenKind{
+			FLOAT_CONST, FLOAT_CONST, FLOAT_CONST, FLOAT_CONST, FLOAT_CONST, FLOAT_CONST,
+			IDENT, PERIOD, IDENT, FLOAT_CONST, EOF,
+		},
+	},
+	{
+		`0x1e5 0XffUL 0755 0b101 10ull 0x1.8p-3 0x1P+2f`,
+		[]TokenKind{
+			INT_CONST, INT_CONST, INT_CONST, INT_CONST, INT_CONST, FLOAT_CONST, FLOAT_CONST, EOF,
+		},
+	},
+	{
+		`a int void char float long short do while if else for auto return switch case default continue break goto const extern register signed unsigned sizeof static struct typedef union volatile enum _Alignof _Bool`,
 		[]TokenKind{
 			IDENT, INT, VOID, CHAR, FLOAT, LONG, SHORT,
 			DO, WHILE, IF, ELSE, FOR, AUTO, RETURN, SWITCH, CASE, DEFAULT, CONTINUE, BREAK, GOTO,
-			CONST, EXTERN, REGISTER, SIGNED, UNSIGNED, SIZEOF, STATIC, STRUCT, TYPEDEF, UNION, VOLATILE, EOF,
+			CONST, EXTERN, REGISTER, SIGNED, UNSIGNED, SIZEOF, STATIC, STRUCT, TYPEDEF, UNION, VOLATILE, ENUM, ALIGNOF, BOOL, EOF,
 		},
 	},
 	{
@@ -81,3 +94,76 @@ func TestLexer(t *testing.T) {
 		}
 	}
 }
+
+func TestEscapes(t *testing.T) {
+	tests := []struct {
+		source string
+		str    string
+	}{
+		{`"a\tb\n"`, "a\tb\n"},
+		{`"\\\"\'\?"`, "\\\"'?"},
+		{`"\x41\x4a\101\0z"`, "AJA\x00z"},
+		{`"\1234"`, "S4"},
+		{`'\n'`, "\n"},
+		{`'\''`, "'"},
+		{`'\xff'`, "\xff"},
+		{`'\0'`, "\x00"},
+	}
+	for _, tt := range tests {
+		l := NewLexer([]byte(tt.source))
+		tok := l.Next()
+		if l.Diags().Len() != 0 {
+			t.Errorf("%s: unexpected error: %s", tt.source, l.Diags().All()[0].Msg)
+		}
+		if string(tok.Str) != tt.str {
+			t.Errorf("%s: expected value is %q, but got %q", tt.source, tt.str, tok.Str)
+		}
+		if next := l.Next(); next.Kind != EOF {
+			t.Errorf("%s: expected end of file, but got %s", tt.source, next.Kind)
+		}
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		msg    string
+	}{
+		{`'ab'`, "multi-character character constant"},
+		{`'a`, "missing terminating ' character"},
+		{`"abc`, "missing terminating '\"' character"},
+		{`a @ b`, "invalid character '@' in source"},
+		{`/* comment`, "unterminated /* comment"},
+		{`"a\q"`, "unknown escape sequence '\\q'"},
+		{`'\x'`, "\\x used with no following hex digits"},
+		{`"\x123"`, "hex escape sequence out of range"},
+		{`'\777'`, "octal escape sequence out of range"},
+		{`"a\"b`, "missing terminating '\"' character"},
+	}
+	for _, tt := range tests {
+		l := NewLexer([]byte(tt.source))
+		for l.Next().Kind != EOF {
+		}
+		ds := l.Diags().All()
+		if len(ds) != 1 {
+			t.Errorf("%q: expected %d diagnostic, but got %d", tt.source, 1, len(ds))
+			continue
+		}
+		if ds[0].Msg != tt.msg {
+			t.Errorf("%q: expected message is %q, but got %q", tt.source, tt.msg, ds[0].Msg)
+		}
+	}
+}
+
+func TestLineMarker(t *testing.T) {
+	l := NewLexer([]byte("# 1 \"a.c\"\nint\n# 10 \"b.h\"\n  x\n"))
+	for _, expect := range []Position{{File: "a.c", Line: 1, Column: 1}, {File: "b.h", Line: 10, Column: 3}} {
+		tok := l.Next()
+		if tok.Pos.File != expect.File || tok.Pos.Line != expect.Line || tok.Pos.Column != expect.Column {
+			t.Errorf("%s: expected position is %s:%d:%d, but got %s:%d:%d", tok, expect.File, expect.Line, expect.Column, tok.Pos.File, tok.Pos.Line, tok.Pos.Column)
+		}
+	}
+	if tok := l.Next(); tok.Kind != EOF {
+		t.Errorf("expected EOF, but got %s", tok)
+	}
+}
@@ -11,8 +11,10 @@ var (
 		"long":     LONG,
 		"short":    SHORT,
 		"double":   DOUBLE,
+		"_Bool":    BOOL,
 		"struct":   STRUCT,
 		"union":    UNION,
+		"enum":     ENUM,
 		"signed":   SIGNED,
 		"unsigned": UNSIGNED,
 		"static":   STATIC,
@@ -37,6 +39,7 @@ var (
 		"break":    BREAK,
 		"goto":     GOTO,
 		"sizeof":   SIZEOF,
+		"_Alignof": ALIGNOF,
 		"typedef":  TYPEDEF,
 	}
 
@@ -43,3 +43,9 @@ func (s *Scanner) IsEnd() bool {
 func (s *Scanner) Reset(pos token.Position) {
 	s.pos = pos
 }
+
+// SetLine renumbers the current line, e.g. after a line marker.
+func (s *Scanner) SetLine(line int, file string) {
+	s.pos.Line = line
+	s.pos.File = file
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	"gocc/cpp"
+	"gocc/diag"
 	"gocc/gen"
 	"gocc/parser"
+	"gocc/sema"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -12,12 +15,35 @@ import (
 	"strings"
 )
 
+// listFlag collects the values of a flag that may be repeated.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
 func main() {
+	var includes, defines listFlag
 	o := flag.String("o", "", "outfile")
 	s := flag.Bool("S", false, "output assembler file")
 	c := flag.Bool("c", false, "generate object file")
+	e := flag.Bool("E", false, "only run the preprocessor")
+	flag.Var(&includes, "I", "add directory to include search path")
+	flag.Var(&defines, "D", "define macro, as name or name=value")
+	errorLimit := flag.Int("ferror-limit", parser.DefaultErrorLimit, "stop after this many errors (0 for no limit)")
+	triple := flag.String("target", gen.DefaultTarget.Triple, "generate code for the target triple, e.g. x86_64-apple-darwin")
 	flag.Parse()
 
+	target, err := gen.ParseTarget(*triple)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
 	if len(flag.Args()) != 1 {
 		fmt.Println("gocc [<Option>] <filename>")
 		os.Exit(1)
@@ -30,10 +56,9 @@ func main() {
 		sName = *o
 	}
 
-	if len(*o) < 1 {
+	if len(*o) < 1 && !*e {
 		if ok := strings.HasSuffix(cFile, ".c"); !ok {
-			fmt.Println("file does not have suffix .c")
-			os.Exit(1)
+			fatalf("file does not have suffix .c")
 		}
 		_, name := filepath.Split(cFile)
 
@@ -50,39 +75,96 @@ func main() {
 
 	source, err := ioutil.ReadFile(cFile)
 	if err != nil {
-		panic(err)
+		fatalf("%v", err)
 	}
 
-	sFile, err := os.Create(sName)
-	if err != nil {
-		panic(err)
+	pp := cpp.New(target)
+	pp.IncludePaths = includes
+	for _, d := range defines {
+		name, value := d, "1"
+		if i := strings.Index(d, "="); i >= 0 {
+			name, value = d[:i], d[i+1:]
+		}
+		pp.Define(name, value)
+	}
+	source = pp.Preprocess(cFile, source)
+	sources := pp.Sources()
+	report(sources, pp.Diags())
+
+	if *e {
+		out := os.Stdout
+		if len(*o) > 0 {
+			if out, err = os.Create(*o); err != nil {
+				fatalf("%v", err)
+			}
+			defer out.Close()
+		}
+		if _, err := out.Write(source); err != nil {
+			fatalf("%v", err)
+		}
+		return
 	}
-	defer sFile.Close()
 
 	p := parser.NewParser(source)
-	gen := gen.NewGen()
+	p.ErrorLimit = *errorLimit
+	nodes := p.ParseFile()
+	report(sources, p.Diags())
+
+	checker := sema.NewChecker()
+	for _, n := range nodes {
+		checker.Check(n)
+	}
+	report(sources, checker.Diags())
 
-	for !p.IsEnd() {
-		n := p.Parse()
+	gen := gen.NewGen(target)
+	for _, n := range nodes {
 		gen.Generate(n)
 	}
+	report(sources, gen.Diags())
+
+	sFile, err := os.Create(sName)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	defer sFile.Close()
 
 	if _, err := sFile.WriteString(gen.Str); err != nil {
-		panic(err)
+		fatalf("%v", err)
 	}
 
 	if !*s {
+		var cmd *exec.Cmd
 		if *c {
-			err = exec.Command("as", "-o", *o, sName).Run()
+			cmd = exec.Command("as", "-o", *o, sName)
 		} else {
-			err = exec.Command("gcc", "-o", *o, sName).Run()
+			cmd = exec.Command("gcc", "-o", *o, sName)
 		}
-		if err != nil {
-			panic(err)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			os.Remove(sName)
+			fatalf("%s failed: %v", cmd.Args[0], err)
 		}
-		err = exec.Command("rm", sName).Run()
-		if err != nil {
-			panic(err)
+		if err := os.Remove(sName); err != nil {
+			fatalf("%v", err)
 		}
 	}
 }
+
+// report prints diagnostics to stderr and exits if any of them is an error.
+func report(sources map[string][]byte, l *diag.List) {
+	diag.Fprint(os.Stderr, sources, l)
+	if n := l.ErrorCount(); n > 0 {
+		if n == 1 {
+			fmt.Fprintln(os.Stderr, "1 error generated.")
+		} else {
+			fmt.Fprintf(os.Stderr, "%d errors generated.\n", n)
+		}
+		os.Exit(1)
+	}
+}
+
+func fatalf(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, "gocc: error: "+format+"\n", a...)
+	os.Exit(1)
+}
@@ -1,25 +1,122 @@
 package parser
 
 import (
-	"fmt"
 	"gocc/ast"
+	"gocc/diag"
 	"gocc/lexer"
 	"gocc/token"
+	"math"
 	"strconv"
+	"strings"
 )
 
 type Parser struct {
 	lexer *lexer.Lexer
 	token *token.Token
 	stack *Stack
+	diags *diag.List
+
+	// ErrorLimit is the number of errors after which parsing stops.
+	// Zero means no limit.
+	ErrorLimit int
+
+	quiet     bool // errors are not reported, see errorf
+	recovered bool // quiet and at the recovery point of the last error
+	stopped   bool // ErrorLimit was reached
+
+	// tags holds the struct, union and enum tags of each open block,
+	// innermost last.
+	tags []map[string]*ast.CType
+	// names holds the ordinary identifiers of each open block.
+	names []map[string]ordinary
+}
+
+// ordinary is what the parser knows of an ordinary identifier: the type
+// of a typedef name, or an enumeration constant with a value computed
+// while parsing. Other identifiers have neither and hide both.
+type ordinary struct {
+	typedef *ast.CType
+	enum    *ast.Object
 }
 
+// bailout is panicked by errorf to unwind to the nearest recovery point.
+type bailout struct{}
+
+const DefaultErrorLimit = 20
+
 func NewParser(source []byte) *Parser {
-	p := &Parser{lexer: lexer.NewLexer(source), token: token.NewToken(), stack: NewStack()}
+	l := lexer.NewLexer(source)
+	p := &Parser{lexer: l, token: token.NewToken(), stack: NewStack(), diags: l.Diags(), ErrorLimit: DefaultErrorLimit}
+	p.openScope()
 	p.next()
 	return p
 }
 
+// Diags returns the diagnostics reported by the lexer and the parser.
+func (p *Parser) Diags() *diag.List {
+	return p.diags
+}
+
+// errorf reports an error at token t and abandons the current statement
+// or declaration. Errors are not reported again until a token past the
+// recovery point is read, as those before it are usually caused by the
+// first one.
+func (p *Parser) errorf(t *token.Token, format string, a ...interface{}) {
+	if !p.stopped && !p.quiet {
+		p.quiet = true
+		p.diags.Errorf(t.Pos, t.End(), format, a...)
+		if p.ErrorLimit > 0 && p.diags.ErrorCount() >= p.ErrorLimit {
+			p.diags.Errorf(t.Pos, token.Position{}, "too many errors emitted, stopping now")
+			p.stopped = true
+		}
+	}
+	panic(bailout{})
+}
+
+// recover must be called with the value returned by the builtin recover.
+// It lets every panic other than bailout continue.
+func (p *Parser) recover(r interface{}) {
+	if _, ok := r.(bailout); !ok {
+		panic(r)
+	}
+}
+
+// resume marks the current token as the recovery point of the last
+// error. Errors are reported again once the token following it is read.
+func (p *Parser) resume() {
+	p.recovered = p.quiet
+}
+
+// sync skips tokens after a syntax error until parsing can resume:
+// after a ';' or the '}' of a skipped block, or before a token that starts
+// a declaration. Inside a block, the '}' closing it is not consumed.
+func (p *Parser) sync(topLevel bool) {
+	depth := 0
+	for !p.match(token.EOF) {
+		switch {
+		case p.match(token.LBRACE):
+			depth++
+		case p.match(token.RBRACE):
+			if depth == 0 && !topLevel {
+				return
+			}
+			depth--
+			if depth <= 0 {
+				p.next()
+				return
+			}
+		case p.match(token.SEMICOLON):
+			if depth == 0 {
+				p.next()
+				return
+			}
+		case depth == 0 && p.isType():
+			return
+		}
+		p.next()
+	}
+}
+
 func (p *Parser) match(t token.TokenKind) bool {
 	return p.token.Kind == t
 }
@@ -48,12 +145,18 @@ func (p *Parser) pop() {
 
 func (p *Parser) assert(t token.TokenKind) {
 	if !p.match(t) {
-		str := fmt.Sprintf("expected token is '"+t.String()+"', but got '"+p.token.String()+"' at line %d column %d", p.lexer.Pos().Line, p.lexer.Pos().Column)
-		panic(str)
+		p.errorf(p.token, "expected %s, but got %s", t.Symbol(), p.token.Describe())
 	}
 }
 
 func (p *Parser) next() {
+	if p.recovered {
+		p.quiet, p.recovered = false, false
+	}
+	if p.stopped {
+		p.token = &token.Token{Kind: token.EOF, Pos: p.token.Pos}
+		return
+	}
 	p.token = p.lexer.Next()
 }
 
@@ -61,57 +164,170 @@ func (p *Parser) IsEnd() bool {
 	return p.match(token.EOF)
 }
 
-func (p *Parser) Parse() ast.Node {
-	if p.isFuncDef() {
-		return p.readFuncDef()
-	} else if p.isType() {
-		return p.readVarDef()
-	} else {
-		panic("unexpected")
+// ParseFile reads top-level definitions until the end of the input.
+// Definitions containing syntax errors are returned as ast.BadDecl or
+// contain ast.BadStmt and ast.BadExpr nodes; the errors are in Diags.
+func (p *Parser) ParseFile() []ast.Node {
+	var nodes []ast.Node
+	for !p.IsEnd() {
+		nodes = append(nodes, p.Parse())
+	}
+	return nodes
+}
+
+// Parse reads one top-level definition. After a syntax error it skips
+// to the next definition and returns an ast.BadDecl.
+func (p *Parser) Parse() (n ast.Node) {
+	from := p.token.Pos
+	defer func() {
+		if r := recover(); r != nil {
+			p.recover(r)
+			p.sync(true)
+			p.resume()
+			if p.token.Pos == from {
+				p.next()
+			}
+			n = &ast.BadDecl{From: from, To: p.token.Pos}
+		}
+	}()
+
+	if !p.isType() {
+		p.errorf(p.token, "expected declaration, but got %s", p.token.Describe())
+	}
+	n = p.readDecl(true)
+	if f, ok := n.(*ast.FuncDef); ok && f.Block != nil {
+		return f
 	}
+	p.assert(token.SEMICOLON)
+	p.next()
+	return n
 }
 
 /**
 read def
 */
 
+// readVarDef reads a declaration without the ';' following it.
 func (p *Parser) readVarDef() ast.Node {
-	t := p.readType()
-
-	p.assert(token.IDENT)
-	tok := p.token
-	p.next()
-
-	var n ast.Node
-	if p.match(token.LBRACK) {
-
-		s := p.readSubscriptInit()
-		t.Array = true
-		arr := ast.ArrayDef{Type: t, Token: tok, Subscript: s}
+	return p.readDecl(false)
+}
+
+// readDecl reads a declaration without the ';', e.g.
+// "static int a = 1, *b, c[3]", which is returned as an ast.DeclList if
+// it has several declarators. At file scope, top is set and a function
+// declarator followed by '{' is read as a function definition.
+func (p *Parser) readDecl(top bool) ast.Node {
+	start := p.token
+	base, storage := p.readDeclSpec()
+	if (base.IsStruct() || base.Kind == ast.C_enum) && p.match(token.SEMICOLON) {
+		return &ast.TypeDecl{Type: base, Token: start}
+	}
 
-		if s == nil && !p.match(token.ASSIGN) {
-			panic(fmt.Errorf("definition of variable with array type needs an explicit size or an initializer"))
+	var list []ast.Node
+	for {
+		d := p.readDeclarator(namedDecl)
+		n := p.declNode(base, storage, d)
+		if f, ok := n.(*ast.FuncDef); ok && d.suffix != nil && p.match(token.LBRACE) {
+			if !top || len(list) > 0 {
+				p.errorf(p.token, "function definition is not allowed here")
+			}
+			p.funcBody(f, d.suffix)
+			return f
+		}
+		list = append(list, n)
+		if !p.match(token.COMMA) {
+			break
+		}
+		p.next()
+	}
+	if len(list) == 1 {
+		return list[0]
+	}
+	return &ast.DeclList{Token: start, List: list}
+}
+
+// declNode returns the declaration of d with the specified type base and
+// storage class, reading its initializer. The name is declared before
+// the initializer, which may refer to it.
+func (p *Parser) declNode(base *ast.CType, storage *token.Token, d *declarator) ast.Node {
+	t := d.derive(base)
+	static := storage != nil && storage.Kind == token.STATIC
+	extern := storage != nil && storage.Kind == token.EXTERN
+	if storage != nil && storage.Kind == token.TYPEDEF {
+		p.declareTypedef(d.name, t)
+		return &ast.TypeDecl{Type: t, Token: d.name, Name: d.name}
+	}
+	if storage != nil && (storage.Kind == token.AUTO || storage.Kind == token.REGISTER) {
+		switch {
+		case t.Kind == ast.C_func:
+			p.errorf(storage, "illegal storage class on function")
+		case len(p.names) == 1:
+			p.errorf(storage, "illegal storage class on file-scoped variable")
 		}
+	}
+	p.declareName(d.name)
 
+	switch t.Kind {
+	case ast.C_func:
+		if static && len(p.names) > 1 {
+			p.errorf(storage, "function declared in block scope cannot have 'static' storage class")
+		}
+		f := &ast.FuncDef{Type: t, Name: d.name.String(), Token: d.name, Static: static}
+		if d.suffix != nil {
+			f.Args = d.suffix.args
+		} else {
+			// declared with a typedef of a function type
+			for _, param := range t.Params {
+				f.Args = append(f.Args, ast.FuncArg{Type: param})
+			}
+		}
+		return f
+	case ast.C_array:
+		a := &ast.ArrayDef{Type: t, Token: d.name, Static: static, Extern: extern}
+		if d.suffix != nil {
+			a.Subscript = d.suffix.subscript
+		}
+		if t.Len < 0 && a.Subscript == nil && !extern && !p.match(token.ASSIGN) {
+			p.errorf(d.name, "definition of variable with array type needs an explicit size or an initializer")
+		}
 		if p.match(token.ASSIGN) {
 			p.next()
-			init := p.readArrayInit()
-			arr.Init = &init
-			// obj.IsInit = true
+			if p.match(token.STRING_CONST) {
+				// "abc" initializes a char array like {"abc"}
+				a.Init = &ast.ArrayInit{Token: p.token, List: []ast.Expr{p.stringVal()}}
+			} else {
+				a.Init = p.readArrayInit()
+			}
 		}
-		n = arr
-	} else {
-		v := ast.VarDef{Type: t, Token: tok}
+		return a
+	}
 
-		if p.match(token.ASSIGN) {
-			p.next()
-			e := p.assignExpr()
-			v.Init = &e
+	v := &ast.VarDef{Type: t, Token: d.name, Static: static, Extern: extern}
+	if p.match(token.ASSIGN) {
+		p.next()
+		var e ast.Expr
+		if p.match(token.LBRACE) {
+			e = p.readArrayInit()
+		} else {
+			e = p.assignExpr()
 		}
-		n = v
+		v.Init = &e
 	}
+	return v
+}
 
-	return n
+// funcBody reads the body of the function f declared by the parameter
+// list s. The parameters are declared in a scope enclosing the body.
+func (p *Parser) funcBody(f *ast.FuncDef, s *suffix) {
+	if s.unnamed != nil {
+		p.errorf(s.unnamed, "parameter name omitted")
+	}
+	p.openScope()
+	defer p.closeScope()
+	for _, a := range f.Args {
+		p.declareName(a.Name)
+	}
+	f.Block = p.blockStmt()
 }
 
 // [0] []
@@ -132,170 +348,694 @@ func (p *Parser) readSubscriptInit() *ast.Expr {
 	return &e
 }
 
-func (p *Parser) readArrayInit() ast.ArrayInit {
+// readArrayInit reads a brace-enclosed initializer list, whose elements
+// may be lists themselves. The last element may be followed by a comma.
+func (p *Parser) readArrayInit() *ast.ArrayInit {
 	p.assert(token.LBRACE)
+	n := &ast.ArrayInit{Token: p.token}
 	p.next()
-	n := ast.ArrayInit{}
 	for {
-		e := p.assignExpr()
-		n.List = append(n.List, e)
+		if p.match(token.LBRACE) {
+			n.List = append(n.List, p.readArrayInit())
+		} else {
+			n.List = append(n.List, p.assignExpr())
+		}
 		if p.match(token.RBRACE) {
 			break
 		} else if p.match(token.COMMA) {
 			p.next()
+			if p.match(token.RBRACE) {
+				break
+			}
 		} else {
-			panic("expected } or ,")
+			p.errorf(p.token, "expected '}' or ',', but got %s", p.token.Describe())
 		}
 	}
 	p.next()
 	return n
 }
 
+// stringVal reads a string literal and concatenates the adjacent ones.
+func (p *Parser) stringVal() *ast.StringVal {
+	n := &ast.StringVal{Token: p.token}
+	for p.match(token.STRING_CONST) {
+		n.Val = append(n.Val, p.token.Str...)
+		p.next()
+	}
+	return n
+}
+
+// isType reports whether the current token starts declaration specifiers.
+// An identifier does if it is a typedef name.
 func (p *Parser) isType() bool {
-	return p.matchs([]token.TokenKind{token.INT, token.CHAR, token.VOID, token.FLOAT, token.LONG, token.SHORT, token.DOUBLE})
+	return p.matchs(typeSpecifiers) || p.matchs(typeQualifiers) || p.matchs(storageSpecifiers) ||
+		p.typedefName(p.token) != nil
+}
+
+// readType reads a type name, which is a type specifier with qualifiers
+// followed by an abstract declarator, e.g. "const char *const *" or
+// "int (*)[3]".
+func (p *Parser) readType() *ast.CType {
+	t := p.readSpecifier()
+	return p.readDeclarator(abstractDecl).derive(t)
+}
+
+// readSpecifier reads declaration specifiers without a storage class.
+func (p *Parser) readSpecifier() *ast.CType {
+	t, storage := p.readDeclSpec()
+	if storage != nil {
+		p.errorf(storage, "type name does not allow storage class to be specified")
+	}
+	return t
 }
 
-func (p *Parser) readType() ast.CType {
-	var t ast.CType
+// readDeclSpec reads declaration specifiers, which are a type specifier
+// with qualifiers and an optional storage class, e.g. "static const int"
+// or "unsigned long long". The keywords may appear in any order.
+func (p *Parser) readDeclSpec() (*ast.CType, *token.Token) {
+	var spec specifier
+	var storage *token.Token
+	var c, v bool
 	for {
-		if p.isType() {
-			switch p.token.Kind {
-			case token.INT:
-				t.Primitive = ast.C_int
-			case token.CHAR:
-				t.Primitive = ast.C_char
-			case token.VOID:
-				t.Primitive = ast.C_void
-			case token.FLOAT:
-				t.Primitive = ast.C_float
-			case token.LONG:
-				t.Primitive = ast.C_long
-			case token.SHORT:
-				t.Primitive = ast.C_short
-			case token.DOUBLE:
-				t.Primitive = ast.C_double
-			default:
-				panic("readType")
+		tok := p.token
+		switch {
+		case p.matchs(storageSpecifiers):
+			if storage != nil && storage.Kind == tok.Kind {
+				p.diags.Warnf(tok.Pos, tok.End(), "duplicate '%s' declaration specifier", tok)
+			} else if storage != nil {
+				p.errorf(tok, "cannot combine with previous '%s' declaration specifier", storage)
 			}
-		} else if p.match(token.MUL) { // * as pointer
-			t.Ptr = true
-		} else {
-			break
+			storage = tok
+		case p.match(token.CONST):
+			c = true
+		case p.match(token.VOLATILE):
+			v = true
+		case p.match(token.STRUCT) || p.match(token.UNION):
+			p.addSpecifier(&spec, tok)
+			spec.record = p.readStructType()
+			continue
+		case p.match(token.ENUM):
+			p.addSpecifier(&spec, tok)
+			spec.record = p.readEnumType()
+			continue
+		case p.matchs(typeSpecifiers):
+			p.addSpecifier(&spec, tok)
+		case spec.base == nil && spec.size == nil && spec.sign == nil && p.typedefName(tok) != nil:
+			// after a type specifier, a typedef name is redeclared
+			spec.base = tok
+			spec.record = p.typedefName(tok)
+		default:
+			return spec.Type().Qualified(c, v), storage
 		}
 		p.next()
 	}
-	return t
 }
 
-func (p *Parser) isFuncDef() bool {
+// specifier collects the type specifier keywords of a declaration.
+type specifier struct {
+	base   *token.Token // void, char, int, float, double, struct, union, enum or a typedef name
+	size   *token.Token // short or the first long
+	long   int
+	sign   *token.Token // signed or unsigned
+	record *ast.CType   // the struct, union, enum or typedef type
+}
+
+func (p *Parser) addSpecifier(s *specifier, tok *token.Token) {
+	conflict := func(prev *token.Token) {
+		p.errorf(tok, "cannot combine with previous '%s' declaration specifier", prev)
+	}
+	switch tok.Kind {
+	case token.INT:
+		if s.base != nil {
+			conflict(s.base)
+		}
+		s.base = tok
+	case token.CHAR:
+		switch {
+		case s.base != nil:
+			conflict(s.base)
+		case s.size != nil:
+			conflict(s.size)
+		}
+		s.base = tok
+	case token.SHORT:
+		switch {
+		case s.size != nil:
+			conflict(s.size)
+		case s.base != nil && s.base.Kind != token.INT:
+			conflict(s.base)
+		}
+		s.size = tok
+	case token.LONG:
+		switch {
+		case s.size != nil && s.size.Kind == token.SHORT:
+			conflict(s.size)
+		case s.long == 2:
+			p.errorf(tok, "'long long long' is invalid")
+		case s.base != nil && s.base.Kind == token.DOUBLE && s.long > 0:
+			conflict(s.size)
+		case s.base != nil && s.base.Kind != token.INT && s.base.Kind != token.DOUBLE:
+			conflict(s.base)
+		}
+		if s.size == nil {
+			s.size = tok
+		}
+		s.long++
+	case token.SIGNED, token.UNSIGNED:
+		switch {
+		case s.sign != nil && s.sign.Kind != tok.Kind:
+			conflict(s.sign)
+		case s.base != nil && s.base.Kind != token.INT && s.base.Kind != token.CHAR:
+			conflict(s.base)
+		}
+		s.sign = tok
+	default: // void, _Bool, float, double, struct, union and enum
+		switch {
+		case s.base != nil:
+			conflict(s.base)
+		case s.size != nil && (tok.Kind != token.DOUBLE || s.size.Kind != token.LONG || s.long > 1):
+			conflict(s.size)
+		case s.sign != nil:
+			conflict(s.sign)
+		}
+		s.base = tok
+	}
+}
+
+// Type returns the type named by the collected keywords. A missing
+// type specifier means int.
+func (s *specifier) Type() *ast.CType {
+	unsigned := s.sign != nil && s.sign.Kind == token.UNSIGNED
+	if s.base != nil {
+		switch s.base.Kind {
+		case token.VOID:
+			return ast.VoidType
+		case token.BOOL:
+			return ast.BoolType
+		case token.FLOAT:
+			return ast.FloatType
+		case token.DOUBLE:
+			if s.size != nil {
+				return ast.LongDoubleType
+			}
+			return ast.DoubleType
+		case token.STRUCT, token.UNION, token.ENUM, token.IDENT:
+			return s.record
+		case token.CHAR:
+			if unsigned {
+				return ast.UCharType
+			}
+			return ast.CharType
+		}
+	}
+	switch {
+	case s.size == nil && unsigned:
+		return ast.UIntType
+	case s.size == nil:
+		return ast.IntType
+	case s.size.Kind == token.SHORT && unsigned:
+		return ast.UShortType
+	case s.size.Kind == token.SHORT:
+		return ast.ShortType
+	case unsigned:
+		return ast.ULongType
+	}
+	return ast.LongType
+}
+
+// declMode tells which declarators readDeclarator accepts.
+type declMode int
+
+const (
+	namedDecl    declMode = iota // declaring a name, e.g. "*p[3]"
+	abstractDecl                 // in a type name, e.g. "*[3]"
+	paramDecl                    // in a parameter declaration, either
+)
+
+// declarator is a declarator read by readDeclarator.
+type declarator struct {
+	name   *token.Token                // nil for an abstract declarator
+	derive func(*ast.CType) *ast.CType // derives the declared type from the specified one
+
+	// suffix derives the declared type, or is nil if a pointer or the
+	// specified type is declared. done is set once that is known.
+	suffix *suffix
+	done   bool
+}
+
+// suffix is an array or function declarator suffix, "[n]" or "(params)".
+type suffix struct {
+	token     *token.Token // '[' or '('
+	subscript *ast.Expr    // nil for "[]"
+	args      []ast.FuncArg
+	unnamed   *token.Token // following the first unnamed parameter
+}
+
+// readDeclarator reads a declarator, e.g. "*const p", "a[2][3]" or
+// "(*f)(int)", or an abstract one like "(*)[3]". Its type is derived
+// from the specified one by the pointers, then the array and function
+// suffixes from the last one to the first, then the declarator nested in
+// parentheses; "*(*f)(int)" is a pointer to a function returning a
+// pointer.
+func (p *Parser) readDeclarator(mode declMode) *declarator {
+	d := &declarator{}
+	var ptrs []*ast.CType // each qualified like the pointer
+	for p.match(token.MUL) {
+		p.next()
+		q := ast.VoidType
+		for p.match(token.CONST) || p.match(token.VOLATILE) {
+			q = q.Qualified(p.match(token.CONST), p.match(token.VOLATILE))
+			p.next()
+		}
+		ptrs = append(ptrs, q)
+	}
+
+	var inner *declarator
+	switch {
+	case p.match(token.LPAREN) && p.isNested(mode):
+		p.next()
+		inner = p.readDeclarator(mode)
+		p.assert(token.RPAREN)
+		p.next()
+		d.name = inner.name
+	case p.match(token.IDENT) && mode != abstractDecl:
+		d.name = p.token
+		p.next()
+	case mode == namedDecl:
+		p.errorf(p.token, "expected identifier or '(', but got %s", p.token.Describe())
+	}
+
+	var suffixes []*suffix
+	var derives []func(*ast.CType) *ast.CType
+	for p.match(token.LBRACK) || p.match(token.LPAREN) {
+		s := &suffix{token: p.token}
+		if p.match(token.LBRACK) {
+			s.subscript = p.readSubscriptInit()
+			derives = append(derives, p.arrayOf(d.name, s))
+		} else {
+			p.next()
+			var variadic bool
+			noProto := p.match(token.RPAREN)
+			s.args, variadic, s.unnamed = p.readFuncArgs()
+			p.assert(token.RPAREN)
+			p.next()
+			derives = append(derives, p.funcOf(s, variadic, noProto))
+		}
+		suffixes = append(suffixes, s)
+	}
+
+	d.derive = func(t *ast.CType) *ast.CType {
+		for _, q := range ptrs {
+			t = ast.PointerTo(t).Qualified(q.Const, q.Volatile)
+		}
+		for i := len(derives) - 1; i >= 0; i-- {
+			t = derives[i](t)
+		}
+		if inner != nil {
+			t = inner.derive(t)
+		}
+		return t
+	}
+	switch {
+	case inner != nil && inner.done:
+		d.suffix, d.done = inner.suffix, true
+	case len(suffixes) > 0:
+		d.suffix, d.done = suffixes[0], true
+	case len(ptrs) > 0:
+		d.done = true
+	}
+	return d
+}
+
+// isNested reports whether the '(' at the current token starts a nested
+// declarator rather than a parameter list, which can only follow a name
+// or start an abstract declarator.
+func (p *Parser) isNested(mode declMode) bool {
+	if mode == namedDecl {
+		return true
+	}
 	p.push()
 	defer p.pop()
+	p.next()
+	switch {
+	case p.match(token.MUL), p.match(token.LPAREN), p.match(token.LBRACK):
+		return true
+	case p.match(token.IDENT):
+		// a typedef name starts a parameter declaration
+		return mode == paramDecl && p.typedefName(p.token) == nil
+	}
+	return false
+}
 
-	var isFunc bool
-loop:
-	for {
+// arrayOf returns the derivation of an array by the suffix s of the
+// declarator of name.
+func (p *Parser) arrayOf(name *token.Token, s *suffix) func(*ast.CType) *ast.CType {
+	n := -1
+	if s.subscript != nil {
+		// sizes depending on declarations are computed by sema
+		i, ok := ast.IntConst(*s.subscript)
 		switch {
-		case p.match(token.RPAREN):
-			p.next()
-			if p.match(token.LBRACE) {
-				isFunc = true
-				break loop
+		case ok && i >= 0:
+			n = i
+		case ok && name == nil:
+			p.errorf(s.token, "array size is negative")
+		case ok:
+			p.errorf(s.token, "'%s' declared as an array with a negative size", name)
+		}
+	}
+	return func(t *ast.CType) *ast.CType {
+		if t.Kind == ast.C_func {
+			what := "type name"
+			if name != nil {
+				what = name.String()
 			}
-		case p.match(token.SEMICOLON):
-			break loop
-		default:
-			p.next()
+			p.errorf(s.token, "'%s' declared as array of functions of type '%s'", what, t)
 		}
+		return ast.ArrayOf(t, n)
+	}
+}
 
-		if p.match(token.EOF) {
-			break loop
+// funcOf returns the derivation of a function by the suffix s. Empty
+// parentheses declare no prototype, unlike (void).
+func (p *Parser) funcOf(s *suffix, variadic, noProto bool) func(*ast.CType) *ast.CType {
+	params := make([]*ast.CType, len(s.args))
+	for i, a := range s.args {
+		params[i] = a.Type
+	}
+	return func(t *ast.CType) *ast.CType {
+		switch t.Kind {
+		case ast.C_array:
+			p.errorf(s.token, "function cannot return array type '%s'", t)
+		case ast.C_func:
+			p.errorf(s.token, "function cannot return function type '%s'", t)
 		}
+		f := ast.FuncOf(t, params, variadic)
+		f.NoProto = noProto
+		return f
 	}
-	return isFunc
 }
 
-func (p *Parser) readFuncDef() ast.FuncDef {
-	t := p.readType()
+// openScope opens the scope of a block, where tags and typedef names may
+// be declared.
+func (p *Parser) openScope() {
+	p.tags = append(p.tags, map[string]*ast.CType{})
+	p.names = append(p.names, map[string]ordinary{})
+}
 
-	p.assert(token.IDENT)
-	name := string(p.token.Str)
-	p.next()
+func (p *Parser) closeScope() {
+	p.tags = p.tags[:len(p.tags)-1]
+	p.names = p.names[:len(p.names)-1]
+}
 
-	p.assert(token.LPAREN)
-	p.next()
+// declareName declares an ordinary identifier other than a typedef name,
+// which hides the typedef names of the enclosing scopes.
+func (p *Parser) declareName(name *token.Token) {
+	if name == nil {
+		return
+	}
+	scope := p.names[len(p.names)-1]
+	if scope[name.String()].typedef != nil {
+		p.errorf(name, "redefinition of '%s' as different kind of symbol", name)
+	}
+	scope[name.String()] = ordinary{}
+}
 
-	args := p.readFuncArgs()
+// declareConst declares the enumeration constant name with the value
+// of obj, so that it can size arrays in declarations.
+func (p *Parser) declareConst(name *token.Token, obj *ast.Object) {
+	p.declareName(name)
+	p.names[len(p.names)-1][name.String()] = ordinary{enum: obj}
+}
 
-	p.assert(token.RPAREN)
-	p.next()
+// declareTypedef declares name as a typedef name for t. It may be
+// declared again in the same scope as the same type.
+func (p *Parser) declareTypedef(name *token.Token, t *ast.CType) {
+	scope := p.names[len(p.names)-1]
+	prev, ok := scope[name.String()]
+	switch {
+	case ok && prev.typedef == nil:
+		p.errorf(name, "redefinition of '%s' as different kind of symbol", name)
+	case ok && !ast.Compatible(prev.typedef, t):
+		p.errorf(name, "typedef redefinition with different types ('%s' vs '%s')", t, prev.typedef)
+	}
+	scope[name.String()] = ordinary{typedef: t}
+}
 
-	block := p.blockStmt()
+// typedefName returns the type named by tok if it is an identifier
+// declared as a typedef name, or nil.
+func (p *Parser) typedefName(tok *token.Token) *ast.CType {
+	if tok.Kind != token.IDENT {
+		return nil
+	}
+	return p.lookupName(tok).typedef
+}
 
-	return ast.FuncDef{Type: t, Name: name, Args: args, Block: block}
+// lookupName finds what the parser knows of the ordinary identifier tok.
+func (p *Parser) lookupName(tok *token.Token) ordinary {
+	for i := len(p.names) - 1; i >= 0; i-- {
+		if o, ok := p.names[i][tok.String()]; ok {
+			return o
+		}
+	}
+	return ordinary{}
 }
 
-func (p *Parser) readFuncArgs() []ast.FuncArg {
-	var res []ast.FuncArg
-	for p.isType() {
-		res = append(res, p.readFuncArg())
-		if !p.match(token.COMMA) {
+// lookupTag finds the struct, union or enum named tag, in the innermost
+// block only if local is set.
+func (p *Parser) lookupTag(tag string, local bool) *ast.CType {
+	for i := len(p.tags) - 1; i >= 0; i-- {
+		if t, ok := p.tags[i][tag]; ok {
+			return t
+		}
+		if local {
 			break
 		}
-		p.next()
 	}
-	return res
+	return nil
 }
 
-func (p *Parser) readFuncArg() ast.FuncArg {
-	var n ast.FuncArg
-	n.Type = p.readType()
+// readStructType reads a struct or union specifier:
+//
+//	struct tag
+//	struct tag { members }
+//	struct { members }
+func (p *Parser) readStructType() *ast.CType {
+	kw := p.token
+	union := p.match(token.UNION)
+	p.next()
+
+	var tag *token.Token
+	if p.match(token.IDENT) {
+		tag = p.token
+		p.next()
+	} else if !p.match(token.LBRACE) {
+		p.errorf(p.token, "expected identifier or '{', but got %s", p.token.Describe())
+	}
+
+	var s *ast.StructType
+	if tag != nil {
+		// a definition or a forward declaration "struct S;" declares
+		// a new type in the current block
+		local := p.match(token.LBRACE) || p.match(token.SEMICOLON)
+		if t := p.lookupTag(tag.String(), local); t != nil {
+			if !t.IsStruct() || t.Struct.Union != union {
+				p.errorf(kw, "use of '%s' with tag type that does not match previous declaration", tag)
+			}
+			s = t.Struct
+		}
+	}
+	if s == nil {
+		s = &ast.StructType{Tag: tag, Union: union}
+		if tag != nil {
+			p.tags[len(p.tags)-1][tag.String()] = ast.StructOf(s)
+		}
+	}
 
-	p.assert(token.IDENT)
-	n.Name = p.token
+	if p.match(token.LBRACE) {
+		if s.Complete {
+			p.errorf(tag, "redefinition of '%s'", tag)
+		}
+		p.next()
+		s.Fields = nil
+		for !p.match(token.RBRACE) {
+			p.readFields(s)
+		}
+		p.next()
+		s.Layout()
+	}
+	return ast.StructOf(s)
+}
+
+// readEnumType reads an enum specifier:
+//
+//	enum tag
+//	enum tag { A, B = 2, C }
+//	enum { A, B }
+//
+// The values of the constants are computed by sema.
+func (p *Parser) readEnumType() *ast.CType {
+	kw := p.token
 	p.next()
 
-	return n
-}
+	var tag *token.Token
+	if p.match(token.IDENT) {
+		tag = p.token
+		p.next()
+	} else if !p.match(token.LBRACE) {
+		p.errorf(p.token, "expected identifier or '{', but got %s", p.token.Describe())
+	}
 
-/**
-expression
-*/
+	var e *ast.EnumType
+	if tag != nil {
+		local := p.match(token.LBRACE) || p.match(token.SEMICOLON)
+		if t := p.lookupTag(tag.String(), local); t != nil {
+			if t.Kind != ast.C_enum {
+				p.errorf(kw, "use of '%s' with tag type that does not match previous declaration", tag)
+			}
+			e = t.Enum
+		}
+	}
+	if e == nil {
+		e = &ast.EnumType{Tag: tag}
+		if tag != nil {
+			p.tags[len(p.tags)-1][tag.String()] = ast.EnumOf(e)
+		}
+	}
 
-func (p *Parser) expr() ast.Expr {
-	return p.assignExpr()
+	if p.match(token.LBRACE) {
+		if e.Complete {
+			p.errorf(tag, "redefinition of '%s'", tag)
+		}
+		p.next()
+		if p.match(token.RBRACE) {
+			p.errorf(p.token, "use of empty enum")
+		}
+		next, known := 0, true
+		for !p.match(token.RBRACE) {
+			p.assert(token.IDENT)
+			c := &ast.Enumerator{Name: p.token}
+			p.next()
+			if p.match(token.ASSIGN) {
+				p.next()
+				v := p.conditionalExpr()
+				c.Value = &v
+				next, known = ast.IntConst(v)
+			}
+			if known {
+				p.declareConst(c.Name, &ast.Object{Kind: ast.ConstObj, Name: c.Name.String(), Type: ast.IntType, Decl: c, Value: next})
+				next++
+			} else {
+				p.declareName(c.Name)
+			}
+			e.Consts = append(e.Consts, c)
+			if !p.match(token.COMMA) {
+				break
+			}
+			p.next()
+		}
+		p.assert(token.RBRACE)
+		p.next()
+		e.Complete = true
+	}
+	return ast.EnumOf(e)
 }
 
-func (p *Parser) assignExpr() ast.Expr {
-	p.push()
+// readFields reads one member declaration, e.g. "int a, *b, c[4];".
+func (p *Parser) readFields(s *ast.StructType) {
+	if !p.isType() {
+		p.errorf(p.token, "expected member declaration, but got %s", p.token.Describe())
+	}
+	base := p.readSpecifier()
+	for {
+		d := p.readDeclarator(namedDecl)
+		f := &ast.Field{Name: d.name, Type: d.derive(base)}
+		switch {
+		case f.Type.IsArray() && f.Type.Len < 0 && d.suffix != nil && d.suffix.subscript == nil:
+			p.errorf(d.suffix.token, "flexible array members are not supported")
+		case f.Type.IsArray() && f.Type.Len < 0 && d.suffix != nil:
+			p.errorf(d.suffix.token, "array size must be an integer constant")
+		case f.Type.Kind == ast.C_func:
+			p.errorf(f.Name, "field '%s' declared as a function", f.Name)
+		}
 
-	var hasAssign bool
-	for !p.match(token.SEMICOLON) {
-		if p.match(token.ASSIGN) {
-			hasAssign = true
+		if s.Field(f.Name.String()) != nil {
+			p.errorf(f.Name, "duplicate member '%s'", f.Name)
+		}
+		if !f.Type.IsComplete() {
+			p.errorf(f.Name, "field has incomplete type '%s'", f.Type)
+		}
+		s.Fields = append(s.Fields, f)
+
+		if !p.match(token.COMMA) {
 			break
 		}
 		p.next()
+	}
+	p.assert(token.SEMICOLON)
+	p.next()
+}
 
-		if p.match(token.EOF) {
+// readFuncArgs reads a parameter list, which may end with "...". The
+// parameters of a declaration may be unnamed, and "(void)" declares none.
+// unnamed is the token following the first unnamed parameter.
+func (p *Parser) readFuncArgs() (args []ast.FuncArg, variadic bool, unnamed *token.Token) {
+	for p.isType() {
+		a := p.readFuncArg()
+		if a.Name == nil {
+			if len(args) == 0 && a.Type.Kind == ast.C_void && p.match(token.RPAREN) {
+				return nil, false, nil
+			}
+			if unnamed == nil {
+				unnamed = p.token
+			}
+		}
+		args = append(args, a)
+		if !p.match(token.COMMA) {
+			break
+		}
+		p.next()
+		if p.match(token.ELLIPSIS) {
+			p.next()
+			variadic = true
 			break
 		}
 	}
+	return args, variadic, unnamed
+}
 
-	p.pop()
+// readFuncArg reads a parameter declaration. A parameter declared as an
+// array or a function is a pointer, e.g. char *argv[].
+func (p *Parser) readFuncArg() ast.FuncArg {
+	t, storage := p.readDeclSpec()
+	if storage != nil && storage.Kind != token.REGISTER {
+		p.errorf(storage, "invalid storage class specifier in function declarator")
+	}
+	d := p.readDeclarator(paramDecl)
+	n := ast.FuncArg{Type: d.derive(t), Name: d.name}
+	switch n.Type.Kind {
+	case ast.C_array:
+		n.Type = ast.PointerTo(n.Type.Elem())
+	case ast.C_func:
+		n.Type = ast.PointerTo(n.Type)
+	}
+	return n
+}
 
-	if hasAssign {
-		L := p.unaryExpr()
-		if !p.isAssignOp() {
-			panic("expected assign operator")
-		}
-		op := p.token
-		p.next()
-		R := p.assignExpr()
-		n := ast.AssignExpr{L: L, Op: op, R: R}
-		return n
-	} else {
-		return p.conditionalExpr()
+func (p *Parser) expr() ast.Expr {
+	return p.assignExpr()
+}
+
+// assignExpr reads a conditional expression or an assignment. The left
+// operand of an assignment is read as a conditional expression as well;
+// sema reports it if it is not an lvalue.
+func (p *Parser) assignExpr() ast.Expr {
+	e := p.conditionalExpr()
+	if !p.isAssignOp() {
+		return e
 	}
+	op := p.token
+	p.next()
+	return &ast.AssignExpr{L: e, Op: op, R: p.assignExpr()}
 }
 
 func (p *Parser) isAssignOp() bool {
@@ -309,7 +1049,7 @@ func (p *Parser) conditionalExpr() ast.Expr {
 		L := p.expr()
 		p.assert(token.COLON)
 		p.next()
-		n := ast.CondExpr{Cond: e, L: L, R: p.conditionalExpr()}
+		n := &ast.CondExpr{Cond: e, L: L, R: p.conditionalExpr()}
 		return n
 	}
 	return e
@@ -324,7 +1064,7 @@ func (p *Parser) logOrExpr2(e ast.Expr) ast.Expr {
 	if p.match(token.LOR) {
 		op := p.token
 		p.next()
-		n := ast.BinaryExpr{X: e, Op: op, Y: p.logAndExpr()}
+		n := &ast.BinaryExpr{X: e, Op: op, Y: p.logAndExpr()}
 		return p.logOrExpr2(n)
 	}
 	return e
@@ -339,7 +1079,7 @@ func (p *Parser) logAndExpr2(e ast.Expr) ast.Expr {
 	if p.match(token.LAND) {
 		op := p.token
 		p.next()
-		n := ast.BinaryExpr{X: e, Op: op, Y: p.incOrExpr()}
+		n := &ast.BinaryExpr{X: e, Op: op, Y: p.incOrExpr()}
 		return p.logAndExpr2(n)
 	}
 	return e
@@ -354,7 +1094,7 @@ func (p *Parser) incOrExpr2(e ast.Expr) ast.Expr {
 	if p.match(token.OR) {
 		op := p.token
 		p.next()
-		n := ast.BinaryExpr{X: e, Op: op, Y: p.excOrExpr()}
+		n := &ast.BinaryExpr{X: e, Op: op, Y: p.excOrExpr()}
 		return p.incOrExpr2(n)
 	}
 	return e
@@ -369,7 +1109,7 @@ func (p *Parser) excOrExpr2(e ast.Expr) ast.Expr {
 	if p.match(token.XOR) {
 		op := p.token
 		p.next()
-		n := ast.BinaryExpr{X: e, Op: op, Y: p.andExpr()}
+		n := &ast.BinaryExpr{X: e, Op: op, Y: p.andExpr()}
 		return p.excOrExpr2(n)
 	}
 	return e
@@ -384,7 +1124,7 @@ func (p *Parser) andExpr2(e ast.Expr) ast.Expr {
 	if p.match(token.AND) {
 		op := p.token
 		p.next()
-		n := ast.BinaryExpr{X: e, Op: op, Y: p.eqExpr()}
+		n := &ast.BinaryExpr{X: e, Op: op, Y: p.eqExpr()}
 		return p.andExpr2(n)
 	}
 	return e
@@ -399,7 +1139,7 @@ func (p *Parser) eqExpr2(e ast.Expr) ast.Expr {
 	if p.match(token.EQ) || p.match(token.NE) {
 		op := p.token
 		p.next()
-		n := ast.BinaryExpr{X: e, Op: op, Y: p.relExpr()}
+		n := &ast.BinaryExpr{X: e, Op: op, Y: p.relExpr()}
 		return p.eqExpr2(n)
 	}
 	return e
@@ -414,7 +1154,7 @@ func (p *Parser) relExpr2(e ast.Expr) ast.Expr {
 	if p.match(token.LT) || p.match(token.GT) || p.match(token.LE) || p.match(token.GE) {
 		op := p.token
 		p.next()
-		n := ast.BinaryExpr{X: e, Op: op, Y: p.shiftExpr()}
+		n := &ast.BinaryExpr{X: e, Op: op, Y: p.shiftExpr()}
 		return p.relExpr2(n)
 	}
 	return e
@@ -429,7 +1169,7 @@ func (p *Parser) shiftExpr2(e ast.Expr) ast.Expr {
 	if p.match(token.LSHIFT) || p.match(token.RSHIFT) {
 		op := p.token
 		p.next()
-		n := ast.BinaryExpr{X: e, Op: op, Y: p.additiveExpr()}
+		n := &ast.BinaryExpr{X: e, Op: op, Y: p.additiveExpr()}
 		return p.shiftExpr2(n)
 	}
 	return e
@@ -444,7 +1184,7 @@ func (p *Parser) additiveExpr2(e ast.Expr) ast.Expr {
 	if p.match(token.ADD) || p.match(token.SUB) {
 		op := p.token
 		p.next()
-		n := ast.BinaryExpr{X: e, Op: op, Y: p.multiExpr()}
+		n := &ast.BinaryExpr{X: e, Op: op, Y: p.multiExpr()}
 		return p.additiveExpr2(n)
 	}
 	return e
@@ -459,46 +1199,105 @@ func (p *Parser) multiExpr2(e ast.Expr) ast.Expr {
 	if p.match(token.MUL) || p.match(token.DIV) || p.match(token.REM) {
 		op := p.token
 		p.next()
-		n := ast.BinaryExpr{X: e, Op: op, Y: p.castExpr()}
+		n := &ast.BinaryExpr{X: e, Op: op, Y: p.castExpr()}
 		return p.multiExpr2(n)
 	}
 	return e
 }
 
+// castExpr reads a cast "(T)x" or a unary expression.
 func (p *Parser) castExpr() ast.Expr {
-	return p.unaryExpr()
+	if !p.match(token.LPAREN) || !p.isTypeName() {
+		return p.unaryExpr()
+	}
+	n := &ast.CastExpr{Lparen: p.token}
+	p.next()
+	n.To = p.readType()
+	p.assert(token.RPAREN)
+	p.next()
+	if p.match(token.LBRACE) {
+		p.errorf(p.token, "compound literals are not supported")
+	}
+	n.X = p.castExpr()
+	return n
+}
+
+// isTypeName reports whether the '(' at the current token starts a type
+// name in parentheses rather than an expression.
+func (p *Parser) isTypeName() bool {
+	p.push()
+	defer p.pop()
+	p.next()
+	return p.isType()
+}
+
+// sizeofExpr reads "sizeof x", "sizeof(T)" or "_Alignof(T)".
+func (p *Parser) sizeofExpr() *ast.SizeofExpr {
+	n := &ast.SizeofExpr{Token: p.token}
+	p.next()
+	if p.match(token.LPAREN) && p.isTypeName() {
+		p.next()
+		n.Of = p.readType()
+		p.assert(token.RPAREN)
+		p.next()
+	} else {
+		n.X = p.unaryExpr()
+	}
+	return n
+}
+
+// vaStart reads "__builtin_va_start(ap, last)".
+func (p *Parser) vaStart() *ast.VaStartExpr {
+	n := &ast.VaStartExpr{Token: p.token}
+	p.next()
+	p.assert(token.LPAREN)
+	p.next()
+	n.Ap = p.assignExpr()
+	p.assert(token.COMMA)
+	p.next()
+	n.Last = p.assignExpr()
+	p.assert(token.RPAREN)
+	p.next()
+	return n
+}
+
+// vaArg reads "__builtin_va_arg(ap, T)".
+func (p *Parser) vaArg() *ast.VaArgExpr {
+	n := &ast.VaArgExpr{Token: p.token}
+	p.next()
+	p.assert(token.LPAREN)
+	p.next()
+	n.Ap = p.assignExpr()
+	p.assert(token.COMMA)
+	p.next()
+	n.To = p.readType()
+	p.assert(token.RPAREN)
+	p.next()
+	return n
 }
 
 func (p *Parser) unaryExpr() ast.Expr {
 	if p.match(token.INC) {
+		op := p.token
 		p.next()
-		i, ok := p.unaryExpr().(ast.Ident)
-		if !ok {
-			panic("unimplemented not ident increment")
-		}
-		return ast.IncExpr{Ident: i}
+		return &ast.IncExpr{Op: op, X: p.unaryExpr()}
 	} else if p.match(token.DEC) {
+		op := p.token
 		p.next()
-		i, ok := p.unaryExpr().(ast.Ident)
-		if !ok {
-			panic("unimplemented not ident decrement")
-		}
-		return ast.DecExpr{Ident: i}
+		return &ast.DecExpr{Op: op, X: p.unaryExpr()}
+	} else if p.match(token.SIZEOF) || p.match(token.ALIGNOF) {
+		return p.sizeofExpr()
 	} else if p.isUnaryOp() {
 		op := p.token
 		p.next()
 
 		switch op.Kind {
 		case token.MUL:
-			pv := ast.PtrVal{Token: p.token}
-			p.next()
-			return pv
+			return &ast.PtrVal{Token: op, X: p.castExpr()}
 		case token.AND:
-			av := ast.AddressVal{Token: p.token}
-			p.next()
-			return av
+			return &ast.AddressVal{Token: op, X: p.castExpr()}
 		default:
-			return ast.UnaryExpr{Op: op, Expr: p.castExpr()}
+			return &ast.UnaryExpr{Op: op, Expr: p.castExpr()}
 		}
 	} else {
 		return p.postfixExpr()
@@ -516,73 +1315,68 @@ func (p *Parser) postfixExpr() ast.Expr {
 
 func (p *Parser) postfixExpr2(e ast.Expr) ast.Expr {
 	if p.match(token.INC) {
+		n := &ast.IncExpr{Op: p.token, X: e, Postfix: true}
 		p.next()
-		i, ok := e.(ast.Ident)
-		if !ok {
-			panic("unimplemented not ident increment")
-		}
-		return ast.IncExpr{Ident: i}
+		return p.postfixExpr2(n)
 	} else if p.match(token.DEC) {
+		n := &ast.DecExpr{Op: p.token, X: e, Postfix: true}
 		p.next()
-		i, ok := e.(ast.Ident)
-		if !ok {
-			panic("unimplemented not ident decrement")
-		}
-		return ast.DecExpr{Ident: i}
+		return p.postfixExpr2(n)
+	} else if p.match(token.LBRACK) {
+		return p.postfixExpr2(p.readSubscriptExpr(e))
 	} else if p.match(token.LPAREN) {
-		switch e.(type) {
-		case ast.Ident:
-			return p.readFuncCall(e)
-		default:
-			panic("unimplemented postfixExpr2")
-		}
-	} else if p.match(token.PERIOD) {
-		panic("postfix .")
-	} else if p.match(token.ARROW) {
-		panic("postfix ->")
+		return p.postfixExpr2(p.readFuncCall(e))
+	} else if p.match(token.PERIOD) || p.match(token.ARROW) {
+		op := p.token
+		p.next()
+		p.assert(token.IDENT)
+		n := &ast.MemberExpr{X: e, Op: op, Name: p.token}
+		p.next()
+		return p.postfixExpr2(n)
 	} else {
 		return e
 	}
 }
 
-// [0] [1]
-func (p *Parser) readSubscriptExpr(t *token.Token) ast.SubscriptExpr {
+// x[i]
+func (p *Parser) readSubscriptExpr(x ast.Expr) *ast.SubscriptExpr {
 	p.assert(token.LBRACK)
+	se := &ast.SubscriptExpr{X: x, Lbrack: p.token}
 	p.next()
 
-	e := p.conditionalExpr()
+	se.Index = p.expr()
 
 	p.assert(token.RBRACK)
 	p.next()
-
-	se := ast.SubscriptExpr{Token: t, Expr: e}
 	return se
 }
 
 func (p *Parser) primaryExpr() ast.Expr {
 	switch {
+	case p.match(token.IDENT) && p.token.String() == "__builtin_va_start":
+		return p.vaStart()
+	case p.match(token.IDENT) && p.token.String() == "__builtin_va_arg":
+		return p.vaArg()
 	case p.match(token.IDENT):
-		t := p.token
+		// enumeration constants are resolved early for IntConst; sema
+		// resolves all identifiers again
+		n := &ast.Ident{Token: p.token, Obj: p.lookupName(p.token).enum}
 		p.next()
-
-		if p.match(token.LBRACK) {
-			return p.readSubscriptExpr(t)
-		} else {
-			n := ast.Ident{Token: t}
-			return n
-		}
+		return n
 	case p.match(token.INT_CONST):
-		i, err := strconv.Atoi(p.token.String())
-		if err != nil {
-			panic(err)
-		}
-		n := ast.IntVal{Num: i}
+		n := p.intVal()
+		p.next()
+		return n
+	case p.match(token.FLOAT_CONST):
+		n := p.floatVal()
 		p.next()
 		return n
 	case p.match(token.CHAR_CONST):
-		n := ast.CharVal{Token: p.token}
+		n := &ast.CharVal{Token: p.token}
 		p.next()
 		return n
+	case p.match(token.STRING_CONST):
+		return p.stringVal()
 	case p.match(token.LPAREN):
 		p.next()
 		e := p.expr()
@@ -590,16 +1384,159 @@ func (p *Parser) primaryExpr() ast.Expr {
 		p.next()
 		return e
 	default:
-		fmt.Println(p.token.Kind)
-		panic("primaryExpr: " + p.token.String())
+		p.errorf(p.token, "expected expression, but got %s", p.token.Describe())
+		return nil
 	}
 }
 
-func (p *Parser) readFuncCall(e ast.Expr) ast.FuncCall {
+// intVal converts the integer constant at the current token, e.g. "42",
+// "0x2aUL", "0755" or "0b101". Its type is the first of int, unsigned
+// int, long and unsigned long that represents the value and agrees with
+// the suffix. Decimal constants without a suffix u are never unsigned,
+// except when too large for long.
+func (p *Parser) intVal() *ast.IntVal {
+	tok := p.token
+	s := tok.String()
+	base, digits, name := 10, s, "decimal"
+	switch {
+	case isHex(s):
+		base, digits, name = 16, s[2:], "hexadecimal"
+	case len(s) > 1 && s[0] == '0' && (s[1] == 'b' || s[1] == 'B'):
+		base, digits, name = 2, s[2:], "binary"
+	case s[0] == '0':
+		base, name = 8, "octal"
+	}
+	// decimal digits belong to the constant whatever its base
+	max := 10
+	if base == 16 {
+		max = 16
+	}
+	i := 0
+	for ; i < len(digits) && digitValue(digits[i]) < max; i++ {
+		if digitValue(digits[i]) >= base {
+			p.errorf(tok, "invalid digit '%c' in %s constant", digits[i], name)
+		}
+	}
+	if i == 0 && base != 8 {
+		p.errorf(tok, "invalid suffix '%s' on integer constant", s[1:])
+	}
+	suffix := digits[i:]
+	unsigned, long, ok := intSuffix(suffix)
+	if !ok {
+		p.errorf(tok, "invalid suffix '%s' on integer constant", suffix)
+	}
+	v, err := strconv.ParseUint(digits[:i], base, 64)
+	if err != nil {
+		p.errorf(tok, "integer literal is too large to be represented in any integer type")
+	}
+
+	switch {
+	case !long && !unsigned && v <= math.MaxInt32:
+	case !long && (unsigned || base != 10) && v <= math.MaxUint32:
+		unsigned = true
+	case !unsigned && v <= math.MaxInt64:
+		long = true
+	default:
+		if !unsigned && base == 10 {
+			p.diags.Warnf(tok.Pos, tok.End(), "integer literal is too large to be represented in a signed integer type, interpreting as unsigned")
+		}
+		long, unsigned = true, true
+	}
+	return &ast.IntVal{Num: int(v), Unsigned: unsigned, Long: long, Token: tok}
+}
+
+// intSuffix returns whether the suffix of an integer constant makes it
+// unsigned or long. The suffix ll is the same as l, as long long has
+// the size of long.
+func intSuffix(s string) (unsigned, long, ok bool) {
+	if strings.HasPrefix(s, "u") || strings.HasPrefix(s, "U") {
+		s, unsigned = s[1:], true
+	} else if strings.HasSuffix(s, "u") || strings.HasSuffix(s, "U") {
+		s, unsigned = s[:len(s)-1], true
+	}
+	switch s {
+	case "":
+		return unsigned, false, true
+	case "l", "L", "ll", "LL":
+		return unsigned, true, true
+	}
+	return false, false, false
+}
+
+func isHex(s string) bool {
+	return len(s) > 1 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X')
+}
+
+// digitValue returns the value of the hexadecimal digit c, or 16 if c
+// is not a digit.
+func digitValue(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10
+	case 'A' <= c && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return 16
+}
+
+// floatVal converts the floating constant at the current token, e.g.
+// "1.5", ".5e-3", "2.f" or "0x1.8p3".
+func (p *Parser) floatVal() *ast.FloatVal {
+	tok := p.token
+	s := tok.String()
+	i, base, exp := 0, 10, "eE"
+	if isHex(s) {
+		i, base, exp = 2, 16, "pP"
+	}
+	digits := func(base int) {
+		for i < len(s) && digitValue(s[i]) < base {
+			i++
+		}
+	}
+	digits(base)
+	if i < len(s) && s[i] == '.' {
+		i++
+		digits(base)
+	}
+	if i < len(s) && strings.IndexByte(exp, s[i]) >= 0 {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		if i == len(s) || digitValue(s[i]) >= 10 {
+			p.errorf(tok, "exponent has no digits")
+		}
+		digits(10)
+	} else if base == 16 {
+		p.errorf(tok, "hexadecimal floating constants require an exponent")
+	}
+
+	n := &ast.FloatVal{Token: tok}
+	t := ast.DoubleType
+	switch suffix := s[i:]; suffix {
+	case "":
+	case "f", "F":
+		n.Float = true
+		t = ast.FloatType
+	case "l", "L":
+		p.errorf(tok, "'long double' is not supported")
+	default:
+		p.errorf(tok, "invalid suffix '%s' on floating constant", suffix)
+	}
+	n.Num, _ = strconv.ParseFloat(s[:i], 64)
+	if math.IsInf(n.Num, 0) || n.Float && n.Num > math.MaxFloat32 {
+		p.errorf(tok, "magnitude of floating-point constant too large for type '%s'", t)
+	}
+	return n
+}
+
+func (p *Parser) readFuncCall(e ast.Expr) *ast.FuncCall {
 	p.assert(token.LPAREN)
 	p.next()
 
-	n := ast.FuncCall{Ident: e.(ast.Ident)}
+	n := &ast.FuncCall{Func: e}
 	for !p.match(token.RPAREN) {
 		expr := p.expr()
 		n.Args = append(n.Args, expr)
@@ -632,33 +1569,54 @@ func (p *Parser) stmt() ast.Stmt {
 		e := p.expr()
 		p.assert(token.SEMICOLON)
 		p.next()
-		return ast.ExprStmt{Expr: e}
+		return &ast.ExprStmt{Expr: e}
 	}
 }
 
-func (p *Parser) blockStmt() ast.BlockStmt {
+func (p *Parser) blockStmt() *ast.BlockStmt {
 	p.assert(token.LBRACE)
+	n := &ast.BlockStmt{Token: p.token}
 	p.next()
-	n := ast.BlockStmt{}
 
+	p.openScope()
+	defer p.closeScope()
 	for !p.match(token.RBRACE) {
-		if p.isType() {
-			d := p.readVarDef()
-			n.Nodes = append(n.Nodes, d)
-
-			p.assert(token.SEMICOLON)
-			p.next()
-
-		} else {
-			stmt := p.stmt()
-			n.Nodes = append(n.Nodes, stmt)
+		if p.match(token.EOF) {
+			p.errorf(p.token, "expected '}' at end of block, but got end of file")
 		}
+		n.Nodes = append(n.Nodes, p.blockItem())
 	}
 	p.next()
 
 	return n
 }
 
+// blockItem reads a declaration or a statement. After a syntax error it
+// skips to the next item and returns an ast.BadStmt.
+func (p *Parser) blockItem() (n ast.Node) {
+	from := p.token.Pos
+	defer func() {
+		if r := recover(); r != nil {
+			p.recover(r)
+			p.sync(false)
+			p.resume()
+			if p.token.Pos == from {
+				p.next()
+			}
+			n = &ast.BadStmt{From: from, To: p.token.Pos}
+		}
+	}()
+
+	if p.isType() {
+		d := p.readVarDef()
+
+		p.assert(token.SEMICOLON)
+		p.next()
+		return d
+	}
+	return p.stmt()
+}
+
 func (p *Parser) isSelectionStmt() bool {
 	return p.match(token.IF) || p.match(token.SWITCH)
 }
@@ -666,28 +1624,72 @@ func (p *Parser) isSelectionStmt() bool {
 func (p *Parser) selectionStmt() ast.Stmt {
 	if p.match(token.IF) {
 		return p.ifStmt()
-	} else if p.match(token.SWITCH) {
-		panic("selection stmt switch is not implemented.")
 	} else {
-		panic(fmt.Sprintf("%s not selection Stmt", p.token))
+		return p.switchStmt()
 	}
 }
 
-func (p *Parser) ifStmt() ast.IfStmt {
+func (p *Parser) ifStmt() *ast.IfStmt {
 	p.assert(token.IF)
+	tok := p.token
 	p.next()
 
+	e := p.parenExpr()
+
+	b := p.blockStmt()
+
+	return &ast.IfStmt{Token: tok, Expr: &e, Block: b, Else: p.elseStmt()}
+}
+
+// parenExpr reads '(' expr ')'. A syntax error inside the parentheses is
+// replaced by an ast.BadExpr so that the statement body is still parsed.
+func (p *Parser) parenExpr() (e ast.Expr) {
 	p.assert(token.LPAREN)
 	p.next()
 
-	e := p.conditionalExpr()
+	from := p.token.Pos
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				p.recover(r)
+				p.skipParen()
+				p.resume()
+				e = &ast.BadExpr{From: from, To: p.token.Pos}
+			}
+		}()
+		e = p.conditionalExpr()
+		p.assert(token.RPAREN)
+	}()
 
 	p.assert(token.RPAREN)
 	p.next()
+	return e
+}
 
-	b := p.blockStmt()
+// skipParen skips tokens up to the ')' closing the current parenthesis.
+func (p *Parser) skipParen() {
+	depth := 0
+	for !p.matchs([]token.TokenKind{token.EOF, token.SEMICOLON, token.LBRACE}) {
+		if p.match(token.LPAREN) {
+			depth++
+		} else if p.match(token.RPAREN) {
+			if depth == 0 {
+				return
+			}
+			depth--
+		}
+		p.next()
+	}
+}
+
+func (p *Parser) switchStmt() *ast.SwitchStmt {
+	p.assert(token.SWITCH)
+	n := &ast.SwitchStmt{Token: p.token}
+	p.next()
 
-	return ast.IfStmt{Expr: &e, Block: b, Else: p.elseStmt()}
+	n.Expr = p.parenExpr()
+	n.Block = p.blockStmt()
+	return n
 }
 
 func (p *Parser) elseStmt() *ast.IfStmt {
@@ -695,13 +1697,13 @@ func (p *Parser) elseStmt() *ast.IfStmt {
 		return nil
 	}
 
+	tok := p.token
 	p.next()
 
 	if p.match(token.IF) {
-		s := p.ifStmt()
-		return &s
+		return p.ifStmt()
 	} else {
-		return &ast.IfStmt{Expr: nil, Block: p.blockStmt(), Else: nil}
+		return &ast.IfStmt{Token: tok, Expr: nil, Block: p.blockStmt(), Else: nil}
 	}
 }
 
@@ -711,20 +1713,49 @@ func (p *Parser) isIterationStmt() bool {
 
 func (p *Parser) iterationStmt() ast.Stmt {
 	switch {
-	case p.match(token.FOR):
-		return p.forStmt()
+	case p.match(token.WHILE):
+		return p.whileStmt()
+	case p.match(token.DO):
+		return p.doWhileStmt()
 	default:
-		panic("iterationStmt")
+		return p.forStmt()
 	}
 }
 
-func (p *Parser) forStmt() ast.ForStmt {
+func (p *Parser) whileStmt() *ast.WhileStmt {
+	w := &ast.WhileStmt{Token: p.token}
 	p.next()
 
+	w.Cond = p.parenExpr()
+	w.Body = p.stmt()
+	return w
+}
+
+func (p *Parser) doWhileStmt() *ast.DoWhileStmt {
+	d := &ast.DoWhileStmt{Token: p.token}
+	p.next()
+
+	d.Body = p.stmt()
+
+	p.assert(token.WHILE)
+	p.next()
+
+	d.Cond = p.parenExpr()
+
+	p.assert(token.SEMICOLON)
+	p.next()
+	return d
+}
+
+func (p *Parser) forStmt() *ast.ForStmt {
+	f := &ast.ForStmt{Token: p.token}
+	p.next()
+	p.openScope()
+	defer p.closeScope()
+
 	p.assert(token.LPAREN)
 	p.next()
 
-	f := ast.ForStmt{}
 	if !p.match(token.SEMICOLON) {
 		if p.isType() {
 			v := p.readVarDef()
@@ -765,22 +1796,40 @@ func (p *Parser) isJumpStmt() bool {
 }
 
 func (p *Parser) jumpStmt() ast.Stmt {
-	if p.match(token.GOTO) {
-		panic("unimplemented goto stmt")
-	} else if p.match(token.CONTINUE) {
-		panic("unimplemented continue stmt")
-	} else if p.match(token.BREAK) {
-		panic("unimplemented break stmt")
-	} else if p.match(token.RETURN) {
+	switch {
+	case p.match(token.BREAK):
+		n := &ast.BreakStmt{Token: p.token}
+		p.next()
+		p.assert(token.SEMICOLON)
+		p.next()
+		return n
+	case p.match(token.CONTINUE):
+		n := &ast.ContinueStmt{Token: p.token}
+		p.next()
+		p.assert(token.SEMICOLON)
+		p.next()
+		return n
+	case p.match(token.GOTO):
+		n := &ast.GotoStmt{Token: p.token}
+		p.next()
+		p.assert(token.IDENT)
+		n.Label = p.token
+		p.next()
+		p.assert(token.SEMICOLON)
+		p.next()
+		return n
+	default:
+		tok := p.token
 		p.next()
 
-		n := ast.ReturnStmt{Expr: p.expr()}
+		n := &ast.ReturnStmt{Token: tok}
+		if !p.match(token.SEMICOLON) {
+			n.Expr = p.expr()
+		}
 
 		p.assert(token.SEMICOLON)
 		p.next()
 		return n
-	} else {
-		panic("expected jump statement, but got '" + p.token.String() + "'.")
 	}
 }
 
@@ -798,5 +1847,28 @@ func (p *Parser) isLabeledStmt() bool {
 }
 
 func (p *Parser) labeledStmt() ast.Stmt {
-	panic("labeledStmt")
+	switch {
+	case p.match(token.CASE):
+		n := &ast.CaseStmt{Token: p.token}
+		p.next()
+		n.Expr = p.conditionalExpr()
+		p.assert(token.COLON)
+		p.next()
+		n.Stmt = p.stmt()
+		return n
+	case p.match(token.DEFAULT):
+		n := &ast.CaseStmt{Token: p.token}
+		p.next()
+		p.assert(token.COLON)
+		p.next()
+		n.Stmt = p.stmt()
+		return n
+	default:
+		n := &ast.LabeledStmt{Label: p.token}
+		p.next()
+		p.assert(token.COLON)
+		p.next()
+		n.Stmt = p.stmt()
+		return n
+	}
 }
@@ -7,7 +7,7 @@ import (
 	"testing"
 )
 
-func intValExpect(t *testing.T, v ast.IntVal, n int) {
+func intValExpect(t *testing.T, v *ast.IntVal, n int) {
 	if v.Num != n {
 		t.Errorf("expected num is %d, but got %d", n, v.Num)
 	}
@@ -17,7 +17,7 @@ func TestIntVal(t *testing.T) {
 	p := NewParser([]byte("1"))
 
 	e := p.expr()
-	v, ok := e.(ast.IntVal)
+	v, ok := e.(*ast.IntVal)
 	if !ok {
 		t.Errorf("expected type is ast.IntVal")
 		return
@@ -25,6 +25,105 @@ func TestIntVal(t *testing.T) {
 	intValExpect(t, v, 1)
 }
 
+func TestIntValForms(t *testing.T) {
+	tests := []struct {
+		source   string
+		num      int
+		unsigned bool
+		long     bool
+	}{
+		{"0x1F", 31, false, false},
+		{"0XaBc", 2748, false, false},
+		{"0755", 493, false, false},
+		{"0", 0, false, false},
+		{"0b101", 5, false, false},
+		{"10u", 10, true, false},
+		{"10UL", 10, true, true},
+		{"10lu", 10, true, true},
+		{"10ll", 10, false, true},
+		{"10uLL", 10, true, true},
+		{"2147483647", 2147483647, false, false},
+		{"2147483648", 2147483648, false, true},
+		{"0x80000000", 0x80000000, true, false},
+		{"4294967296", 4294967296, false, true},
+		{"0x8000000000000000", -1 << 63, true, true},
+	}
+	for _, tt := range tests {
+		p := NewParser([]byte(tt.source))
+		v, ok := p.expr().(*ast.IntVal)
+		if !ok {
+			t.Errorf("%q: expected type is ast.IntVal", tt.source)
+			continue
+		}
+		if v.Num != tt.num || v.Unsigned != tt.unsigned || v.Long != tt.long {
+			t.Errorf("%q: expected %d (unsigned %v, long %v), but got %d (unsigned %v, long %v)",
+				tt.source, tt.num, tt.unsigned, tt.long, v.Num, v.Unsigned, v.Long)
+		}
+		if p.Diags().Len() != 0 {
+			t.Errorf("%q: unexpected diagnostic %s", tt.source, p.Diags().All()[0].Msg)
+		}
+	}
+}
+
+func TestFloatVal(t *testing.T) {
+	tests := []struct {
+		source string
+		num    float64
+		float  bool
+	}{
+		{"1.5", 1.5, false},
+		{".25", 0.25, false},
+		{"2.", 2, false},
+		{"1e3", 1000, false},
+		{"2.5E-1f", 0.25, true},
+		{"3e+2F", 300, true},
+		{"0x1.8p1", 3, false},
+		{"0xAp-2f", 2.5, true},
+	}
+	for _, tt := range tests {
+		p := NewParser([]byte(tt.source))
+		v, ok := p.expr().(*ast.FloatVal)
+		if !ok {
+			t.Errorf("%q: expected type is ast.FloatVal", tt.source)
+			continue
+		}
+		if v.Num != tt.num || v.Float != tt.float {
+			t.Errorf("%q: expected %g (float %v), but got %g (float %v)", tt.source, tt.num, tt.float, v.Num, v.Float)
+		}
+	}
+}
+
+func TestNumberError(t *testing.T) {
+	tests := []struct {
+		source string
+		msg    string
+	}{
+		{"1e;", "exponent has no digits"},
+		{"1.5e+x;", "exponent has no digits"},
+		{"1.5q;", "invalid suffix 'q' on floating constant"},
+		{"1..2;", "invalid suffix '.2' on floating constant"},
+		{"2.5L;", "'long double' is not supported"},
+		{"1e39f;", "magnitude of floating-point constant too large for type 'float'"},
+		{"1e999;", "magnitude of floating-point constant too large for type 'double'"},
+		{"12ab;", "invalid suffix 'ab' on integer constant"},
+		{"1lL;", "invalid suffix 'lL' on integer constant"},
+		{"1uu;", "invalid suffix 'uu' on integer constant"},
+		{"0x;", "invalid suffix 'x' on integer constant"},
+		{"09;", "invalid digit '9' in octal constant"},
+		{"0b102;", "invalid digit '2' in binary constant"},
+		{"18446744073709551616;", "integer literal is too large to be represented in any integer type"},
+		{"9223372036854775808;", "integer literal is too large to be represented in a signed integer type, interpreting as unsigned"},
+		{"0x1.8;", "hexadecimal floating constants require an exponent"},
+	}
+	for _, tt := range tests {
+		p := NewParser([]byte("int main() { return " + tt.source + " }"))
+		p.ParseFile()
+		if ds := p.Diags().All(); len(ds) != 1 || ds[0].Msg != tt.msg {
+			t.Errorf("%q: expected error %q, but got %v", tt.source, tt.msg, ds)
+		}
+	}
+}
+
 func TestBinaryExpr(t *testing.T) {
 	/**
 	   Binary {
@@ -44,21 +143,21 @@ func TestBinaryExpr(t *testing.T) {
 	p := NewParser([]byte("1 + 2 * 3 - (4 / 5 + 6)"))
 
 	e := p.expr()
-	v, ok := e.(ast.BinaryExpr)
+	v, ok := e.(*ast.BinaryExpr)
 	if !ok {
 		t.Errorf("expected type isast.BinaryExpr")
 		return
 	}
 
 	// 1 + 2 * 3
-	x, ok := v.X.(ast.BinaryExpr)
+	x, ok := v.X.(*ast.BinaryExpr)
 	if !ok {
 		t.Errorf("expected x type isast.BinaryExpr")
 		return
 	}
 
 	// 1
-	xx, ok := x.X.(ast.IntVal)
+	xx, ok := x.X.(*ast.IntVal)
 	if !ok {
 		t.Errorf("expected xx type is ast.IntVal")
 		return
@@ -72,20 +171,20 @@ func TestBinaryExpr(t *testing.T) {
 	}
 
 	// 2 * 3
-	xy, ok := x.Y.(ast.BinaryExpr)
+	xy, ok := x.Y.(*ast.BinaryExpr)
 	if !ok {
 		t.Errorf("expected xy type isast.BinaryExpr")
 		return
 	}
 
-	xyx, ok := xy.X.(ast.IntVal)
+	xyx, ok := xy.X.(*ast.IntVal)
 	if !ok {
 		t.Errorf("expected xyx type is ast.IntVal")
 		return
 	}
 	intValExpect(t, xyx, 2)
 
-	xyy, ok := xy.Y.(ast.IntVal)
+	xyy, ok := xy.Y.(*ast.IntVal)
 	if !ok {
 		t.Errorf("expected xyy type is ast.IntVal")
 		return
@@ -98,27 +197,27 @@ func TestBinaryExpr(t *testing.T) {
 	}
 
 	// 4 / 5 + 6
-	y, ok := v.Y.(ast.BinaryExpr)
+	y, ok := v.Y.(*ast.BinaryExpr)
 	if !ok {
 		t.Errorf("expected y type isast.BinaryExpr")
 		return
 	}
 
 	// 4 / 5
-	yx, ok := y.X.(ast.BinaryExpr)
+	yx, ok := y.X.(*ast.BinaryExpr)
 	if !ok {
 		t.Errorf("expected yx type isast.BinaryExpr")
 		return
 	}
 
-	yxx, ok := yx.X.(ast.IntVal)
+	yxx, ok := yx.X.(*ast.IntVal)
 	if !ok {
 		t.Errorf("expected yxx type is ast.IntVal")
 		return
 	}
 	intValExpect(t, yxx, 4)
 
-	yxy, ok := yx.Y.(ast.IntVal)
+	yxy, ok := yx.Y.(*ast.IntVal)
 	if !ok {
 		t.Errorf("expected yxy type is ast.IntVal")
 		return
@@ -130,7 +229,7 @@ func TestBinaryExpr(t *testing.T) {
 		return
 	}
 
-	yy, ok := y.Y.(ast.IntVal)
+	yy, ok := y.Y.(*ast.IntVal)
 	if !ok {
 		t.Errorf("expected yy type is ast.IntVal")
 		return
@@ -143,13 +242,13 @@ func TestBinaryExpr(t *testing.T) {
 	}
 }
 
-// func varTypeExpect(t *testing.T, v ast.VarDef, ty ast.CType) {
+// func varTypeExpect(t *testing.T, v ast.VarDef, ty *ast.CType) {
 // 	if v.Type != ty {
 // 		t.Errorf("expected type is %s, but got %s", ty, v.Type)
 // 	}
 // }
 
-func varNameExpect(t *testing.T, v ast.VarDef, name string) {
+func varNameExpect(t *testing.T, v *ast.VarDef, name string) {
 	if v.Token.String() != name {
 		t.Errorf("expected name is %s, but got %s", name, v.Token.String())
 	}
@@ -158,12 +257,12 @@ func varNameExpect(t *testing.T, v ast.VarDef, name string) {
 func TestReadVarDef(t *testing.T) {
 	p := NewParser([]byte("int a;"))
 	n := p.readVarDef()
-	v, ok := n.(ast.VarDef)
+	v, ok := n.(*ast.VarDef)
 	if !ok {
 		t.Errorf("expected type is VarDef, but got %s", reflect.TypeOf(n))
 	}
-	if v.Type.Primitive != ast.C_int {
-		t.Errorf("expected type is %s, but got %s", v.Type.Primitive, ast.C_int)
+	if v.Type.Kind != ast.C_int {
+		t.Errorf("expected type is %s, but got %s", v.Type.Kind, ast.C_int)
 	}
 	varNameExpect(t, v, "a")
 	if v.Init != nil {
@@ -171,30 +270,41 @@ func TestReadVarDef(t *testing.T) {
 	}
 }
 
+func TestReadStaticVarDef(t *testing.T) {
+	p := NewParser([]byte("static int a; static int b[2];"))
+	if v, ok := p.readVarDef().(*ast.VarDef); !ok || !v.Static {
+		t.Errorf("expected static VarDef")
+	}
+	p.next()
+	if a, ok := p.readVarDef().(*ast.ArrayDef); !ok || !a.Static {
+		t.Errorf("expected static ArrayDef")
+	}
+}
+
 func TestReadVarDefWithInit(t *testing.T) {
 	p := NewParser([]byte("int a = 3 + 4;"))
 	n := p.readVarDef()
-	v, ok := n.(ast.VarDef)
+	v, ok := n.(*ast.VarDef)
 	if !ok {
 		t.Errorf("expected type is VarDef, but got %s", reflect.TypeOf(n))
 	}
-	if v.Type.Primitive != ast.C_int {
-		t.Errorf("expected type is %s, but got %s", v.Type.Primitive, ast.C_int)
+	if v.Type.Kind != ast.C_int {
+		t.Errorf("expected type is %s, but got %s", v.Type.Kind, ast.C_int)
 	}
 	varNameExpect(t, v, "a")
-	b, ok := (*v.Init).(ast.BinaryExpr)
+	b, ok := (*v.Init).(*ast.BinaryExpr)
 	if !ok {
 		t.Errorf("expected type isast.BinaryExpr, but got %s", reflect.TypeOf(v.Init))
 	}
-	intValExpect(t, b.X.(ast.IntVal), 3)
-	intValExpect(t, b.Y.(ast.IntVal), 4)
+	intValExpect(t, b.X.(*ast.IntVal), 3)
+	intValExpect(t, b.Y.(*ast.IntVal), 4)
 }
 
 func TestReadFuncDef(t *testing.T) {
 	p := NewParser([]byte("int main(int argc) { int a = 2 + 4; }"))
-	f := p.readFuncDef()
-	if f.Type.Primitive != ast.C_int {
-		t.Errorf("expected type is %s, but got %s", ast.C_int, f.Type.Primitive)
+	f := p.Parse().(*ast.FuncDef)
+	if f.Type.String() != "int (int)" {
+		t.Errorf("expected type is %s, but got %s", "int (int)", f.Type)
 	}
 	if f.Name != "main" {
 		t.Errorf("expected name is %s, but got %s", "main", f.Name)
@@ -202,8 +312,8 @@ func TestReadFuncDef(t *testing.T) {
 	if len(f.Args) != 1 {
 		t.Errorf("expected args count is %d, but got %d", 1, len(f.Args))
 	}
-	if f.Args[0].Type.Primitive != ast.C_int {
-		t.Errorf("expected type is %s, but got %s", ast.C_int, f.Args[0].Type.Primitive)
+	if f.Args[0].Type.Kind != ast.C_int {
+		t.Errorf("expected type is %s, but got %s", ast.C_int, f.Args[0].Type.Kind)
 	}
 	if f.Args[0].Name.String() != "argc" {
 		t.Errorf("expected type is %s, but got %s", "argc", f.Args[0].Name)
@@ -212,12 +322,12 @@ func TestReadFuncDef(t *testing.T) {
 		t.Errorf("expected block nodes count is %d, but got %d", 1, len(f.Block.Nodes))
 	}
 
-	v, ok := f.Block.Nodes[0].(ast.VarDef)
+	v, ok := f.Block.Nodes[0].(*ast.VarDef)
 	if !ok {
 		t.Errorf("expected block nodes[0] is VarDef, but got %s", reflect.TypeOf(f.Block.Nodes[0]))
 	}
-	if v.Type.Primitive != ast.C_int {
-		t.Errorf("expected type is %s, but got %s", ast.C_int, v.Type.Primitive)
+	if v.Type.Kind != ast.C_int {
+		t.Errorf("expected type is %s, but got %s", ast.C_int, v.Type.Kind)
 	}
 	if v.Token.String() != "a" {
 		t.Errorf("expected name is %s, but got %s", "a", v.Token.String())
@@ -225,32 +335,86 @@ func TestReadFuncDef(t *testing.T) {
 }
 
 func TestIsFuncDef(t *testing.T) {
-	p := NewParser([]byte("int main(int argc) { int a = 2 + 4; }"))
-	if !p.isFuncDef() {
-		t.Errorf("expected source is funcDef")
+	for _, src := range []string{"int main(int argc) { int a = 2 + 4; }", "int f(int);", "extern struct S *f(void);", "static char *g(char *s) { return s; }", "int (*h(int a))[3];"} {
+		if _, ok := NewParser([]byte(src)).Parse().(*ast.FuncDef); !ok {
+			t.Errorf("%q: expected source is funcDef", src)
+		}
+	}
+	for _, src := range []string{"int a = 2 + 4;", "struct S { int a; } s;", "struct S *p;", "extern int a[];", "int (*fp)(int);"} {
+		if _, ok := NewParser([]byte(src)).Parse().(*ast.FuncDef); ok {
+			t.Errorf("%q: expected source is not funcDef", src)
+		}
+	}
+}
+
+func TestFuncDecl(t *testing.T) {
+	tests := []struct {
+		source string
+		typ    string
+		named  []bool
+	}{
+		{"int printf(char *fmt, ...);", "int (char *, ...)", []bool{true}},
+		{"static int f(int, char *p);", "int (int, char *)", []bool{false, true}},
+		{"int main(void);", "int (void)", nil},
+		{"void g();", "void ()", nil},
+		{"void h(void);", "void (void)", nil},
+	}
+	for _, tt := range tests {
+		p := NewParser([]byte(tt.source))
+		f := p.Parse().(*ast.FuncDef)
+		if f.Block != nil {
+			t.Errorf("%q: expected a declaration without body", tt.source)
+		}
+		if f.Type.String() != tt.typ {
+			t.Errorf("%q: expected type is %s, but got %s", tt.source, tt.typ, f.Type)
+		}
+		if len(f.Args) != len(tt.named) {
+			t.Fatalf("%q: expected %d args, but got %d", tt.source, len(tt.named), len(f.Args))
+		}
+		for i, named := range tt.named {
+			if (f.Args[i].Name != nil) != named {
+				t.Errorf("%q: expected arg %d named is %v", tt.source, i, named)
+			}
+		}
+		if !p.IsEnd() {
+			t.Errorf("%q: expected the declaration is consumed", tt.source)
+		}
 	}
+	p := NewParser([]byte("int f(int) { return 0; }"))
+	p.Parse()
+	if ds := p.Diags().All(); len(ds) != 1 || ds[0].Msg != "parameter name omitted" {
+		t.Errorf("expected error parameter name omitted")
+	}
+}
 
-	p = NewParser([]byte("int a = 2 + 4;"))
-	if p.isFuncDef() {
-		t.Errorf("expected source is not funcDef")
+func TestExternVarDef(t *testing.T) {
+	p := NewParser([]byte("extern int a; extern char b[];"))
+	if v, ok := p.Parse().(*ast.VarDef); !ok || !v.Extern {
+		t.Errorf("expected extern VarDef")
+	}
+	if a, ok := p.Parse().(*ast.ArrayDef); !ok || !a.Extern || a.Type.Len != -1 {
+		t.Errorf("expected extern ArrayDef of unknown size")
+	}
+	if p.Diags().Len() != 0 {
+		t.Errorf("unexpected error: %s", p.Diags().All()[0].Msg)
 	}
 }
 
 func TestFuncCall(t *testing.T) {
 	p := NewParser([]byte("func(a, b, c);"))
-	f, ok := p.expr().(ast.FuncCall)
+	f, ok := p.expr().(*ast.FuncCall)
 	if !ok {
 		t.Errorf("expected type is FuncCall, but got %s", reflect.TypeOf(p.expr()))
 	}
-	if f.Ident.Token.String() != "func" {
-		t.Errorf("expected func name is %s, but got %s", "func", f.Ident.Token)
+	if id, ok := f.Func.(*ast.Ident); !ok || id.Token.String() != "func" {
+		t.Errorf("expected func name is %s, but got %v", "func", f.Func)
 	}
 	if len(f.Args) != 3 {
 		t.Errorf("expected args count is %d, but got %d", 3, len(f.Args))
 	}
 	idents := []string{"a", "b", "c"}
 	for i, v := range f.Args {
-		a, ok := v.(ast.Ident)
+		a, ok := v.(*ast.Ident)
 		if !ok {
 			t.Errorf("expected arg[%d] is not ident", i)
 		}
@@ -260,9 +424,24 @@ func TestFuncCall(t *testing.T) {
 	}
 }
 
+func TestFuncPointerCall(t *testing.T) {
+	p := NewParser([]byte("(*fp)(1)(2)"))
+	outer, ok := p.expr().(*ast.FuncCall)
+	if !ok {
+		t.Fatalf("expected type is FuncCall")
+	}
+	inner, ok := outer.Func.(*ast.FuncCall)
+	if !ok {
+		t.Fatalf("expected the callee is a FuncCall, but got %s", reflect.TypeOf(outer.Func))
+	}
+	if _, ok := inner.Func.(*ast.PtrVal); !ok {
+		t.Errorf("expected the innermost callee is *fp, but got %s", reflect.TypeOf(inner.Func))
+	}
+}
+
 func TestFuncCall2(t *testing.T) {
 	p := NewParser([]byte("int main() { return a(); }"))
-	f, ok := p.Parse().(ast.FuncDef)
+	f, ok := p.Parse().(*ast.FuncDef)
 	if !ok {
 		t.Errorf("expected type is FuncDef, but got %s", reflect.TypeOf(p.Parse()))
 	}
@@ -274,54 +453,314 @@ func TestFuncCall2(t *testing.T) {
 func TestReadType(t *testing.T) {
 	p := NewParser([]byte("int"))
 	ty := p.readType()
-	if ty.Primitive != ast.C_int {
-		t.Errorf("expected type is %s, but got %s", ast.C_int, ty.Primitive)
+	if ty.Kind != ast.C_int {
+		t.Errorf("expected type is %s, but got %s", ast.C_int, ty.Kind)
 	}
 	p = NewParser([]byte("char"))
 	ty = p.readType()
-	if ty.Primitive != ast.C_char {
-		t.Errorf("expected type is %s, but got %s", ast.C_char, ty.Primitive)
+	if ty.Kind != ast.C_char {
+		t.Errorf("expected type is %s, but got %s", ast.C_char, ty.Kind)
 	}
 	p = NewParser([]byte("int *"))
 	ty = p.readType()
-	if ty.Primitive != ast.C_int {
-		t.Errorf("expected type is %s, but got %s", ast.C_int, ty.Primitive)
+	if !ty.IsPtr() || ty.Elem().Kind != ast.C_int {
+		t.Errorf("expected type is int *, but got %s", ty)
+	}
+	p = NewParser([]byte("const char *volatile *"))
+	ty = p.readType()
+	if s := ty.String(); s != "const char *volatile *" {
+		t.Errorf("expected type is %s, but got %s", "const char *volatile *", s)
+	}
+	if !ty.Elem().Volatile || ty.Elem().Elem().Kind != ast.C_char || !ty.Elem().Elem().Const {
+		t.Errorf("unexpected type structure %s", ty)
+	}
+}
+
+func TestAbstractDeclarator(t *testing.T) {
+	tests := []struct {
+		source, typ string
+	}{
+		{"int [3]", "int [3]"},
+		{"int *[3]", "int *[3]"},
+		{"int (*)[3]", "int (*)[3]"},
+		{"int (*)(int, char *)", "int (*)(int, char *)"},
+		{"char *(*(*)[2])(void)", "char *(*(*)[2])(void)"},
+		{"long unsigned", "unsigned long"},
+	}
+	for _, tt := range tests {
+		p := NewParser([]byte(tt.source))
+		if ty := p.readType(); ty.String() != tt.typ {
+			t.Errorf("%q: expected type is %s, but got %s", tt.source, tt.typ, ty)
+		}
+		if !p.IsEnd() {
+			t.Errorf("%q: expected parser is at the end", tt.source)
+		}
+	}
+}
+
+func TestDeclarators(t *testing.T) {
+	p := NewParser([]byte("static int a = 1, *b, c[3], (*d)[2], *e(char), (*f)(void);"))
+	l, ok := p.Parse().(*ast.DeclList)
+	if !ok {
+		t.Fatalf("expected type is DeclList")
+	}
+	want := []struct {
+		name, typ string
+	}{
+		{"a", "int"}, {"b", "int *"}, {"c", "int [3]"}, {"d", "int (*)[2]"}, {"e", "int *(char)"}, {"f", "int (*)(void)"},
+	}
+	if len(l.List) != len(want) {
+		t.Fatalf("expected %d declarations, but got %d", len(want), len(l.List))
+	}
+	for i, n := range l.List {
+		var name string
+		var ty *ast.CType
+		switch v := n.(type) {
+		case *ast.VarDef:
+			name, ty = v.Token.String(), v.Type
+			if !v.Static {
+				t.Errorf("expected %s is static", name)
+			}
+		case *ast.ArrayDef:
+			name, ty = v.Token.String(), v.Type
+		case *ast.FuncDef:
+			name, ty = v.Name, v.Type
+		}
+		if name != want[i].name || ty.String() != want[i].typ {
+			t.Errorf("expected %s of type %s, but got %s of type %s", want[i].name, want[i].typ, name, ty)
+		}
 	}
-	if !ty.Ptr {
-		t.Errorf("expected type is pointer")
+	if a := l.List[0].(*ast.VarDef); a.Init == nil {
+		t.Errorf("expected a is initialized")
+	}
+	if c := l.List[2].(*ast.ArrayDef); c.Subscript == nil {
+		t.Errorf("expected c has a subscript")
+	}
+}
+
+func TestTypedef(t *testing.T) {
+	src := `typedef int T, *P, A[2];
+typedef T F(P);
+T x;
+A y;
+F f;
+int main() { T T = 1; { P p; } return T * 2; }`
+	p := NewParser([]byte(src))
+	nodes := p.ParseFile()
+	if p.Diags().HasErrors() {
+		t.Fatalf("unexpected error: %s", p.Diags().All()[0].Msg)
+	}
+	l := nodes[0].(*ast.DeclList)
+	if d := l.List[1].(*ast.TypeDecl); d.Name.String() != "P" || d.Type.String() != "int *" {
+		t.Errorf("expected P is a typedef of int *, but got %s", d.Type)
+	}
+	if x := nodes[2].(*ast.VarDef); x.Type.Kind != ast.C_int {
+		t.Errorf("expected x is int, but got %s", x.Type)
+	}
+	if y := nodes[3].(*ast.ArrayDef); y.Type.String() != "int [2]" || y.Subscript != nil {
+		t.Errorf("expected y is int [2], but got %s", y.Type)
+	}
+	f := nodes[4].(*ast.FuncDef)
+	if f.Type.String() != "int (int *)" || len(f.Args) != 1 || f.Args[0].Name != nil {
+		t.Errorf("expected f is a function of type int (int *), but got %s", f.Type)
+	}
+
+	// the variable T hides the typedef name, so that T * 2 is a product
+	body := nodes[5].(*ast.FuncDef).Block
+	if v, ok := body.Nodes[0].(*ast.VarDef); !ok || v.Token.String() != "T" {
+		t.Fatalf("expected T is declared as a variable")
+	}
+	ret := body.Nodes[2].(*ast.ReturnStmt)
+	if b, ok := ret.Expr.(*ast.BinaryExpr); !ok || b.Op.Kind != token.MUL {
+		t.Errorf("expected T * 2 is a multiplication")
+	}
+}
+
+func TestDeclError(t *testing.T) {
+	tests := []struct {
+		src, msg string
+	}{
+		{"typedef int T; typedef long T;", "typedef redefinition with different types ('long' vs 'int')"},
+		{"int T; typedef int T;", "redefinition of 'T' as different kind of symbol"},
+		{"static extern int x;", "cannot combine with previous 'static' declaration specifier"},
+		{"auto int x;", "illegal storage class on file-scoped variable"},
+		{"int f(static int a);", "invalid storage class specifier in function declarator"},
+		{"struct S { static int a; };", "type name does not allow storage class to be specified"},
+		{"int a[3](int);", "'a' declared as array of functions of type 'int (int)'"},
+		{"int f(void)[3];", "function cannot return array type 'int [3]'"},
+		{"int f(void)(void);", "function cannot return function type 'int (void)'"},
+		{"int main() { int f(void) { return 0; } }", "function definition is not allowed here"},
+		{"int main() { static int f(void); }", "function declared in block scope cannot have 'static' storage class"},
+		{"struct S { int f(void); };", "field 'f' declared as a function"},
+		{"int (*p;", "expected ')', but got ';'"},
+		{"int *;", "expected identifier or '(', but got ';'"},
+		{"enum { N = 2 }; struct S { int a[N - 3]; };", "'a' declared as an array with a negative size"},
+		{"int n = sizeof(char[-1]);", "array size is negative"},
+	}
+	for _, tt := range tests {
+		p := NewParser([]byte(tt.src))
+		p.ParseFile()
+		ds := p.Diags().All()
+		if len(ds) == 0 || ds[0].Msg != tt.msg {
+			t.Errorf("%q: expected %q, but got %v", tt.src, tt.msg, ds)
+		}
+	}
+}
+
+func TestConstArraySize(t *testing.T) {
+	src := `enum { N = 4, M = N * 2 + 1 };
+struct S { char name[M]; int v[N << 1][N - 1]; };
+int a[(N > 2 ? 10 : 20) / 3];
+int f(int N) { int b[N]; return 0; }`
+	p := NewParser([]byte(src))
+	p.Parse()
+	s := p.Parse().(*ast.TypeDecl).Type.Struct
+	a := p.Parse().(*ast.ArrayDef)
+	f := p.Parse().(*ast.FuncDef)
+	if p.Diags().Len() != 0 {
+		t.Fatalf("unexpected error: %s", p.Diags().All()[0].Msg)
+	}
+	if typ := s.Fields[0].Type.String(); typ != "char [9]" {
+		t.Errorf("expected type of name is char [9], but got %s", typ)
+	}
+	if typ := s.Fields[1].Type.String(); typ != "int [8][3]" {
+		t.Errorf("expected type of v is int [8][3], but got %s", typ)
+	}
+	if a.Type.Len != 3 {
+		t.Errorf("expected array length is 3, but got %d", a.Type.Len)
+	}
+	// the parameter N hides the constant
+	if b := f.Block.Nodes[0].(*ast.ArrayDef); b.Type.Len != -1 {
+		t.Errorf("expected the length of b is not known, but got %d", b.Type.Len)
+	}
+}
+
+func TestIntegerTypes(t *testing.T) {
+	tests := []struct {
+		source string
+		want   *ast.CType
+	}{
+		{"signed", ast.IntType},
+		{"unsigned", ast.UIntType},
+		{"unsigned int", ast.UIntType},
+		{"int unsigned", ast.UIntType},
+		{"signed char", ast.CharType},
+		{"char unsigned", ast.UCharType},
+		{"short", ast.ShortType},
+		{"short int", ast.ShortType},
+		{"unsigned short int", ast.UShortType},
+		{"long", ast.LongType},
+		{"long int", ast.LongType},
+		{"long long", ast.LongType},
+		{"signed long long int", ast.LongType},
+		{"long unsigned int long", ast.ULongType},
+		{"long double", ast.LongDoubleType},
+		{"double long", ast.LongDoubleType},
+		{"const unsigned volatile", ast.UIntType.Qualified(true, true)},
+	}
+	for _, tt := range tests {
+		p := NewParser([]byte(tt.source))
+		ty := p.readType()
+		if !ast.Compatible(ty, tt.want) {
+			t.Errorf("%q: expected type is %s, but got %s", tt.source, tt.want, ty)
+		}
+		if !p.IsEnd() {
+			t.Errorf("%q: expected the type is consumed", tt.source)
+		}
+	}
+}
+
+func TestSpecifierError(t *testing.T) {
+	tests := []struct {
+		source string
+		msg    string
+	}{
+		{"int char a;", "cannot combine with previous 'int' declaration specifier"},
+		{"short long a;", "cannot combine with previous 'short' declaration specifier"},
+		{"long char a;", "cannot combine with previous 'long' declaration specifier"},
+		{"signed unsigned a;", "cannot combine with previous 'signed' declaration specifier"},
+		{"unsigned float a;", "cannot combine with previous 'unsigned' declaration specifier"},
+		{"void short a;", "cannot combine with previous 'void' declaration specifier"},
+		{"long long long a;", "'long long long' is invalid"},
+		{"long long double a;", "cannot combine with previous 'long' declaration specifier"},
+		{"double long long a;", "cannot combine with previous 'long' declaration specifier"},
+		{"unsigned long double a;", "cannot combine with previous 'unsigned' declaration specifier"},
+	}
+	for _, tt := range tests {
+		p := NewParser([]byte(tt.source))
+		p.ParseFile()
+		if ds := p.Diags().All(); len(ds) != 1 || ds[0].Msg != tt.msg {
+			t.Errorf("%q: expected error %q, but got %v", tt.source, tt.msg, ds)
+		}
+	}
+}
+
+func TestParamArray(t *testing.T) {
+	p := NewParser([]byte("int main(int argc, char *argv[]) { return argc; }"))
+	f := p.Parse().(*ast.FuncDef)
+	if ty := f.Args[1].Type; ty.String() != "char **" {
+		t.Errorf("expected type is char **, but got %s", ty)
 	}
 }
 
 func TestPointer(t *testing.T) {
 	p := NewParser([]byte("{ *a = *a + b; }"))
 	e := p.blockStmt()
-	a, ok := e.Nodes[0].(ast.ExprStmt).Expr.(ast.AssignExpr)
+	a, ok := e.Nodes[0].(*ast.ExprStmt).Expr.(*ast.AssignExpr)
 	if !ok {
-		t.Errorf("expected type is AssignExpr, but got %s", reflect.TypeOf(e.Nodes[0].(ast.ExprStmt).Expr))
+		t.Errorf("expected type is AssignExpr, but got %s", reflect.TypeOf(e.Nodes[0].(*ast.ExprStmt).Expr))
 	}
-	_, ok = a.L.(ast.PtrVal)
+	_, ok = a.L.(*ast.PtrVal)
 	if !ok {
 		t.Errorf("expected type is PointerVal, but got %s", reflect.TypeOf(a.L))
 	}
 }
 
+func TestLvalueExpr(t *testing.T) {
+	p := NewParser([]byte("{ *(p + 1) = &a[i][j]; (*pp)[k]++; }"))
+	b := p.blockStmt()
+	a := b.Nodes[0].(*ast.ExprStmt).Expr.(*ast.AssignExpr)
+	if _, ok := a.L.(*ast.PtrVal).X.(*ast.BinaryExpr); !ok {
+		t.Errorf("expected dereference of a binary expression, but got %s", reflect.TypeOf(a.L.(*ast.PtrVal).X))
+	}
+	outer := a.R.(*ast.AddressVal).X.(*ast.SubscriptExpr)
+	if j := outer.Index.(*ast.Ident); j.Token.String() != "j" {
+		t.Errorf("expected index is %s, but got %s", "j", j.Token)
+	}
+	inner := outer.X.(*ast.SubscriptExpr)
+	if x := inner.X.(*ast.Ident); x.Token.String() != "a" {
+		t.Errorf("expected array is %s, but got %s", "a", x.Token)
+	}
+
+	inc := b.Nodes[1].(*ast.ExprStmt).Expr.(*ast.IncExpr)
+	s := inc.X.(*ast.SubscriptExpr)
+	if _, ok := s.X.(*ast.PtrVal); !ok {
+		t.Errorf("expected subscript of a dereference, but got %s", reflect.TypeOf(s.X))
+	}
+}
+
+func TestParseArray2(t *testing.T) {
+	p := NewParser([]byte("int a[2][3];"))
+	v := p.readVarDef().(*ast.ArrayDef)
+	if v.Type.String() != "int [2][3]" {
+		t.Errorf("expected type is int [2][3], but got %s", v.Type)
+	}
+}
+
 func TestParseArray(t *testing.T) {
 	p := NewParser([]byte("int a[4];"))
 	e := p.readVarDef()
-	v, ok := e.(ast.ArrayDef)
+	v, ok := e.(*ast.ArrayDef)
 	if !ok {
 		t.Errorf("expected type is ArrayDef, but got %s", reflect.TypeOf(e))
 	}
-	if v.Type.Primitive != ast.C_int {
-		t.Errorf("expected type is %s, but got %s", ast.C_int, v.Type.Primitive)
-	}
-	if !v.Type.Array {
-		t.Errorf("expected type is array")
+	if !v.Type.IsArray() || v.Type.Elem().Kind != ast.C_int || v.Type.Len != 4 {
+		t.Errorf("expected type is int [4], but got %s", v.Type)
 	}
 	if v.Token.String() != "a" {
 		t.Errorf("expected name is %s, but got %s", "a", v.Token.String())
 	}
-	vv, ok := (*v.Subscript).(ast.IntVal)
+	vv, ok := (*v.Subscript).(*ast.IntVal)
 	if !ok {
 		t.Errorf("expected type is ast.IntVal, but got %s", reflect.TypeOf(v.Subscript))
 	}
@@ -333,10 +772,26 @@ func TestParseArray(t *testing.T) {
 	}
 }
 
+func TestStringVal(t *testing.T) {
+	p := NewParser([]byte(`char s[] = "ab" "c"; char *q = "x\ty";`))
+	a := p.readVarDef().(*ast.ArrayDef)
+	if a.Init == nil || len(a.Init.List) != 1 {
+		t.Fatalf("expected init is a list of one string literal")
+	}
+	if s, ok := a.Init.List[0].(*ast.StringVal); !ok || string(s.Val) != "abc" {
+		t.Errorf("expected string literal \"abc\", but got %v", a.Init.List[0])
+	}
+	p.next()
+	v := p.readVarDef().(*ast.VarDef)
+	if s, ok := (*v.Init).(*ast.StringVal); !ok || string(s.Val) != "x\ty" {
+		t.Errorf("expected string literal \"x\\ty\", but got %v", *v.Init)
+	}
+}
+
 func TestParseArrayInit(t *testing.T) {
 	p := NewParser([]byte("int a[] = {0, 1, 2, 3};"))
 	e := p.readVarDef()
-	v, ok := e.(ast.ArrayDef)
+	v, ok := e.(*ast.ArrayDef)
 	if !ok {
 		t.Errorf("expected type is ArrayDef, but got %s", reflect.TypeOf(e))
 	}
@@ -349,23 +804,38 @@ func TestParseArrayInit(t *testing.T) {
 	}
 }
 
+func TestParseNestedArrayInit(t *testing.T) {
+	p := NewParser([]byte("int m[2][2] = {{1, 2}, 3, 4,};"))
+	v := p.readVarDef().(*ast.ArrayDef)
+	l := v.Init.List
+	if len(l) != 3 {
+		t.Fatalf("expected count of elements is %d, but got %d", 3, len(l))
+	}
+	if sub, ok := l[0].(*ast.ArrayInit); !ok || len(sub.List) != 2 {
+		t.Errorf("expected a nested list of 2 elements, but got %s", reflect.TypeOf(l[0]))
+	}
+	if _, ok := l[2].(*ast.IntVal); !ok {
+		t.Errorf("expected type is ast.IntVal, but got %s", reflect.TypeOf(l[2]))
+	}
+}
+
 func TestReturnSubscript(t *testing.T) {
 	p := NewParser([]byte("return a[0];"))
 	e := p.stmt()
-	v, ok := e.(ast.ReturnStmt)
+	v, ok := e.(*ast.ReturnStmt)
 	if !ok {
 		t.Errorf("expected type is ReturnStmt, but got %s", reflect.TypeOf(e))
 	}
-	vv, ok := v.Expr.(ast.SubscriptExpr)
+	vv, ok := v.Expr.(*ast.SubscriptExpr)
 	if !ok {
 		t.Errorf("expected type is SubscriptExpr, but got %s", reflect.TypeOf(v.Expr))
 	}
-	if vv.Token.String() != "a" {
-		t.Errorf("expected ident is %s, but got %s", "a", vv.Token.String())
+	if x := vv.X.(*ast.Ident); x.Token.String() != "a" {
+		t.Errorf("expected ident is %s, but got %s", "a", x.Token.String())
 	}
-	i, ok := vv.Expr.(ast.IntVal)
+	i, ok := vv.Index.(*ast.IntVal)
 	if !ok {
-		t.Errorf("expected type is ast.IntVal, but got %s", reflect.TypeOf(vv.Expr))
+		t.Errorf("expected type is ast.IntVal, but got %s", reflect.TypeOf(vv.Index))
 	}
 	if i.Num != 0 {
 		t.Errorf("expected str is %d, but got %d", 0, i.Num)
@@ -375,36 +845,36 @@ func TestReturnSubscript(t *testing.T) {
 func TestIfStmt(t *testing.T) {
 	p := NewParser([]byte("if (a == 0) { return 0; } else if (a == 1) { return 1; } else { return 2; }"))
 	if1 := p.ifStmt()
-	e := (*if1.Expr).(ast.BinaryExpr)
+	e := (*if1.Expr).(*ast.BinaryExpr)
 	if e.Op.Kind != token.EQ {
 		t.Errorf("expected token is %s, but got %s", token.EQ, e.Op.Kind)
 	}
-	x := e.X.(ast.Ident)
+	x := e.X.(*ast.Ident)
 	if x.Token.String() != "a" {
-		t.Errorf("expected token is %s, but got %s", "a", x)
+		t.Errorf("expected token is %s, but got %s", "a", x.Token)
 	}
-	y := e.Y.(ast.IntVal)
+	y := e.Y.(*ast.IntVal)
 	if y.Num != 0 {
 		t.Errorf("expected num is %d, but got %d", 0, y.Num)
 	}
 
-	n := if1.Block.Nodes[0].(ast.ReturnStmt).Expr.(ast.IntVal)
+	n := if1.Block.Nodes[0].(*ast.ReturnStmt).Expr.(*ast.IntVal)
 	if n.Num != 0 {
 		t.Errorf("expected return is %d, but got %d", 0, n.Num)
 	}
 
 	if2 := if1.Else
-	e2 := (*if2.Expr).(ast.BinaryExpr)
-	x = e2.X.(ast.Ident)
+	e2 := (*if2.Expr).(*ast.BinaryExpr)
+	x = e2.X.(*ast.Ident)
 	if x.Token.String() != "a" {
-		t.Errorf("expected token is %s, but got %s", "a", x)
+		t.Errorf("expected token is %s, but got %s", "a", x.Token)
 	}
-	y = e2.Y.(ast.IntVal)
+	y = e2.Y.(*ast.IntVal)
 	if y.Num != 1 {
 		t.Errorf("expected num is %d, but got %d", 1, y.Num)
 	}
 
-	n = if2.Block.Nodes[0].(ast.ReturnStmt).Expr.(ast.IntVal)
+	n = if2.Block.Nodes[0].(*ast.ReturnStmt).Expr.(*ast.IntVal)
 	if n.Num != 1 {
 		t.Errorf("expected return is %d, but got %d", 1, n.Num)
 	}
@@ -414,7 +884,7 @@ func TestIfStmt(t *testing.T) {
 		t.Errorf("expected if expr is nil")
 	}
 
-	n = if3.Block.Nodes[0].(ast.ReturnStmt).Expr.(ast.IntVal)
+	n = if3.Block.Nodes[0].(*ast.ReturnStmt).Expr.(*ast.IntVal)
 	if n.Num != 2 {
 		t.Errorf("expected return is %d, but got %d", 2, n.Num)
 	}
@@ -427,28 +897,52 @@ func TestIfStmt(t *testing.T) {
 func TestIncrement(t *testing.T) {
 	p := NewParser([]byte("{a++; ++a;}"))
 	b := p.blockStmt()
-	i1 := b.Nodes[0].(ast.ExprStmt).Expr.(ast.IncExpr)
-	if i1.Ident.Token.String() != "a" {
-		t.Errorf("expected ident is %s, but got %s", "a", i1.Ident)
+	i1 := b.Nodes[0].(*ast.ExprStmt).Expr.(*ast.IncExpr)
+	if i1.X.(*ast.Ident).Token.String() != "a" {
+		t.Errorf("expected ident is %s, but got %s", "a", i1.X.(*ast.Ident).Token)
+	}
+	if !i1.Postfix {
+		t.Errorf("expected a++ to be postfix")
+	}
+
+	i2 := b.Nodes[1].(*ast.ExprStmt).Expr.(*ast.IncExpr)
+	if i2.X.(*ast.Ident).Token.String() != "a" {
+		t.Errorf("expected ident is %s, but got %s", "a", i2.X.(*ast.Ident).Token)
 	}
+	if i2.Postfix {
+		t.Errorf("expected ++a to be prefix")
+	}
+}
 
-	i2 := b.Nodes[1].(ast.ExprStmt).Expr.(ast.IncExpr)
-	if i2.Ident.Token.String() != "a" {
-		t.Errorf("expected ident is %s, but got %s", "a", i2.Ident.Token)
+func TestAssignExpr(t *testing.T) {
+	p := NewParser([]byte("if (a && f(&b)) { a = b = 1; }"))
+	n := p.stmt().(*ast.IfStmt)
+	if c := (*n.Expr).(*ast.BinaryExpr); c.Op.Kind != token.LAND {
+		t.Errorf("expected condition op is %s, but got %s", token.LAND, c.Op.Kind)
+	}
+	a := n.Block.Nodes[0].(*ast.ExprStmt).Expr.(*ast.AssignExpr)
+	if l := a.L.(*ast.Ident); l.Token.String() != "a" {
+		t.Errorf("expected left operand is %s, but got %s", "a", l.Token)
+	}
+	if _, ok := a.R.(*ast.AssignExpr); !ok {
+		t.Errorf("expected right operand is an assignment, but got %T", a.R)
+	}
+	if p.Diags().Len() != 0 {
+		t.Errorf("unexpected error: %s", p.Diags().All()[0].Msg)
 	}
 }
 
 func TestDecrement(t *testing.T) {
 	p := NewParser([]byte("{a--; --a;}"))
 	b := p.blockStmt()
-	i1 := b.Nodes[0].(ast.ExprStmt).Expr.(ast.DecExpr)
-	if i1.Ident.Token.String() != "a" {
-		t.Errorf("expected ident is %s, but got %s", "a", i1.Ident.Token)
+	i1 := b.Nodes[0].(*ast.ExprStmt).Expr.(*ast.DecExpr)
+	if i1.X.(*ast.Ident).Token.String() != "a" {
+		t.Errorf("expected ident is %s, but got %s", "a", i1.X.(*ast.Ident).Token)
 	}
 
-	i2 := b.Nodes[1].(ast.ExprStmt).Expr.(ast.DecExpr)
-	if i2.Ident.Token.String() != "a" {
-		t.Errorf("expected ident is %s, but got %s", "a", i2.Ident.Token)
+	i2 := b.Nodes[1].(*ast.ExprStmt).Expr.(*ast.DecExpr)
+	if i2.X.(*ast.Ident).Token.String() != "a" {
+		t.Errorf("expected ident is %s, but got %s", "a", i2.X.(*ast.Ident).Token)
 	}
 }
 
@@ -458,34 +952,418 @@ func TestForStmt(t *testing.T) {
 	if f.E1 == nil {
 		t.Errorf("expression 1 is null")
 	}
-	e1 := f.E1.(ast.VarDef)
-	if e1.Type.Primitive != ast.C_int {
-		t.Errorf("expected expression 1 varDef type is %s, but got %s", ast.C_int, e1.Type.Primitive)
+	e1 := f.E1.(*ast.VarDef)
+	if e1.Type.Kind != ast.C_int {
+		t.Errorf("expected expression 1 varDef type is %s, but got %s", ast.C_int, e1.Type.Kind)
 	}
 
-	e2 := (*f.E2).(ast.BinaryExpr)
+	e2 := (*f.E2).(*ast.BinaryExpr)
 	if e2.Op.Kind != token.LT {
 		t.Errorf("expected expression 2 op is %s, but got %s", token.LT, e2.Op.Kind)
 	}
-	if x := e2.X.(ast.Ident); x.Token.String() != "i" {
+	if x := e2.X.(*ast.Ident); x.Token.String() != "i" {
 		t.Errorf("expected expression 2 x is %s, but got %s", "i", x.Token.String())
 	}
-	if y := e2.Y.(ast.IntVal); y.Num != 10 {
+	if y := e2.Y.(*ast.IntVal); y.Num != 10 {
 		t.Errorf("expected expression 2 y is %d, but got %d", 10, y.Num)
 	}
 
-	e3 := (*f.E3).(ast.IncExpr)
-	if e3.Ident.Token.String() != "i" {
-		t.Errorf("expected expression 3 ident is %s, but got %s", "i", e3.Ident.Token.String())
+	e3 := (*f.E3).(*ast.IncExpr)
+	if e3.X.(*ast.Ident).Token.String() != "i" {
+		t.Errorf("expected expression 3 ident is %s, but got %s", "i", e3.X.(*ast.Ident).Token.String())
 	}
-	b := f.Block.Nodes[0].(ast.ExprStmt).Expr.(ast.BinaryExpr)
+	b := f.Block.Nodes[0].(*ast.ExprStmt).Expr.(*ast.BinaryExpr)
 	if b.Op.Kind != token.ADD {
 		t.Errorf("expected binary op is %s, but got %s", token.ADD, b.Op.Kind)
 	}
-	if x := b.X.(ast.IntVal); x.Num != 1 {
+	if x := b.X.(*ast.IntVal); x.Num != 1 {
 		t.Errorf("expected binary x is %d, but got %d", 1, x.Num)
 	}
-	if y := b.Y.(ast.IntVal); y.Num != 2 {
+	if y := b.Y.(*ast.IntVal); y.Num != 2 {
 		t.Errorf("expected binary y is %d, but got %d", 2, y.Num)
 	}
 }
+
+func TestWhileStmt(t *testing.T) {
+	p := NewParser([]byte("while (i < 10) { i++; break; }"))
+	w := p.stmt().(*ast.WhileStmt)
+	if c := w.Cond.(*ast.BinaryExpr); c.Op.Kind != token.LT {
+		t.Errorf("expected condition op is %s, but got %s", token.LT, c.Op.Kind)
+	}
+	b := w.Body.(*ast.BlockStmt)
+	if len(b.Nodes) != 2 {
+		t.Fatalf("expected 2 statements, but got %d", len(b.Nodes))
+	}
+	if _, ok := b.Nodes[1].(*ast.BreakStmt); !ok {
+		t.Errorf("expected break statement, but got %T", b.Nodes[1])
+	}
+}
+
+func TestWhileStmtWithoutBlock(t *testing.T) {
+	p := NewParser([]byte("while (x) x--; 1;"))
+	w := p.stmt().(*ast.WhileStmt)
+	if s, ok := w.Body.(*ast.ExprStmt); !ok {
+		t.Errorf("expected expression statement, but got %T", w.Body)
+	} else if _, ok := s.Expr.(*ast.DecExpr); !ok {
+		t.Errorf("expected x--, but got %T", s.Expr)
+	}
+	if !p.match(token.INT_CONST) {
+		t.Errorf("expected the statement to end after ';', but got %s", p.token.Kind)
+	}
+}
+
+func TestDoWhileStmt(t *testing.T) {
+	p := NewParser([]byte("do { continue; } while (i != 0); 1;"))
+	d := p.stmt().(*ast.DoWhileStmt)
+	if _, ok := d.Body.(*ast.BlockStmt).Nodes[0].(*ast.ContinueStmt); !ok {
+		t.Errorf("expected continue statement, but got %T", d.Body.(*ast.BlockStmt).Nodes[0])
+	}
+	if c := d.Cond.(*ast.BinaryExpr); c.Op.Kind != token.NE {
+		t.Errorf("expected condition op is %s, but got %s", token.NE, c.Op.Kind)
+	}
+	if !p.match(token.INT_CONST) {
+		t.Errorf("expected the statement to end after ';', but got %s", p.token.Kind)
+	}
+}
+
+func TestDoWhileStmtWithoutBlock(t *testing.T) {
+	p := NewParser([]byte("do x--; while (x); 1;"))
+	d := p.stmt().(*ast.DoWhileStmt)
+	if _, ok := d.Body.(*ast.ExprStmt); !ok {
+		t.Errorf("expected expression statement, but got %T", d.Body)
+	}
+	if c, ok := d.Cond.(*ast.Ident); !ok || string(c.Token.Str) != "x" {
+		t.Errorf("expected condition x, but got %T", d.Cond)
+	}
+	if !p.match(token.INT_CONST) {
+		t.Errorf("expected the statement to end after ';', but got %s", p.token.Kind)
+	}
+}
+
+func TestSwitchStmt(t *testing.T) {
+	p := NewParser([]byte("switch (x) { case 1: case 2: x++; default: break; }"))
+	n := p.stmt().(*ast.SwitchStmt)
+	if len(n.Block.Nodes) != 2 {
+		t.Fatalf("expected 2 statements, but got %d", len(n.Block.Nodes))
+	}
+	c1 := n.Block.Nodes[0].(*ast.CaseStmt)
+	if v := c1.Expr.(*ast.IntVal); v.Num != 1 {
+		t.Errorf("expected case value is %d, but got %d", 1, v.Num)
+	}
+	c2 := c1.Stmt.(*ast.CaseStmt)
+	if _, ok := c2.Stmt.(*ast.ExprStmt); !ok {
+		t.Errorf("expected expression statement, but got %T", c2.Stmt)
+	}
+	d := n.Block.Nodes[1].(*ast.CaseStmt)
+	if d.Expr != nil {
+		t.Errorf("expected default label, but got case")
+	}
+	if _, ok := d.Stmt.(*ast.BreakStmt); !ok {
+		t.Errorf("expected break statement, but got %T", d.Stmt)
+	}
+}
+
+func TestGotoStmt(t *testing.T) {
+	p := NewParser([]byte("{ goto end; end: return 0; }"))
+	b := p.blockStmt()
+	g := b.Nodes[0].(*ast.GotoStmt)
+	if g.Label.String() != "end" {
+		t.Errorf("expected goto label is %s, but got %s", "end", g.Label.String())
+	}
+	l := b.Nodes[1].(*ast.LabeledStmt)
+	if l.Label.String() != "end" {
+		t.Errorf("expected label is %s, but got %s", "end", l.Label.String())
+	}
+	if _, ok := l.Stmt.(*ast.ReturnStmt); !ok {
+		t.Errorf("expected return statement, but got %T", l.Stmt)
+	}
+}
+
+func TestStructType(t *testing.T) {
+	p := NewParser([]byte("struct S { char a; int *b, c[3]; } s;"))
+	v, ok := p.readVarDef().(*ast.VarDef)
+	if !ok {
+		t.Fatalf("expected type is VarDef")
+	}
+	st := v.Type.Struct
+	if !v.Type.IsStruct() || st == nil || st.Tag.String() != "S" {
+		t.Fatalf("expected type is struct S, but got %s", v.Type)
+	}
+	offsets := []int{0, 8, 16}
+	if len(st.Fields) != len(offsets) {
+		t.Fatalf("expected fields count is %d, but got %d", len(offsets), len(st.Fields))
+	}
+	for i, f := range st.Fields {
+		if f.Offset != offsets[i] {
+			t.Errorf("expected offset of %s is %d, but got %d", f.Name, offsets[i], f.Offset)
+		}
+	}
+	if st.Size != 32 || st.Align != 8 {
+		t.Errorf("expected size and alignment are 32 and 8, but got %d and %d", st.Size, st.Align)
+	}
+
+	p = NewParser([]byte("union { char c; int i[2]; } u;"))
+	v = p.readVarDef().(*ast.VarDef)
+	if st := v.Type.Struct; !st.Union || st.Tag != nil || st.Size != 8 || st.Fields[1].Offset != 0 {
+		t.Errorf("unexpected union layout %+v", st)
+	}
+}
+
+func TestStructTag(t *testing.T) {
+	p := NewParser([]byte("struct S; struct S *p; struct S { int a; };"))
+	decl := p.Parse().(*ast.TypeDecl)
+	ptr := p.Parse().(*ast.VarDef)
+	def := p.Parse().(*ast.TypeDecl)
+	s := ptr.Type.Elem().Struct
+	if decl.Type.Struct != s || s != def.Type.Struct {
+		t.Errorf("expected all declarations refer to the same struct")
+	}
+	if !s.Complete {
+		t.Errorf("expected struct S is complete")
+	}
+}
+
+func TestEnumType(t *testing.T) {
+	p := NewParser([]byte("enum E { A, B = 4, C, }; enum E e; enum { X } x;"))
+	def := p.Parse().(*ast.TypeDecl)
+	v := p.Parse().(*ast.VarDef)
+	anon := p.Parse().(*ast.VarDef)
+	e := def.Type.Enum
+	if def.Type.Kind != ast.C_enum || e != v.Type.Enum || !e.Complete {
+		t.Fatalf("expected both declarations refer to the complete enum E")
+	}
+	names := []string{"A", "B", "C"}
+	if len(e.Consts) != len(names) {
+		t.Fatalf("expected %d constants, but got %d", len(names), len(e.Consts))
+	}
+	for i, c := range e.Consts {
+		if c.Name.String() != names[i] {
+			t.Errorf("expected constant %s, but got %s", names[i], c.Name)
+		}
+		if (c.Value != nil) != (i == 1) {
+			t.Errorf("unexpected value of %s", c.Name)
+		}
+	}
+	if anon.Type.Enum.Tag != nil || len(anon.Type.Enum.Consts) != 1 {
+		t.Errorf("unexpected anonymous enum %+v", anon.Type.Enum)
+	}
+}
+
+func TestEnumError(t *testing.T) {
+	tests := []struct {
+		src, msg string
+	}{
+		{"enum E {};", "use of empty enum"},
+		{"enum E { A }; enum E { B };", "redefinition of 'E'"},
+		{"struct S { int a; }; enum S e;", "use of 'S' with tag type that does not match previous declaration"},
+		{"enum E { A }; union E u;", "use of 'E' with tag type that does not match previous declaration"},
+		{"enum E { A B };", "expected '}', but got identifier 'B'"},
+	}
+	for _, tt := range tests {
+		p := NewParser([]byte(tt.src))
+		p.ParseFile()
+		ds := p.Diags().All()
+		if len(ds) != 1 || ds[0].Msg != tt.msg {
+			t.Errorf("%q: expected %q, but got %v", tt.src, tt.msg, ds)
+		}
+	}
+}
+
+func TestCastExpr(t *testing.T) {
+	p := NewParser([]byte("(unsigned char)(long)x * (y)"))
+	b, ok := p.expr().(*ast.BinaryExpr)
+	if !ok {
+		t.Fatalf("expected type is BinaryExpr")
+	}
+	c, ok := b.X.(*ast.CastExpr)
+	if !ok || c.To.String() != "unsigned char" {
+		t.Fatalf("expected a cast to unsigned char, but got %s", reflect.TypeOf(b.X))
+	}
+	if inner, ok := c.X.(*ast.CastExpr); !ok || inner.To.Kind != ast.C_long {
+		t.Errorf("expected a cast to long, but got %s", reflect.TypeOf(c.X))
+	}
+	if _, ok := b.Y.(*ast.Ident); !ok {
+		t.Errorf("expected (y) is an expression, but got %s", reflect.TypeOf(b.Y))
+	}
+}
+
+func TestSizeofExpr(t *testing.T) {
+	tests := []struct {
+		source string
+		typ    string // of the type name, or "" for an expression
+		size   int
+	}{
+		{"sizeof(int)", "int", 4},
+		{"sizeof(char *[3])", "char *[3]", 24},
+		{"_Alignof(struct { char c; long l; })", "struct (anonymous)", 8},
+		{"sizeof x", "", 0},
+		{"sizeof (x)", "", 0},
+		{"sizeof -x", "", 0},
+	}
+	for _, tt := range tests {
+		p := NewParser([]byte(tt.source))
+		s, ok := p.expr().(*ast.SizeofExpr)
+		if !ok {
+			t.Errorf("%q: expected type is SizeofExpr", tt.source)
+			continue
+		}
+		if tt.typ == "" {
+			if s.X == nil || s.Of != nil {
+				t.Errorf("%q: expected an expression operand", tt.source)
+			}
+			continue
+		}
+		if s.Of == nil || s.Of.String() != tt.typ {
+			t.Errorf("%q: expected type is %s, but got %s", tt.source, tt.typ, s.Of)
+		}
+		if n, ok := ast.IntConst(s); !ok || n != tt.size {
+			t.Errorf("%q: expected value is %d, but got %d", tt.source, tt.size, n)
+		}
+	}
+
+	p := NewParser([]byte("sizeof(int) * 2"))
+	if b, ok := p.expr().(*ast.BinaryExpr); !ok || b.Op.Kind != token.MUL {
+		t.Errorf("expected sizeof(int) * 2 is a product")
+	}
+	p = NewParser([]byte("char buf[sizeof(long)];"))
+	if a := p.readVarDef().(*ast.ArrayDef); a.Type.Len != 8 {
+		t.Errorf("expected array length is 8, but got %d", a.Type.Len)
+	}
+}
+
+func TestVaExpr(t *testing.T) {
+	p := NewParser([]byte("__builtin_va_start(ap, n)"))
+	if s, ok := p.expr().(*ast.VaStartExpr); !ok || s.Ap == nil || s.Last == nil {
+		t.Errorf("expected a VaStartExpr with two operands")
+	}
+	p = NewParser([]byte("*__builtin_va_arg(ap, char **)"))
+	v, ok := p.expr().(*ast.PtrVal)
+	if !ok {
+		t.Fatalf("expected type is PtrVal")
+	}
+	if a, ok := v.X.(*ast.VaArgExpr); !ok || a.To.String() != "char **" {
+		t.Errorf("expected a VaArgExpr of char **")
+	}
+}
+
+func TestMemberExpr(t *testing.T) {
+	p := NewParser([]byte("s.a->b"))
+	m, ok := p.expr().(*ast.MemberExpr)
+	if !ok {
+		t.Fatalf("expected type is MemberExpr")
+	}
+	if m.Op.Kind != token.ARROW || m.Name.String() != "b" {
+		t.Errorf("expected ->b, but got %s%s", m.Op, m.Name)
+	}
+	x, ok := m.X.(*ast.MemberExpr)
+	if !ok || x.Op.Kind != token.PERIOD || x.Name.String() != "a" {
+		t.Errorf("expected s.a, but got %s", reflect.TypeOf(m.X))
+	}
+}
+
+func TestParseError(t *testing.T) {
+	p := NewParser([]byte("int main() {\n  int a = 1\n  return a;\n}"))
+	f, ok := p.Parse().(*ast.FuncDef)
+	if !ok {
+		t.Fatalf("expected type is FuncDef")
+	}
+	if !p.IsEnd() {
+		t.Errorf("expected parser is at the end")
+	}
+	if _, ok := f.Block.Nodes[0].(*ast.BadStmt); !ok {
+		t.Errorf("expected type is BadStmt, but got %s", reflect.TypeOf(f.Block.Nodes[0]))
+	}
+	ds := p.Diags().All()
+	if len(ds) != 1 {
+		t.Fatalf("expected %d diagnostic, but got %d", 1, len(ds))
+	}
+	if ds[0].Msg != "expected ';', but got 'return'" {
+		t.Errorf("unexpected message %q", ds[0].Msg)
+	}
+	if ds[0].Pos.Line != 3 || ds[0].Pos.Column != 3 {
+		t.Errorf("expected position is 3:3, but got %d:%d", ds[0].Pos.Line, ds[0].Pos.Column)
+	}
+}
+
+func TestParseErrorRecovery(t *testing.T) {
+	src := `int f() {
+  a = ;
+  if (a b) { return 1; }
+  for (;;) { 1 + ; }
+  return 2;
+}
+int g( { }
+int h() { return 3; }
+`
+	p := NewParser([]byte(src))
+	nodes := p.ParseFile()
+
+	lines := []int{2, 3, 4, 7}
+	ds := p.Diags().All()
+	if len(ds) != len(lines) {
+		t.Fatalf("expected %d diagnostics, but got %d", len(lines), len(ds))
+	}
+	for i, d := range ds {
+		if d.Pos.Line != lines[i] {
+			t.Errorf("expected error %d at line %d, but got %d", i, lines[i], d.Pos.Line)
+		}
+	}
+
+	if len(nodes) != 3 {
+		t.Fatalf("expected nodes count is %d, but got %d", 3, len(nodes))
+	}
+	f := nodes[0].(*ast.FuncDef)
+	if len(f.Block.Nodes) != 4 {
+		t.Fatalf("expected block nodes count is %d, but got %d", 4, len(f.Block.Nodes))
+	}
+	if _, ok := f.Block.Nodes[0].(*ast.BadStmt); !ok {
+		t.Errorf("expected type is BadStmt, but got %s", reflect.TypeOf(f.Block.Nodes[0]))
+	}
+	i := f.Block.Nodes[1].(*ast.IfStmt)
+	if _, ok := (*i.Expr).(*ast.BadExpr); !ok {
+		t.Errorf("expected type is BadExpr, but got %s", reflect.TypeOf(*i.Expr))
+	}
+	if len(i.Block.Nodes) != 1 {
+		t.Errorf("expected if body is parsed")
+	}
+	if _, ok := f.Block.Nodes[3].(*ast.ReturnStmt); !ok {
+		t.Errorf("expected type is ReturnStmt, but got %s", reflect.TypeOf(f.Block.Nodes[3]))
+	}
+	if _, ok := nodes[1].(*ast.BadDecl); !ok {
+		t.Errorf("expected type is BadDecl, but got %s", reflect.TypeOf(nodes[1]))
+	}
+	if h, ok := nodes[2].(*ast.FuncDef); !ok || h.Name != "h" {
+		t.Errorf("expected function h is parsed")
+	}
+}
+
+func TestErrorsOnOneLine(t *testing.T) {
+	p := NewParser([]byte("int a = ; int b = ;\nint f() { 1 + ; 2 + ; return (3 +); }"))
+	p.ParseFile()
+	ds := p.Diags().All()
+	cols := [][2]int{{1, 9}, {1, 19}, {2, 15}, {2, 21}, {2, 34}}
+	if len(ds) != len(cols) {
+		t.Fatalf("expected %d diagnostics, but got %d", len(cols), len(ds))
+	}
+	for i, d := range ds {
+		if d.Pos.Line != cols[i][0] || d.Pos.Column != cols[i][1] {
+			t.Errorf("expected error %d at %d:%d, but got %d:%d", i, cols[i][0], cols[i][1], d.Pos.Line, d.Pos.Column)
+		}
+	}
+}
+
+func TestErrorLimit(t *testing.T) {
+	p := NewParser([]byte("int f() {\n1 +;\n2 +;\n3 +;\n4 +;\n}\nint g() { return 1; }"))
+	p.ErrorLimit = 2
+	p.ParseFile()
+	if n := p.Diags().ErrorCount(); n != 3 {
+		t.Errorf("expected %d errors, but got %d", 3, n)
+	}
+	ds := p.Diags().All()
+	if msg := ds[len(ds)-1].Msg; msg != "too many errors emitted, stopping now" {
+		t.Errorf("unexpected last message %q", msg)
+	}
+	if !p.IsEnd() {
+		t.Errorf("expected parser is at the end")
+	}
+}
@@ -3,26 +3,6 @@ package parser
 import . "gocc/token"
 
 var (
-	typeKeys = []TokenKind{
-		INT,
-		VOID,
-		CHAR,
-		FLOAT,
-		LONG,
-		SHORT,
-		DOUBLE,
-		STRUCT,
-		UNION,
-		SIGNED,
-		UNSIGNED,
-		STATIC,
-		AUTO,
-		EXTERN,
-		REGISTER,
-		CONST,
-		VOLATILE,
-	}
-
 	unaryOps = []TokenKind{
 		AND,
 		MUL,
@@ -59,11 +39,19 @@ var (
 		CHAR,
 		SHORT,
 		INT,
-		SHORT,
 		LONG,
 		FLOAT,
 		DOUBLE,
+		BOOL,
 		SIGNED,
 		UNSIGNED,
+		STRUCT,
+		UNION,
+		ENUM,
+	}
+
+	typeQualifiers = []TokenKind{
+		CONST,
+		VOLATILE,
 	}
 )
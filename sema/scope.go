@@ -0,0 +1,33 @@
+package sema
+
+import "gocc/ast"
+
+// Scope maps names to the objects declared in one block.
+type Scope struct {
+	Outer *Scope
+	objs  map[string]*ast.Object
+}
+
+func NewScope(outer *Scope) *Scope {
+	return &Scope{Outer: outer, objs: map[string]*ast.Object{}}
+}
+
+// Lookup finds the object named name in s or its enclosing scopes.
+func (s *Scope) Lookup(name string) *ast.Object {
+	for ; s != nil; s = s.Outer {
+		if obj, ok := s.objs[name]; ok {
+			return obj
+		}
+	}
+	return nil
+}
+
+// Insert declares obj in s. If s already declares an object with the
+// same name, it is returned and obj is not inserted.
+func (s *Scope) Insert(obj *ast.Object) *ast.Object {
+	if prev, ok := s.objs[obj.Name]; ok {
+		return prev
+	}
+	s.objs[obj.Name] = obj
+	return nil
+}
@@ -0,0 +1,1272 @@
+package sema
+
+import (
+	"fmt"
+	"gocc/ast"
+	"gocc/diag"
+	"gocc/token"
+	"math"
+	"math/big"
+)
+
+// Checker resolves identifiers to their declarations, computes the type
+// of every expression and reports ill-typed programs before gen runs.
+type Checker struct {
+	diags    *diag.List
+	scope    *Scope
+	fn       *ast.FuncDef      // function being checked
+	loops    int               // number of enclosing loops
+	switches []*ast.SwitchStmt // enclosing switch statements, innermost last
+
+	// labels and gotos of the function being checked. Labels are
+	// function-scoped, so gotos are resolved at the end of the function.
+	labels []*ast.LabeledStmt
+	gotos  []*ast.GotoStmt
+
+	// types whose enumeration constants have been declared
+	declared map[interface{}]bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{diags: diag.NewList(), scope: NewScope(nil), declared: map[interface{}]bool{}}
+}
+
+func (c *Checker) Diags() *diag.List {
+	return c.diags
+}
+
+func (c *Checker) errorf(pos token.Position, format string, a ...interface{}) *diag.Diagnostic {
+	return c.diags.Errorf(pos, token.Position{}, format, a...)
+}
+
+func (c *Checker) errorTok(t *token.Token, format string, a ...interface{}) *diag.Diagnostic {
+	return c.diags.Errorf(t.Pos, t.End(), format, a...)
+}
+
+func (c *Checker) openScope() {
+	c.scope = NewScope(c.scope)
+}
+
+func (c *Checker) closeScope() {
+	c.scope = c.scope.Outer
+}
+
+// declare adds a new object to the current scope and reports redefinitions.
+func (c *Checker) declare(kind ast.ObjKind, t *token.Token, ty *ast.CType, decl ast.Node) *ast.Object {
+	obj := &ast.Object{Kind: kind, Name: t.String(), Type: ty, Decl: decl}
+	if prev := c.scope.Insert(obj); prev != nil {
+		c.errorTok(t, "redefinition of '%s'", obj.Name).
+			Notef(prev.Decl.Pos(), token.Position{}, "previous definition is here")
+	}
+	return obj
+}
+
+// resolve finds the object an identifier token refers to.
+func (c *Checker) resolve(t *token.Token) *ast.Object {
+	obj := c.scope.Lookup(t.String())
+	if obj == nil {
+		c.errorTok(t, "use of undeclared identifier '%s'", t.String())
+	}
+	return obj
+}
+
+// declareExternal declares a function or a variable with linkage, which
+// may be declared any number of times with compatible types but defined
+// at most once, not counting tentative definitions. All its declarations
+// share one object, whose Decl is the definition generated.
+func (c *Checker) declareExternal(kind ast.ObjKind, t *token.Token, ty *ast.CType, decl ast.Node) *ast.Object {
+	obj := &ast.Object{Kind: kind, Name: t.String(), Type: ty, Decl: decl, Linkage: true}
+	prev := c.scope.Insert(obj)
+	switch {
+	case prev == nil:
+		return obj
+	case prev.Kind != kind || !prev.Linkage:
+		c.errorTok(t, "redefinition of '%s' as different kind of symbol", obj.Name).
+			Notef(prev.Decl.Pos(), token.Position{}, "previous definition is here")
+		return obj
+	case !ast.Compatible(prev.Type, ty):
+		c.errorTok(t, "conflicting types for '%s'", obj.Name).
+			Notef(prev.Decl.Pos(), token.Position{}, "previous declaration is here")
+		return obj
+	}
+	if ast.IsDefinition(decl) {
+		switch {
+		case ast.IsTentative(decl) && ast.IsDefinition(prev.Decl):
+			// int x = 1; int x; leaves the first one the definition
+		case ast.IsDefinition(prev.Decl) && !ast.IsTentative(prev.Decl):
+			c.errorTok(t, "redefinition of '%s'", obj.Name).
+				Notef(prev.Decl.Pos(), token.Position{}, "previous definition is here")
+			return prev
+		default:
+			prev.Decl = decl
+		}
+	}
+	if prev.Type.IsArray() && prev.Type.Len < 0 || prev.Type.IsFunc() && prev.Type.NoProto {
+		prev.Type = ty
+	}
+	return prev
+}
+
+// declareVar declares a variable. Variables declared at file scope or
+// extern have linkage; they and the static ones have static storage
+// duration.
+func (c *Checker) declareVar(t *token.Token, ty *ast.CType, decl ast.Node, static, extern bool) *ast.Object {
+	var obj *ast.Object
+	if c.fn == nil || extern {
+		obj = c.declareExternal(ast.VarObj, t, ty, decl)
+	} else {
+		obj = c.declare(ast.VarObj, t, ty, decl)
+	}
+	obj.Static = c.fn == nil || static || extern
+	return obj
+}
+
+// externInit reports the initializer of a variable declared extern, which
+// makes it a definition at file scope.
+func (c *Checker) externInit(t *token.Token) {
+	if c.fn != nil {
+		c.errorTok(t, "'extern' variable cannot have an initializer")
+	} else {
+		c.diags.Warnf(t.Pos, t.End(), "'extern' variable has an initializer")
+	}
+}
+
+func (c *Checker) Check(n ast.Node) {
+	switch v := n.(type) {
+	case *ast.FuncDef:
+		c.funcDef(v)
+	case *ast.VarDef:
+		c.varDef(v)
+	case *ast.ArrayDef:
+		c.arrayDef(v)
+	case *ast.TypeDecl:
+		c.declareEnums(v.Type)
+	case *ast.DeclList:
+		for _, d := range v.List {
+			c.Check(d)
+		}
+	case *ast.BadDecl, *ast.BadStmt:
+	case ast.Expr:
+		c.expr(v)
+	case ast.Stmt:
+		c.stmt(v)
+	}
+}
+
+func (c *Checker) funcDef(f *ast.FuncDef) {
+	c.declareEnums(f.Type)
+	f.Obj = c.declareExternal(ast.FuncObj, f.Token, f.Type, f)
+	if f.Block == nil {
+		return
+	}
+	if r := f.Type.Base; !r.IsVoid() && !r.IsComplete() {
+		c.errorTok(f.Token, "incomplete result type '%s' in function definition", r)
+	} else if r.Kind == ast.C_ldouble {
+		c.errorTok(f.Token, "'long double' is not supported")
+	}
+
+	c.fn = f
+	c.openScope()
+	for i := range f.Args {
+		a := &f.Args[i]
+		if a.Type.IsVoid() {
+			c.errorTok(a.Name, "argument may not have 'void' type")
+		} else if !a.Type.IsComplete() {
+			c.errorTok(a.Name, "variable has incomplete type '%s'", a.Type)
+		}
+		a.Obj = c.declare(ast.VarObj, a.Name, a.Type, a)
+	}
+	// the arguments are in the same scope as the outermost block
+	for _, n := range f.Block.Nodes {
+		c.Check(n)
+	}
+	c.closeScope()
+	c.resolveLabels()
+	c.fn = nil
+}
+
+// declareEnums declares the constants of the enums defined in the type
+// t of a declaration, including in its members and parameters, in the
+// current scope.
+func (c *Checker) declareEnums(t *ast.CType) {
+	switch t.Kind {
+	case ast.C_ptr, ast.C_array:
+		c.declareEnums(t.Base)
+	case ast.C_func:
+		c.declareEnums(t.Base)
+		for _, p := range t.Params {
+			c.declareEnums(p)
+		}
+	case ast.C_struct:
+		if !t.Struct.Complete || c.declared[t.Struct] {
+			return
+		}
+		c.declared[t.Struct] = true
+		for _, f := range t.Struct.Fields {
+			c.declareEnums(f.Type)
+		}
+	case ast.C_enum:
+		if !t.Enum.Complete || c.declared[t.Enum] {
+			return
+		}
+		c.declared[t.Enum] = true
+		c.enumerators(t.Enum)
+	}
+}
+
+// enumerators declares the constants of e. Each one without a value is
+// one more than the previous one, the first one 0.
+func (c *Checker) enumerators(e *ast.EnumType) {
+	next := 0
+	for _, en := range e.Consts {
+		if en.Value != nil {
+			x := *en.Value
+			c.expr(x)
+			if n, ok := ast.IntConst(x); ok {
+				next = n
+			} else if !isBad(x) {
+				c.errorf(x.Pos(), "expression is not an integer constant expression")
+			}
+		} else if next > math.MaxInt32 {
+			c.errorTok(en.Name, "overflow in enumeration value")
+		}
+		en.Obj = c.declare(ast.ConstObj, en.Name, ast.IntType, en)
+		en.Obj.Value = next
+		next++
+	}
+}
+
+// resolveLabels links the gotos of a function to their labels.
+func (c *Checker) resolveLabels() {
+	used := map[*ast.LabeledStmt]bool{}
+	for _, g := range c.gotos {
+		if g.Target = c.lookupLabel(g.Label.String()); g.Target == nil {
+			c.errorTok(g.Label, "use of undeclared label '%s'", g.Label.String())
+			continue
+		}
+		used[g.Target] = true
+	}
+	for _, l := range c.labels {
+		if !used[l] {
+			c.diags.Warnf(l.Label.Pos, l.Label.End(), "unused label '%s'", l.Label.String())
+		}
+	}
+	c.labels, c.gotos = nil, nil
+}
+
+func (c *Checker) lookupLabel(name string) *ast.LabeledStmt {
+	for _, l := range c.labels {
+		if l.Label.String() == name {
+			return l
+		}
+	}
+	return nil
+}
+
+func (c *Checker) labeledStmt(l *ast.LabeledStmt) {
+	if prev := c.lookupLabel(l.Label.String()); prev != nil {
+		c.errorTok(l.Label, "redefinition of label '%s'", l.Label.String()).
+			Notef(prev.Pos(), token.Position{}, "previous definition is here")
+	} else {
+		c.labels = append(c.labels, l)
+	}
+	c.stmt(l.Stmt)
+}
+
+func (c *Checker) varDef(v *ast.VarDef) {
+	c.declareEnums(v.Type)
+	if !v.Type.IsComplete() && ast.IsDefinition(v) {
+		c.errorTok(v.Token, "variable has incomplete type '%s'", v.Type)
+	}
+	if v.Extern && v.Init != nil {
+		c.externInit(v.Token)
+	}
+	static := c.fn == nil || v.Static || v.Extern
+	if v.Init != nil {
+		if init, ok := (*v.Init).(*ast.ArrayInit); ok {
+			c.initList(v.Type, init)
+		} else {
+			c.assign(v.Type, *v.Init, initializing)
+		}
+		if static {
+			c.staticInit(*v.Init)
+		}
+	}
+	v.Obj = c.declareVar(v.Token, v.Type, v, v.Static, v.Extern)
+}
+
+// staticInit checks that the initializer of an object of static storage
+// duration is computed at compile time.
+func (c *Checker) staticInit(e ast.Expr) {
+	if init, ok := e.(*ast.ArrayInit); ok {
+		for _, x := range init.List {
+			c.staticInit(x)
+		}
+		return
+	}
+	if isBad(e) {
+		return
+	}
+	if _, ok := ast.IntConst(e); ok {
+		return
+	}
+	if _, ok := ast.FloatConst(e); ok {
+		return
+	}
+	if _, _, ok := ast.AddrConst(e); ok {
+		return
+	}
+	c.errorf(e.Pos(), "initializer element is not a compile-time constant")
+}
+
+func (c *Checker) arrayDef(a *ast.ArrayDef) {
+	c.declareEnums(a.Type)
+	elem := a.Type.Elem()
+	if !elem.IsComplete() {
+		c.errorTok(a.Token, "array has incomplete element type '%s'", elem)
+	}
+	if a.Subscript != nil {
+		if t := c.expr(*a.Subscript); !t.IsInteger() {
+			c.errorf((*a.Subscript).Pos(), "size of array has non-integer type '%s'", t)
+		} else if n, ok := ast.IntConst(*a.Subscript); !ok {
+			if !isBad(*a.Subscript) {
+				c.errorf((*a.Subscript).Pos(), "array size must be an integer constant")
+			}
+		} else if n < 0 {
+			c.errorf((*a.Subscript).Pos(), "'%s' declared as an array with a negative size", a.Token)
+		} else {
+			if a.Type.Len < 0 {
+				// sized by a constant that only sema can evaluate
+				a.Type = ast.ArrayOf(elem, n)
+			}
+		}
+	}
+	if a.Extern && a.Init != nil {
+		c.externInit(a.Token)
+	}
+	if a.Init != nil {
+		c.initList(a.Type, a.Init)
+		if a.Type.Len < 0 {
+			n := len(a.Init.List)
+			if str, ok := ast.StringInit(a.Type, a.Init); ok {
+				n = len(str.Val) + 1
+			}
+			a.Type = ast.ArrayOf(elem, n)
+			a.Init.SetType(a.Type)
+		}
+	}
+	if a.Init != nil && (c.fn == nil || a.Static || a.Extern) {
+		c.staticInit(a.Init)
+	}
+	a.Obj = c.declareVar(a.Token, a.Type, a, a.Static, a.Extern)
+}
+
+// initReader hands out the elements of an initializer list in order, so
+// that an aggregate whose braces are elided takes as many as it needs.
+type initReader struct {
+	list []ast.Expr
+	head *ast.CType // type of list[0] once checked
+}
+
+func (r *initReader) next() {
+	r.list = r.list[1:]
+	r.head = nil
+}
+
+// initList checks the initializer list init of an object of type t and
+// gives every element or member it initializes an entry of its own, so
+// that the list mirrors t: an aggregate whose braces are elided, as in
+// int m[2][2] = {1, 2, 3, 4}, gets a nested list. For a union only the
+// first member is initialized.
+func (c *Checker) initList(t *ast.CType, init *ast.ArrayInit) {
+	init.SetType(t)
+	if t.IsArray() {
+		if str, ok := ast.StringInit(t, init); ok {
+			c.stringInit(t, str)
+			return
+		}
+	} else if !t.IsStruct() {
+		c.errorf(init.Pos(), "initializer list for type '%s' is not supported", t)
+		return
+	}
+	r := &initReader{list: init.List}
+	init.List = c.initElems(t, init.Token, r)
+	if len(r.list) == 0 {
+		return
+	}
+	if t.IsArray() {
+		c.errorf(r.list[0].Pos(), "excess elements in array initializer")
+	} else {
+		c.errorf(r.list[0].Pos(), "excess elements in %s initializer", t.Struct.Keyword())
+	}
+}
+
+// initElems takes the initializers of the elements or members of the
+// aggregate t from r. Lists made up for elided braces get the position of
+// the brace tok enclosing them.
+func (c *Checker) initElems(t *ast.CType, tok *token.Token, r *initReader) []ast.Expr {
+	var elems []ast.Expr
+	for len(r.list) > 0 {
+		n := len(r.list)
+		switch {
+		case t.IsArray() && (t.Len < 0 || len(elems) < t.Len):
+			elems = append(elems, c.initElem(t.Elem(), tok, r))
+		case t.IsStruct() && len(elems) < len(t.Struct.Fields) && (!t.Struct.Union || len(elems) == 0):
+			elems = append(elems, c.initElem(t.Struct.Fields[len(elems)].Type, tok, r))
+		default:
+			return elems
+		}
+		if t.Len < 0 && len(r.list) == n {
+			break // the elements take no initializers
+		}
+	}
+	return elems
+}
+
+// initElem takes the initializer of an object of type t from r. An
+// aggregate is initialized by a list, by a string literal for a char
+// array, or by a struct of its own type; otherwise its braces are elided.
+func (c *Checker) initElem(t *ast.CType, tok *token.Token, r *initReader) ast.Expr {
+	e := r.list[0]
+	if init, ok := e.(*ast.ArrayInit); ok {
+		r.next()
+		c.initList(t, init)
+		return init
+	}
+	if str, ok := e.(*ast.StringVal); ok && t.IsArray() && t.Elem().Kind == ast.C_char {
+		r.next()
+		c.stringInit(t, str)
+		init := &ast.ArrayInit{Token: str.Token, List: []ast.Expr{str}}
+		init.SetType(t)
+		return init
+	}
+	if t.IsArray() || t.IsStruct() && !c.initType(r).IsStruct() {
+		init := &ast.ArrayInit{Token: tok, List: c.initElems(t, tok, r)}
+		init.SetType(t)
+		return init
+	}
+	from := c.initType(r)
+	r.next()
+	c.assignable(t, from, e, initializing)
+	return e
+}
+
+// initType checks the next initializer of r once and returns its type.
+func (c *Checker) initType(r *initReader) *ast.CType {
+	if r.head == nil {
+		r.head = c.expr(r.list[0])
+	}
+	return r.head
+}
+
+// stringInit checks the string literal str initializing a char array of
+// type t.
+func (c *Checker) stringInit(t *ast.CType, str *ast.StringVal) {
+	c.expr(str)
+	if t.Len >= 0 && len(str.Val) > t.Len {
+		c.diags.Warnf(str.Pos(), token.Position{}, "initializer-string for char array is too long")
+	}
+}
+
+/**
+statement
+*/
+
+func (c *Checker) stmt(s ast.Stmt) {
+	switch v := s.(type) {
+	case *ast.BlockStmt:
+		c.openScope()
+		for _, n := range v.Nodes {
+			c.Check(n)
+		}
+		c.closeScope()
+	case *ast.ExprStmt:
+		c.expr(v.Expr)
+	case *ast.ReturnStmt:
+		c.returnStmt(v)
+	case *ast.IfStmt:
+		c.ifStmt(v)
+	case *ast.ForStmt:
+		c.openScope()
+		if v.E1 != nil {
+			c.Check(v.E1)
+		}
+		if v.E2 != nil {
+			c.cond(*v.E2)
+		}
+		if v.E3 != nil {
+			c.expr(*v.E3)
+		}
+		c.loop(v.Block)
+		c.closeScope()
+	case *ast.WhileStmt:
+		c.cond(v.Cond)
+		c.loop(v.Body)
+	case *ast.DoWhileStmt:
+		c.loop(v.Body)
+		c.cond(v.Cond)
+	case *ast.SwitchStmt:
+		c.switchStmt(v)
+	case *ast.CaseStmt:
+		c.caseStmt(v)
+	case *ast.LabeledStmt:
+		c.labeledStmt(v)
+	case *ast.GotoStmt:
+		c.gotos = append(c.gotos, v)
+	case *ast.BreakStmt:
+		if c.loops == 0 && len(c.switches) == 0 {
+			c.errorTok(v.Token, "'break' statement not in loop or switch statement")
+		}
+	case *ast.ContinueStmt:
+		if c.loops == 0 {
+			c.errorTok(v.Token, "'continue' statement not in loop statement")
+		}
+	}
+}
+
+// loop checks the body of a loop, in which break and continue are allowed.
+func (c *Checker) loop(b ast.Stmt) {
+	c.loops++
+	c.stmt(b)
+	c.loops--
+}
+
+func (c *Checker) switchStmt(s *ast.SwitchStmt) {
+	t := c.expr(s.Expr)
+	if !t.IsInteger() && !isBad(s.Expr) {
+		c.errorf(s.Expr.Pos(), "statement requires expression of integer type ('%s' invalid)", t)
+	}
+	c.switches = append(c.switches, s)
+	c.stmt(s.Block)
+	c.switches = c.switches[:len(c.switches)-1]
+	if t.Kind == ast.C_enum && s.Default == nil {
+		c.unhandled(s, t.Enum)
+	}
+}
+
+// unhandled warns about the constants of e that no case of the switch
+// statement s over e handles.
+func (c *Checker) unhandled(s *ast.SwitchStmt, e *ast.EnumType) {
+	handled := map[int]bool{}
+	for _, n := range s.Cases {
+		handled[n.Value] = true
+	}
+	var names []string
+	for _, en := range e.Consts {
+		if en.Obj != nil && !handled[en.Obj.Value] {
+			names = append(names, "'"+en.Name.String()+"'")
+		}
+	}
+	pos := s.Expr.Pos()
+	switch len(names) {
+	case 0:
+	case 1:
+		c.diags.Warnf(pos, token.Position{}, "enumeration value %s not handled in switch", names[0])
+	case 2:
+		c.diags.Warnf(pos, token.Position{}, "enumeration values %s and %s not handled in switch", names[0], names[1])
+	case 3:
+		c.diags.Warnf(pos, token.Position{}, "enumeration values %s, %s, and %s not handled in switch", names[0], names[1], names[2])
+	default:
+		c.diags.Warnf(pos, token.Position{}, "%d enumeration values not handled in switch: %s, %s, %s...", len(names), names[0], names[1], names[2])
+	}
+}
+
+// caseStmt adds a case label to the innermost switch statement.
+func (c *Checker) caseStmt(n *ast.CaseStmt) {
+	defer c.stmt(n.Stmt)
+
+	if len(c.switches) == 0 {
+		if n.Expr == nil {
+			c.errorTok(n.Token, "'default' statement not in switch statement")
+		} else {
+			c.errorTok(n.Token, "'case' statement not in switch statement")
+		}
+		return
+	}
+	s := c.switches[len(c.switches)-1]
+
+	if n.Expr == nil {
+		if s.Default != nil {
+			c.errorTok(n.Token, "multiple default labels in one switch").
+				Notef(s.Default.Pos(), token.Position{}, "previous case defined here")
+			return
+		}
+		s.Default = n
+		return
+	}
+
+	c.expr(n.Expr)
+	v, ok := ast.IntConst(n.Expr)
+	if !ok {
+		if !isBad(n.Expr) {
+			c.errorf(n.Expr.Pos(), "expression is not an integer constant expression")
+		}
+		return
+	}
+	if t := ast.Promote(s.Expr.Type()); t.IsInteger() {
+		if w := ast.ConvertInt(t, v); w != v && t.Bytes() < n.Expr.Type().Bytes() {
+			c.diags.Warnf(n.Expr.Pos(), token.Position{}, "overflow converting case value to switch condition type (%d to %d)", v, w)
+		}
+		v = ast.ConvertInt(t, v)
+	}
+	n.Value = v
+	for _, prev := range s.Cases {
+		if prev.Value == v {
+			c.errorf(n.Expr.Pos(), "duplicate case value '%d'", v).
+				Notef(prev.Expr.Pos(), token.Position{}, "previous case defined here")
+			return
+		}
+	}
+	s.Cases = append(s.Cases, n)
+}
+
+func (c *Checker) returnStmt(r *ast.ReturnStmt) {
+	if c.fn == nil {
+		return
+	}
+	result := c.fn.Type.Base
+	if result.IsVoid() {
+		if r.Expr != nil {
+			if t := c.expr(r.Expr); !t.IsVoid() {
+				c.errorf(r.Expr.Pos(), "void function '%s' should not return a value", c.fn.Name)
+			}
+		}
+		return
+	}
+	if r.Expr == nil {
+		c.errorTok(r.Token, "non-void function '%s' should return a value", c.fn.Name)
+		return
+	}
+	c.assign(result, r.Expr, returning)
+}
+
+func (c *Checker) ifStmt(i *ast.IfStmt) {
+	if i.Expr != nil {
+		c.cond(*i.Expr)
+	}
+	c.stmt(i.Block)
+	if i.Else != nil {
+		c.ifStmt(i.Else)
+	}
+}
+
+// cond checks an expression used as a condition.
+func (c *Checker) cond(e ast.Expr) {
+	if t := c.expr(e).Decay(); !t.IsScalar() && !isBad(e) {
+		c.errorf(e.Pos(), "statement requires expression of scalar type ('%s' invalid)", t)
+	}
+}
+
+type assignContext int
+
+const (
+	initializing assignContext = iota
+	assigning
+	returning
+	passing
+)
+
+func (ctx assignContext) describe(to, from *ast.CType) string {
+	switch ctx {
+	case initializing:
+		return fmt.Sprintf("initializing '%s' with an expression of type '%s'", to, from)
+	case assigning:
+		return fmt.Sprintf("assigning to '%s' from '%s'", to, from)
+	case returning:
+		return fmt.Sprintf("returning '%s' from a function with result type '%s'", from, to)
+	default:
+		return fmt.Sprintf("passing '%s' to parameter of type '%s'", from, to)
+	}
+}
+
+// assign checks that e can be assigned to a value of type to.
+func (c *Checker) assign(to *ast.CType, e ast.Expr, ctx assignContext) {
+	c.assignable(to, c.expr(e), e, ctx)
+}
+
+// assignable checks the conversion to type to of the expression e, whose
+// type from is checked already.
+func (c *Checker) assignable(to, from *ast.CType, e ast.Expr, ctx assignContext) {
+	from = from.Decay()
+	if isBad(e) {
+		return
+	}
+	switch {
+	case to.Kind == ast.C_ldouble:
+		c.errorf(e.Pos(), "'long double' is not supported")
+	case to.IsArith() && from.IsArith():
+	case to.IsStruct() && from.IsStruct() && to.Struct == from.Struct:
+	case to.IsPtr() && from.IsPtr():
+		t, f := to.Base, from.Base
+		switch {
+		case f.Const && !t.Const || f.Volatile && !t.Volatile:
+			c.diags.Warnf(e.Pos(), token.Position{}, "%s discards qualifiers", ctx.describe(to, from))
+		case !t.IsVoid() && !f.IsVoid() && !ast.Compatible(t.Unqualified(), f.Unqualified()):
+			c.diags.Warnf(e.Pos(), token.Position{}, "incompatible pointer types %s", ctx.describe(to, from))
+		}
+	case to.IsPtr() && isNullPtr(e):
+	case to.IsPtr() && from.IsInteger():
+		c.errorf(e.Pos(), "incompatible integer to pointer conversion %s", ctx.describe(to, from))
+	case to.Kind == ast.C_bool && from.IsPtr():
+	case to.IsInteger() && from.IsPtr():
+		c.errorf(e.Pos(), "incompatible pointer to integer conversion %s", ctx.describe(to, from))
+	default:
+		c.errorf(e.Pos(), "incompatible types %s", ctx.describe(to, from))
+	}
+}
+
+/**
+expression
+*/
+
+// expr computes, records and returns the type of e. Values of type long
+// double are not supported, so that type may only be declared.
+func (c *Checker) expr(e ast.Expr) *ast.CType {
+	t := c.exprType(e)
+	if t.Kind == ast.C_ldouble {
+		c.errorf(e.Pos(), "'long double' is not supported")
+		t = ast.DoubleType
+	}
+	e.SetType(t)
+	return t
+}
+
+func (c *Checker) exprType(e ast.Expr) *ast.CType {
+	switch v := e.(type) {
+	case *ast.IntVal:
+		return v.ConstType()
+	case *ast.CharVal:
+		return ast.IntType
+	case *ast.FloatVal:
+		return v.ConstType()
+	case *ast.StringVal:
+		t := ast.ArrayOf(ast.CharType, len(v.Val)+1)
+		v.Obj = &ast.Object{Kind: ast.VarObj, Type: t, Decl: v, Static: true}
+		return t
+	case *ast.Ident:
+		v.Obj = c.resolve(v.Token)
+		if v.Obj == nil {
+			return ast.IntType
+		}
+		return v.Obj.Type
+	case *ast.BinaryExpr:
+		return c.binaryExpr(v)
+	case *ast.UnaryExpr:
+		return c.unaryExpr(v)
+	case *ast.CondExpr:
+		c.cond(v.Cond)
+		l := c.expr(v.L).Decay()
+		r := c.expr(v.R).Decay()
+		if l.IsArith() && r.IsArith() {
+			return ast.UsualArith(l, r)
+		}
+		if l.IsStruct() && r.IsStruct() && l.Struct == r.Struct {
+			return l
+		}
+		if l.IsPtr() && (r.IsPtr() || isNullPtr(v.R)) || r.IsPtr() && isNullPtr(v.L) {
+			if l.IsPtr() {
+				return l
+			}
+			return r
+		}
+		if l.IsVoid() && r.IsVoid() {
+			return l
+		}
+		c.errorf(v.Pos(), "incompatible operand types ('%s' and '%s')", l, r)
+		return l
+	case *ast.AssignExpr:
+		return c.assignExpr(v)
+	case *ast.IncExpr:
+		return c.incDec(v.X, v.Op)
+	case *ast.DecExpr:
+		return c.incDec(v.X, v.Op)
+	case *ast.FuncCall:
+		return c.funcCall(v)
+	case *ast.PtrVal:
+		t := c.expr(v.X).Decay()
+		if isBad(v.X) {
+			return ast.IntType
+		}
+		if !t.IsPtr() {
+			c.errorTok(v.Token, "indirection requires pointer operand ('%s' invalid)", t)
+			return t
+		}
+		return t.Base
+	case *ast.AddressVal:
+		return c.addressVal(v)
+	case *ast.SubscriptExpr:
+		return c.subscriptExpr(v)
+	case *ast.MemberExpr:
+		return c.memberExpr(v)
+	case *ast.SizeofExpr:
+		return c.sizeofExpr(v)
+	case *ast.CastExpr:
+		return c.castExpr(v)
+	case *ast.VaStartExpr:
+		return c.vaStart(v)
+	case *ast.VaArgExpr:
+		return c.vaArg(v)
+	case *ast.BadExpr:
+		return ast.IntType
+	default:
+		c.errorf(e.Pos(), "unexpected expression")
+		return ast.IntType
+	}
+}
+
+// sizeofExpr computes the type whose size or alignment is taken, which
+// must be complete.
+func (c *Checker) sizeofExpr(s *ast.SizeofExpr) *ast.CType {
+	op := s.Token.String()
+	if s.X != nil {
+		if s.Token.Kind == token.ALIGNOF {
+			c.diags.Warnf(s.Token.Pos, s.Token.End(), "'%s' applied to an expression is a GNU extension", op)
+		}
+		if s.Of = c.expr(s.X); isBad(s.X) {
+			return ast.ULongType
+		}
+	}
+	switch {
+	case s.Of.Kind == ast.C_func:
+		c.errorTok(s.Token, "invalid application of '%s' to a function type", op)
+	case !s.Of.IsComplete():
+		c.errorTok(s.Token, "invalid application of '%s' to an incomplete type '%s'", op, s.Of)
+	}
+	return ast.ULongType
+}
+
+// castExpr checks an explicit conversion, which is allowed between scalar
+// types except pointers and floating types, and to void.
+func (c *Checker) castExpr(e *ast.CastExpr) *ast.CType {
+	from, to := c.expr(e.X).Decay(), e.To
+	switch {
+	case isBad(e.X) || to.IsVoid() || to.Kind == ast.C_ldouble: // see expr
+	case !to.IsScalar():
+		c.errorf(e.Pos(), "used type '%s' where arithmetic or pointer type is required", to)
+	case !from.IsScalar():
+		c.errorf(e.X.Pos(), "operand of type '%s' where arithmetic or pointer type is required", from)
+	case to.IsPtr() && from.IsFloat():
+		c.errorf(e.X.Pos(), "operand of type '%s' cannot be cast to a pointer type", from)
+	case from.IsPtr() && to.IsFloat():
+		c.errorf(e.X.Pos(), "pointer cannot be cast to type '%s'", to)
+	}
+	return to
+}
+
+// vaStart checks that va_start is used on a va_list in a variadic
+// function.
+func (c *Checker) vaStart(v *ast.VaStartExpr) *ast.CType {
+	c.vaList(v.Ap)
+	c.expr(v.Last)
+	if c.fn == nil || !c.fn.Type.Variadic {
+		c.errorTok(v.Token, "'va_start' used in function with fixed arguments")
+	}
+	return ast.VoidType
+}
+
+// vaArg checks that va_arg reads a scalar, which is passed in a single
+// register or stack slot.
+func (c *Checker) vaArg(v *ast.VaArgExpr) *ast.CType {
+	c.vaList(v.Ap)
+	switch t := v.To; {
+	case !t.IsScalar():
+		c.errorTok(v.Token, "va_arg of type '%s' is not supported", t)
+	case t.Kind == ast.C_float || t.IsInteger() && t.Bytes() < ast.IntType.Bytes():
+		c.diags.Warnf(v.Token.Pos, v.Token.End(), "second argument to 'va_arg' is of promotable type '%s'", t)
+	}
+	return v.To
+}
+
+// vaList checks that ap is a va_list, which decays to a pointer to the
+// struct declared by <stdarg.h>.
+func (c *Checker) vaList(ap ast.Expr) {
+	t := c.expr(ap).Decay()
+	if isBad(ap) {
+		return
+	}
+	if !t.IsPtr() || !t.Base.IsStruct() || t.Base.Struct.Tag == nil || t.Base.Struct.Tag.String() != "__va_list_tag" {
+		c.errorf(ap.Pos(), "'%s' is not a va_list", t)
+	}
+}
+
+func (c *Checker) binaryExpr(b *ast.BinaryExpr) *ast.CType {
+	t := c.binaryType(b)
+	switch b.Op.Kind {
+	case token.ADD, token.SUB, token.MUL, token.DIV, token.REM, token.LSHIFT, token.RSHIFT:
+		if t.IsInteger() {
+			c.constOp(b.Op, b.Op.Kind, t, b.X, b.Y)
+		}
+	}
+	return t
+}
+
+func (c *Checker) binaryType(b *ast.BinaryExpr) *ast.CType {
+	x := c.expr(b.X).Decay()
+	y := c.expr(b.Y).Decay()
+	if isBad(b.X) || isBad(b.Y) {
+		return ast.IntType
+	}
+	integer := ast.IntType
+
+	switch b.Op.Kind {
+	case token.ADD:
+		switch {
+		case x.IsArith() && y.IsArith():
+			return ast.UsualArith(x, y)
+		case x.IsPtr() && y.IsInteger():
+			return x
+		case x.IsInteger() && y.IsPtr():
+			return y
+		}
+	case token.SUB:
+		switch {
+		case x.IsArith() && y.IsArith():
+			return ast.UsualArith(x, y)
+		case x.IsPtr() && y.IsInteger():
+			return x
+		case x.IsPtr() && y.IsPtr():
+			if !samePointee(x, y) {
+				break
+			}
+			return ast.LongType
+		}
+	case token.MUL, token.DIV:
+		if x.IsArith() && y.IsArith() {
+			return ast.UsualArith(x, y)
+		}
+	case token.REM, token.AND, token.OR, token.XOR:
+		if x.IsInteger() && y.IsInteger() {
+			return ast.UsualArith(x, y)
+		}
+	case token.LSHIFT, token.RSHIFT:
+		if x.IsInteger() && y.IsInteger() {
+			return ast.Promote(x)
+		}
+	case token.EQ, token.NE, token.LT, token.LE, token.GT, token.GE:
+		switch {
+		case x.IsArith() && y.IsArith():
+			return integer
+		case x.IsPtr() && y.IsPtr():
+			if !samePointee(x, y) && !x.Base.IsVoid() && !y.Base.IsVoid() {
+				c.diags.Warnf(b.Op.Pos, b.Op.End(), "comparison of distinct pointer types ('%s' and '%s')", x, y)
+			}
+			return integer
+		case x.IsPtr() && isNullPtr(b.Y), y.IsPtr() && isNullPtr(b.X):
+			return integer
+		}
+	case token.LAND, token.LOR:
+		if x.IsScalar() && y.IsScalar() {
+			return integer
+		}
+	}
+	c.errorTok(b.Op, "invalid operands to binary expression ('%s' and '%s')", x, y)
+	return integer
+}
+
+// constOp warns about the integer operation x op y of type t if C does
+// not define its result for its constant operands, or for a constant y
+// alone as in x / 0.
+func (c *Checker) constOp(tok *token.Token, op token.TokenKind, t *ast.CType, x, y ast.Expr) {
+	n, ok := ast.IntConst(y)
+	if !ok {
+		return
+	}
+	if op != token.LSHIFT && op != token.RSHIFT {
+		n = ast.ConvertInt(t, n)
+	}
+	m, isConst := ast.IntConst(x)
+	m = ast.ConvertInt(t, m)
+	r, err := ast.IntOp(op, t, m, n)
+	if !isConst && (err == ast.Overflow || err == ast.NegativeValue) {
+		return
+	}
+	switch err {
+	case ast.DivByZero:
+		what := "division"
+		if op == token.REM {
+			what = "remainder"
+		}
+		c.diags.Warnf(tok.Pos, tok.End(), "%s by zero is undefined", what)
+	case ast.NegativeShift:
+		c.diags.Warnf(tok.Pos, tok.End(), "shift count is negative")
+	case ast.WideShift:
+		c.diags.Warnf(tok.Pos, tok.End(), "shift count >= width of type")
+	case ast.NegativeValue:
+		c.diags.Warnf(tok.Pos, tok.End(), "shifting a negative signed value is undefined")
+	case ast.Overflow:
+		if op == token.LSHIFT {
+			full := new(big.Int).Lsh(big.NewInt(int64(m)), uint(n))
+			c.diags.Warnf(tok.Pos, tok.End(), "signed shift result (%#x) requires %d bits to represent, but '%s' only has %d bits",
+				full, full.BitLen()+1, t, t.Bytes()*8)
+			return
+		}
+		c.diags.Warnf(tok.Pos, tok.End(), "overflow in expression; result is %d with type '%s'", r, t)
+	}
+}
+
+func (c *Checker) unaryExpr(u *ast.UnaryExpr) *ast.CType {
+	t := c.expr(u.Expr).Decay()
+	if isBad(u.Expr) {
+		return t
+	}
+	switch u.Op.Kind {
+	case token.NOT:
+		if t.IsScalar() {
+			return ast.IntType
+		}
+	case token.TILDE:
+		if t.IsInteger() {
+			return ast.Promote(t)
+		}
+	default: // + -
+		if !t.IsArith() {
+			break
+		}
+		p := ast.Promote(t)
+		if x, ok := ast.IntConst(u.Expr); ok && u.Op.Kind == token.SUB && p.IsInteger() {
+			if r, err := ast.IntOp(token.SUB, p, 0, ast.ConvertInt(p, x)); err == ast.Overflow {
+				c.diags.Warnf(u.Op.Pos, u.Op.End(), "overflow in expression; result is %d with type '%s'", r, p)
+			}
+		}
+		return p
+	}
+	c.errorTok(u.Op, "invalid argument type '%s' to unary expression", t)
+	return ast.IntType
+}
+
+func (c *Checker) memberExpr(m *ast.MemberExpr) *ast.CType {
+	integer := ast.IntType
+	t := c.expr(m.X)
+	if isBad(m.X) {
+		return integer
+	}
+	if m.Op.Kind == token.ARROW {
+		t = t.Decay()
+		if !t.IsPtr() {
+			c.errorTok(m.Op, "member reference type '%s' is not a pointer", t)
+			return integer
+		}
+		t = t.Elem()
+	} else if t.IsPtr() && t.Base.IsStruct() {
+		c.errorTok(m.Op, "member reference type '%s' is a pointer; did you mean to use '->'?", t)
+		return integer
+	}
+	if !t.IsStruct() {
+		c.errorTok(m.Op, "member reference base type '%s' is not a structure or union", t)
+		return integer
+	}
+	if !t.Struct.Complete {
+		c.errorTok(m.Op, "incomplete definition of type '%s'", t)
+		return integer
+	}
+	m.Field = t.Struct.Field(m.Name.String())
+	if m.Field == nil {
+		c.errorTok(m.Name, "no member named '%s' in '%s'", m.Name, t)
+		return integer
+	}
+	if q := t.Const || t.Volatile; q {
+		// members of a qualified struct have its qualifiers
+		return m.Field.Type.Qualified(t.Const, t.Volatile)
+	}
+	return m.Field.Type
+}
+
+// isObject reports whether e designates an object, whose address can
+// be taken.
+func isObject(e ast.Expr) bool {
+	switch v := e.(type) {
+	case *ast.MemberExpr:
+		return v.Op.Kind == token.ARROW || isObject(v.X)
+	case *ast.Ident:
+		return v.Obj == nil || v.Obj.Kind == ast.VarObj
+	case *ast.PtrVal, *ast.SubscriptExpr, *ast.StringVal, *ast.BadExpr:
+		return true
+	default:
+		return false
+	}
+}
+
+// isLvalue reports whether e designates an object that can be assigned.
+func isLvalue(e ast.Expr) bool {
+	return isObject(e) && !e.Type().IsArray() && !e.Type().IsFunc()
+}
+
+func (c *Checker) addressVal(a *ast.AddressVal) *ast.CType {
+	t := c.expr(a.X)
+	if !isObject(a.X) && !t.IsFunc() {
+		c.errorTok(a.Token, "cannot take the address of an rvalue of type '%s'", t)
+	}
+	return ast.PointerTo(t)
+}
+
+// subscriptExpr checks x[i], which is *(x + i) and thus may be written i[x].
+func (c *Checker) subscriptExpr(s *ast.SubscriptExpr) *ast.CType {
+	x := c.expr(s.X).Decay()
+	i := c.expr(s.Index).Decay()
+	if isBad(s.X) || isBad(s.Index) {
+		return ast.IntType
+	}
+	if i.IsPtr() && x.IsInteger() {
+		x, i = i, x
+	}
+	if !x.IsPtr() {
+		c.errorf(s.X.Pos(), "subscripted value is not an array or pointer")
+		return ast.IntType
+	}
+	if !i.IsInteger() {
+		c.errorf(s.Index.Pos(), "array subscript is not an integer")
+	}
+	return x.Base
+}
+
+// binaryOp maps the compound assignments checked like binary operators
+// to the operators.
+var binaryOp = map[token.TokenKind]token.TokenKind{
+	token.DIV_ASSIGN:   token.DIV,
+	token.REM_ASSIGN:   token.REM,
+	token.LEFT_ASSIGN:  token.LSHIFT,
+	token.RIGHT_ASSIGN: token.RSHIFT,
+}
+
+func (c *Checker) assignExpr(a *ast.AssignExpr) *ast.CType {
+	l := c.expr(a.L)
+	if !isLvalue(a.L) {
+		c.errorf(a.L.Pos(), "expression is not assignable")
+		c.expr(a.R)
+		return l
+	}
+	if l.Const {
+		c.errorf(a.L.Pos(), "cannot assign to expression with const-qualified type '%s'", l)
+	}
+	switch a.Op.Kind {
+	case token.ASSIGN:
+		c.assign(l, a.R, assigning)
+	case token.ADD_ASSIGN, token.SUB_ASSIGN:
+		r := c.expr(a.R).Decay()
+		if !(l.IsArith() && r.IsArith()) && !(l.IsPtr() && r.IsInteger()) {
+			c.errorTok(a.Op, "invalid operands to binary expression ('%s' and '%s')", l, r)
+		}
+	default:
+		r := c.expr(a.R).Decay()
+		ok := l.IsArith() && r.IsArith()
+		if a.Op.Kind != token.MUL_ASSIGN && a.Op.Kind != token.DIV_ASSIGN {
+			ok = l.IsInteger() && r.IsInteger()
+		}
+		if !ok {
+			c.errorTok(a.Op, "invalid operands to binary expression ('%s' and '%s')", l, r)
+			break
+		}
+		switch a.Op.Kind {
+		case token.DIV_ASSIGN, token.REM_ASSIGN:
+			if t := ast.UsualArith(l, r); t.IsInteger() {
+				c.constOp(a.Op, binaryOp[a.Op.Kind], t, a.L, a.R)
+			}
+		case token.LEFT_ASSIGN, token.RIGHT_ASSIGN:
+			c.constOp(a.Op, binaryOp[a.Op.Kind], ast.Promote(l), a.L, a.R)
+		}
+	}
+	return l
+}
+
+func (c *Checker) incDec(x ast.Expr, op *token.Token) *ast.CType {
+	t := c.expr(x)
+	if isBad(x) {
+		return t
+	}
+	if !isLvalue(x) || !t.IsScalar() {
+		c.errorTok(op, "cannot increment or decrement value of type '%s'", t)
+	} else if t.Const {
+		c.errorf(x.Pos(), "cannot assign to expression with const-qualified type '%s'", t)
+	}
+	return t
+}
+
+// funcCall checks a call of a function designator or of a pointer to a
+// function. Functions must be declared before they are called.
+func (c *Checker) funcCall(f *ast.FuncCall) *ast.CType {
+	var t *ast.CType
+	id, named := f.Func.(*ast.Ident)
+	if !named || c.scope.Lookup(id.Token.String()) != nil {
+		t = c.expr(f.Func).Decay()
+	}
+	for _, a := range f.Args {
+		c.expr(a)
+	}
+	if t == nil {
+		c.errorTok(id.Token, "implicit declaration of function '%s'", id.Token)
+		return ast.IntType
+	}
+	if isBad(f.Func) {
+		return ast.IntType
+	}
+	if !t.IsPtr() || !t.Base.IsFunc() {
+		c.errorf(f.Func.Pos(), "called object type '%s' is not a function or function pointer", t)
+		return ast.IntType
+	}
+	ft := t.Base
+
+	// a function called by name is declared by a definition or prototype,
+	// and its name is underlined
+	var def *ast.FuncDef
+	pos, end := f.Func.Pos(), token.Position{}
+	if named {
+		end = id.Token.End()
+		if id.Obj.Kind == ast.FuncObj {
+			def, _ = id.Obj.Decl.(*ast.FuncDef)
+		}
+	}
+	params := ft.Params
+	variadic := ft.Variadic
+	if ft.NoProto {
+		// the arguments are promoted, the definition may tell their number
+		if def != nil && def.Block != nil && len(def.Args) != len(f.Args) {
+			few := "few"
+			if len(f.Args) > len(def.Args) {
+				few = "many"
+			}
+			c.diags.Warnf(pos, end, "too %s arguments in call to '%s'", few, def.Name)
+		}
+		return ft.Base
+	}
+	if len(f.Args) < len(params) || len(f.Args) > len(params) && !variadic {
+		few, least := "few", ""
+		if len(f.Args) > len(params) {
+			few = "many"
+		}
+		if variadic {
+			least = "at least "
+		}
+		d := c.diags.Errorf(pos, end, "too %s arguments to function call, expected %s%d, have %d", few, least, len(params), len(f.Args))
+		if def != nil {
+			d.Notef(def.Pos(), def.Token.End(), "'%s' declared here", def.Name)
+		}
+	}
+	for i, a := range f.Args {
+		if i < len(params) {
+			c.assign(params[i], a, passing)
+		}
+	}
+	return ft.Base
+}
+
+/**
+type helpers
+*/
+
+// samePointee reports whether the pointers x and y point to compatible
+// types, ignoring qualifiers.
+func samePointee(x, y *ast.CType) bool {
+	return ast.Compatible(x.Base.Unqualified(), y.Base.Unqualified())
+}
+
+// isNullPtr reports whether e is a null pointer constant, an integer
+// constant expression with the value 0.
+func isNullPtr(e ast.Expr) bool {
+	n, ok := ast.IntConst(e)
+	return ok && n == 0
+}
+
+func isBad(e ast.Expr) bool {
+	_, ok := e.(*ast.BadExpr)
+	return ok
+}
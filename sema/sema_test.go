@@ -0,0 +1,665 @@
+package sema
+
+import (
+	"gocc/ast"
+	"gocc/diag"
+	"gocc/parser"
+	"testing"
+)
+
+func check(t *testing.T, src string) ([]ast.Node, *Checker) {
+	p := parser.NewParser([]byte(src))
+	nodes := p.ParseFile()
+	if p.Diags().HasErrors() {
+		t.Fatalf("%q: unexpected syntax error: %s", src, p.Diags().All()[0].Msg)
+	}
+	c := NewChecker()
+	for _, n := range nodes {
+		c.Check(n)
+	}
+	return nodes, c
+}
+
+var semaErrorTests = []struct {
+	source string
+	msgs   []string
+}{
+	{
+		"enum E { A, B }; enum F { X = 1.5, A }; int B; int main() { A = 1; return &B; }",
+		[]string{
+			"expression is not an integer constant expression",
+			"redefinition of 'A'",
+			"redefinition of 'B' as different kind of symbol",
+			"expression is not assignable",
+			"cannot take the address of an rvalue of type 'int'",
+			"incompatible pointer to integer conversion returning 'int *' from a function with result type 'int'",
+		},
+	},
+	{
+		"struct S; struct T { int a; } t; int f(void); int main() { double d = 0; int *p = 0; int a = sizeof(void) + sizeof(struct S) + sizeof f; a = (int)t; p = (int *)d; d = (double)p; t = (struct T)a; return _Alignof a; }",
+		[]string{
+			"invalid application of 'sizeof' to an incomplete type 'void'",
+			"invalid application of 'sizeof' to an incomplete type 'struct S'",
+			"invalid application of 'sizeof' to a function type",
+			"operand of type 'struct T' where arithmetic or pointer type is required",
+			"operand of type 'double' cannot be cast to a pointer type",
+			"pointer cannot be cast to type 'double'",
+			"used type 'struct T' where arithmetic or pointer type is required",
+			"'_Alignof' applied to an expression is a GNU extension",
+		},
+	},
+	{
+		"int main() { return a; }",
+		[]string{"use of undeclared identifier 'a'"},
+	},
+	{
+		"int main() { int a = 1; int a = 2; return a; }",
+		[]string{"redefinition of 'a'"},
+	},
+	{
+		"int f(int a) { int a; return 0; }",
+		[]string{"redefinition of 'a'"},
+	},
+	{
+		"int f(int a, int b) { return a + b; } int main() { return f(1); }",
+		[]string{"too few arguments to function call, expected 2, have 1"},
+	},
+	{
+		"int f() { return 1; } int g(void) { return 2; } int main() { return f(1, 2) + g(3); }",
+		[]string{"too many arguments in call to 'f'", "too many arguments to function call, expected 0, have 1"},
+	},
+	{
+		"int main() { return g(); }",
+		[]string{"implicit declaration of function 'g'"},
+	},
+	{
+		"void f() { return 1; }",
+		[]string{"void function 'f' should not return a value"},
+	},
+	{
+		"int f() { return; }",
+		[]string{"non-void function 'f' should return a value"},
+	},
+	{
+		"int *f(int *p) { int a = 1; return a; }",
+		[]string{"incompatible integer to pointer conversion returning 'int' from a function with result type 'int *'"},
+	},
+	{
+		"int main() { int a = 1; int *p = &a; a = p; return 0; }",
+		[]string{"incompatible pointer to integer conversion assigning to 'int' from 'int *'"},
+	},
+	{
+		"int main() { int a = 1; return *a; }",
+		[]string{"indirection requires pointer operand ('int' invalid)"},
+	},
+	{
+		"int main() { 1 = 2; return 0; }",
+		[]string{"expression is not assignable"},
+	},
+	{
+		"int main() { int *p; int *q; return p + q; }",
+		[]string{"invalid operands to binary expression ('int *' and 'int *')"},
+	},
+	{
+		"int main() { if (1) { int a = 1; } return a; }",
+		[]string{"use of undeclared identifier 'a'"},
+	},
+	{
+		"int main() { for (int i = 0; i < 2; i++) { } return i; }",
+		[]string{"use of undeclared identifier 'i'"},
+	},
+	{
+		"struct S { int a; }; int main() { struct S s; return s.b; }",
+		[]string{"no member named 'b' in 'struct S'"},
+	},
+	{
+		"struct S { int a; }; int main() { struct S *p; return p.a; }",
+		[]string{"member reference type 'struct S *' is a pointer; did you mean to use '->'?"},
+	},
+	{
+		"struct S { int a; }; int main() { struct S s; return s->a; }",
+		[]string{"member reference type 'struct S' is not a pointer"},
+	},
+	{
+		"int main() { int a; return a.b; }",
+		[]string{"member reference base type 'int' is not a structure or union"},
+	},
+	{
+		"struct S; int main() { struct S *p; struct S s; return p->a; }",
+		[]string{"variable has incomplete type 'struct S'", "incomplete definition of type 'struct S'"},
+	},
+	{
+		"struct S { int a; }; struct T { int a; }; int main() { struct S s; struct T t; s = t; return 0; }",
+		[]string{"incompatible types assigning to 'struct S' from 'struct T'"},
+	},
+	{
+		"struct S { int a; }; int main() { struct S s = {1, 2}; return s + 1; }",
+		[]string{"excess elements in struct initializer", "invalid operands to binary expression ('struct S' and 'int')"},
+	},
+	{
+		"struct S { int a; int b[2]; } s[] = {1, {2, 3}, 4, 5, 6}; int m[2][2] = {{1, 2, 3}, 4, 5, 6,};",
+		[]string{"excess elements in array initializer", "excess elements in array initializer"},
+	},
+	{
+		"struct S { int a[2]; }; int main() { struct S s; s.a = 0; return 0; }",
+		[]string{"expression is not assignable"},
+	},
+	{
+		"int main() { const int a = 1; a = 2; return a; }",
+		[]string{"cannot assign to expression with const-qualified type 'const int'"},
+	},
+	{
+		"int main() { int a; int *p = &a; int **pp = &p; int *q = &pp; return *q; }",
+		[]string{"incompatible pointer types initializing 'int *' with an expression of type 'int ***'"},
+	},
+	{
+		"int main() { const char c = 1; const char *p = &c; char *q = p; return 0; }",
+		[]string{"initializing 'char *' with an expression of type 'const char *' discards qualifiers"},
+	},
+	{
+		"int main() { break; continue; while (1 < 2) { break; continue; } return 0; }",
+		[]string{"'break' statement not in loop or switch statement", "'continue' statement not in loop statement"},
+	},
+	{
+		"int main() { int a = 0; switch (a) { case 1: break; case 'a': case 2: break; case 1: continue; } return 0; }",
+		[]string{"duplicate case value '1'", "'continue' statement not in loop statement"},
+	},
+	{
+		"int main() { int a = 0; switch (a) { default: break; case -1: default: break; case a: break; } return 0; }",
+		[]string{"multiple default labels in one switch", "expression is not an integer constant expression"},
+	},
+	{
+		"int main() { case 1: return 0; default: return 1; }",
+		[]string{"'case' statement not in switch statement", "'default' statement not in switch statement"},
+	},
+	{
+		"struct S { int a; }; int main() { struct S s; switch (s) { } return 0; }",
+		[]string{"statement requires expression of integer type ('struct S' invalid)"},
+	},
+	{
+		"int main() { goto a; a: goto b; a: b: c: return 0; }",
+		[]string{"redefinition of label 'a'", "unused label 'c'"},
+	},
+	{
+		"int f() { l: return 0; } int main() { goto l; return 0; }",
+		[]string{"unused label 'l'", "use of undeclared label 'l'"},
+	},
+	{
+		"int f() { return 0; } int main() { int a; int *p = &(a + 1); (a + 1)++; return a[0] + *f(); }",
+		[]string{
+			"cannot take the address of an rvalue of type 'int'",
+			"cannot increment or decrement value of type 'int'",
+			"subscripted value is not an array or pointer",
+			"indirection requires pointer operand ('int' invalid)",
+		},
+	},
+	{
+		"int main() { int a[2]; int *p = a; const int c = 1; c++; return p[p] + *&f; }",
+		[]string{
+			"cannot assign to expression with const-qualified type 'const int'",
+			"array subscript is not an integer",
+			"use of undeclared identifier 'f'",
+		},
+	},
+	{
+		"int g; int a = g; int *p = &g + 1; int b[2] = {1, g}; int main() { int l; static int *q = &l; static int *r = &g; return 0; }",
+		[]string{
+			"initializer element is not a compile-time constant",
+			"initializer element is not a compile-time constant",
+			"initializer element is not a compile-time constant",
+		},
+	},
+	{
+		`int main() { char a[2] = "abc"; char b[3] = "abc"; int c[] = "abc"; "abc" = 0; return 0; }`,
+		[]string{
+			"initializer-string for char array is too long",
+			"incompatible pointer to integer conversion initializing 'int' with an expression of type 'char *'",
+			"expression is not assignable",
+		},
+	},
+	{
+		"int f(int a); char f(int a); int g(int); int g(int a) { return a; } int g(int b) { return b; } int h; int h(void);",
+		[]string{"conflicting types for 'f'", "redefinition of 'g'", "redefinition of 'h' as different kind of symbol"},
+	},
+	{
+		"int printf(char *fmt, ...); extern int a = 1; int main() { extern int b = 2; printf(); return printf(\"%d\", a, b); }",
+		[]string{
+			"'extern' variable has an initializer",
+			"'extern' variable cannot have an initializer",
+			"too few arguments to function call, expected at least 1, have 0",
+		},
+	},
+	{
+		"double d = 1.5; float f = -d; int main() { double x = 2; int *p = 0; switch (x) { } return x % 2 + (~d) + p[x] + (x << 1); }",
+		[]string{
+			"initializer element is not a compile-time constant",
+			"statement requires expression of integer type ('double' invalid)",
+			"invalid operands to binary expression ('double' and 'int')",
+			"invalid argument type 'double' to unary expression",
+			"array subscript is not an integer",
+			"invalid operands to binary expression ('double' and 'int')",
+		},
+	},
+	{
+		`enum { A = 2147483647, B, C = 1 / 0 };
+int n; int a[(int)sizeof n - 5]; int b[n];
+int main() { int x = 2147483647 + 1; x = 1 << 40; x %= 0; x = -1 << 1; switch (x) { case 0x100000001L: break; } return -(-2147483647 - 1); }`,
+		[]string{
+			"overflow in enumeration value",
+			"division by zero is undefined",
+			"expression is not an integer constant expression",
+			"'a' declared as an array with a negative size",
+			"array size must be an integer constant",
+			"overflow in expression; result is -2147483648 with type 'int'",
+			"shift count >= width of type",
+			"remainder by zero is undefined",
+			"shifting a negative signed value is undefined",
+			"overflow converting case value to switch condition type (4294967297 to 1)",
+			"overflow in expression; result is -2147483648 with type 'int'",
+		},
+	},
+	{
+		"extern long double x; long double f(long double); int main() { return x + f(1) + (long double)2; }",
+		[]string{
+			"'long double' is not supported",
+			"'long double' is not supported",
+			"'long double' is not supported",
+			"'long double' is not supported",
+		},
+	},
+	{
+		`typedef struct __va_list_tag { int gp, fp; void *stack, *save; } va_list[1];
+struct S { int a; };
+int f(int n) { va_list ap; __builtin_va_start(ap, n); return n; }
+int g(int n, ...) { va_list ap; __builtin_va_start(ap, n); __builtin_va_arg(ap, struct S); return __builtin_va_arg(n, int); }`,
+		[]string{
+			"'va_start' used in function with fixed arguments",
+			"va_arg of type 'struct S' is not supported",
+			"'int' is not a va_list",
+		},
+	},
+	{
+		"int f(int); int main() { int x = 1; x(); int (*q)(int) = f; f = q; return q(1, 2) + (*q)(); }",
+		[]string{
+			"called object type 'int' is not a function or function pointer",
+			"expression is not assignable",
+			"too many arguments to function call, expected 1, have 2",
+			"too few arguments to function call, expected 1, have 0",
+		},
+	},
+}
+
+func TestSemaErrors(t *testing.T) {
+	for _, tt := range semaErrorTests {
+		_, c := check(t, tt.source)
+		ds := c.Diags().All()
+		if len(ds) != len(tt.msgs) {
+			t.Errorf("%q: expected %d diagnostics, but got %d", tt.source, len(tt.msgs), len(ds))
+			for _, d := range ds {
+				t.Logf("%s", d.Msg)
+			}
+			continue
+		}
+		for i, d := range ds {
+			if d.Msg != tt.msgs[i] {
+				t.Errorf("%q: expected message is %q, but got %q", tt.source, tt.msgs[i], d.Msg)
+			}
+		}
+	}
+}
+
+func TestSwitchCases(t *testing.T) {
+	nodes, c := check(t, "int main() { int a = 0; switch (a) { case 2: default: case -1: case 'b': break; } return 0; }")
+	if c.Diags().Len() != 0 {
+		t.Fatalf("unexpected error: %s", c.Diags().All()[0].Msg)
+	}
+	s := nodes[0].(*ast.FuncDef).Block.Nodes[1].(*ast.SwitchStmt)
+	if s.Default == nil {
+		t.Errorf("default label is not recorded")
+	}
+	want := []int{2, -1, 'b'}
+	if len(s.Cases) != len(want) {
+		t.Fatalf("expected %d cases, but got %d", len(want), len(s.Cases))
+	}
+	for i, c := range s.Cases {
+		if c.Value != want[i] {
+			t.Errorf("expected case %d value is %d, but got %d", i, want[i], c.Value)
+		}
+	}
+}
+
+func TestEnumConst(t *testing.T) {
+	src := `enum E { A, B = 5, C, D = -2, F };
+int a[C];
+int main() {
+  enum { A = 7 } e = A;
+  switch (e) { case B: case C: default: break; }
+  return A;
+}`
+	nodes, c := check(t, src)
+	for _, d := range c.Diags().All() {
+		t.Errorf("unexpected diagnostic %s", d.Msg)
+	}
+	e := nodes[0].(*ast.TypeDecl).Type.Enum
+	want := []int{0, 5, 6, -2, -1}
+	for i, en := range e.Consts {
+		if en.Obj == nil || en.Obj.Kind != ast.ConstObj || en.Obj.Value != want[i] {
+			t.Errorf("expected %s is the constant %d, but got %+v", en.Name, want[i], en.Obj)
+		}
+	}
+	if n := nodes[1].(*ast.ArrayDef).Type.Len; n != 6 {
+		t.Errorf("expected array length is 6, but got %d", n)
+	}
+	f := nodes[2].(*ast.FuncDef)
+	s := f.Block.Nodes[1].(*ast.SwitchStmt)
+	if s.Cases[0].Value != 5 || s.Cases[1].Value != 6 {
+		t.Errorf("expected case values 5 and 6, but got %d and %d", s.Cases[0].Value, s.Cases[1].Value)
+	}
+	ret := f.Block.Nodes[2].(*ast.ReturnStmt).Expr.(*ast.Ident)
+	if ret.Obj.Value != 7 {
+		t.Errorf("expected return refers to the inner A")
+	}
+}
+
+func TestEnumSwitch(t *testing.T) {
+	tests := []struct {
+		cases string
+		msg   string
+	}{
+		{"case A: case B: case C: case D: case F:", ""},
+		{"case A: default:", ""},
+		{"case A: case B: case C: case D:", "enumeration value 'F' not handled in switch"},
+		{"case A: case B: case C:", "enumeration values 'D' and 'F' not handled in switch"},
+		{"case A: case B:", "enumeration values 'C', 'D', and 'F' not handled in switch"},
+		{"case 9:", "5 enumeration values not handled in switch: 'A', 'B', 'C'..."},
+	}
+	for _, tt := range tests {
+		src := "enum E { A, B, C, D, F }; void f(enum E e) { switch (e) { " + tt.cases + " break; } }"
+		_, c := check(t, src)
+		ds := c.Diags().All()
+		if tt.msg == "" {
+			if len(ds) != 0 {
+				t.Errorf("%q: unexpected diagnostic %s", tt.cases, ds[0].Msg)
+			}
+			continue
+		}
+		if len(ds) != 1 || ds[0].Msg != tt.msg || ds[0].Severity != diag.Warning {
+			t.Errorf("%q: expected warning %q, but got %v", tt.cases, tt.msg, ds)
+		}
+	}
+}
+
+func TestDeclList(t *testing.T) {
+	nodes, c := check(t, "typedef enum { A, B } E; E e = B; int a = 1, *p = &a, b[2] = {A, B};")
+	for _, d := range c.Diags().All() {
+		t.Errorf("unexpected diagnostic %s", d.Msg)
+	}
+	l := nodes[2].(*ast.DeclList)
+	a := l.List[0].(*ast.VarDef).Obj
+	init := (*l.List[1].(*ast.VarDef).Init).(*ast.AddressVal)
+	if a == nil || init.X.(*ast.Ident).Obj != a {
+		t.Errorf("expected p is initialized with the address of a")
+	}
+	if b := l.List[2].(*ast.ArrayDef); b.Obj == nil || b.Init.List[1].(*ast.Ident).Obj.Value != 1 {
+		t.Errorf("expected b is initialized with the constants of E")
+	}
+}
+
+func TestNoProto(t *testing.T) {
+	src := `int k();
+int j();
+int main() { return k(1) + j(1, 2, 3); }
+int k(int a) { return a; }
+int j(int a, int b, int c) { return k(a, b) + c; }`
+	nodes, c := check(t, src)
+	ds := c.Diags().All()
+	if len(ds) != 1 || ds[0].Msg != "too many arguments to function call, expected 1, have 2" {
+		t.Errorf("expected only the call k(a, b) after the definition of k is checked, but got %v", ds)
+	}
+	k := nodes[0].(*ast.FuncDef).Obj
+	if k.Type.NoProto || len(k.Type.Params) != 1 {
+		t.Errorf("expected the definition gives k the type int (int), but got %s", k.Type)
+	}
+}
+
+func TestConstExpr(t *testing.T) {
+	src := `int x;
+enum { K = sizeof x * 2, L };
+int a[L];
+int main() {
+  unsigned u = 0;
+  switch (x) { case (char)300: case K > 8 ? -1 : 1: break; }
+  switch (u) { case -1: break; }
+  return 0;
+}`
+	nodes, c := check(t, src)
+	for _, d := range c.Diags().All() {
+		t.Errorf("unexpected diagnostic %s", d.Msg)
+	}
+	if n := nodes[2].(*ast.ArrayDef).Type.Len; n != 9 {
+		t.Errorf("expected array length is 9, but got %d", n)
+	}
+	body := nodes[3].(*ast.FuncDef).Block
+	s := body.Nodes[1].(*ast.SwitchStmt)
+	if s.Cases[0].Value != 44 || s.Cases[1].Value != 1 {
+		t.Errorf("expected case values 44 and 1, but got %d and %d", s.Cases[0].Value, s.Cases[1].Value)
+	}
+	if v := body.Nodes[2].(*ast.SwitchStmt).Cases[0].Value; v != 4294967295 {
+		t.Errorf("expected case value 4294967295, but got %d", v)
+	}
+}
+
+func TestSizeofType(t *testing.T) {
+	src := `struct S { char c; int i; } s;
+int main() {
+  int a[5];
+  int x = sizeof a + sizeof s + sizeof(s.c) + _Alignof(struct S);
+  return sizeof x++;
+}`
+	nodes, c := check(t, src)
+	for _, d := range c.Diags().All() {
+		t.Errorf("unexpected diagnostic %s", d.Msg)
+	}
+	body := nodes[1].(*ast.FuncDef).Block
+	init := *body.Nodes[1].(*ast.VarDef).Init
+	if n, ok := ast.IntConst(init.(*ast.BinaryExpr).X.(*ast.BinaryExpr).X.(*ast.BinaryExpr).X); !ok || n != 20 {
+		t.Errorf("expected sizeof a is 20, but got %d", n)
+	}
+	ret := body.Nodes[2].(*ast.ReturnStmt).Expr.(*ast.SizeofExpr)
+	if ret.Type() != ast.ULongType || ret.Of.Kind != ast.C_int {
+		t.Errorf("expected sizeof x++ is the size of an int as unsigned long")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	src := `int a;
+int main() {
+  int a = 1;
+  { int a = 2; a = 3; }
+  return a;
+}`
+	nodes, c := check(t, src)
+	if c.Diags().Len() != 0 {
+		t.Fatalf("unexpected diagnostic %s", c.Diags().All()[0].Msg)
+	}
+
+	global := nodes[0].(*ast.VarDef).Obj
+	f := nodes[1].(*ast.FuncDef)
+	outer := f.Block.Nodes[0].(*ast.VarDef).Obj
+	block := f.Block.Nodes[1].(*ast.BlockStmt)
+	inner := block.Nodes[0].(*ast.VarDef).Obj
+
+	if global == outer || outer == inner {
+		t.Fatalf("expected each declaration has its own object")
+	}
+	assign := block.Nodes[1].(*ast.ExprStmt).Expr.(*ast.AssignExpr)
+	if assign.L.(*ast.Ident).Obj != inner {
+		t.Errorf("expected assignment refers to the innermost a")
+	}
+	ret := f.Block.Nodes[2].(*ast.ReturnStmt).Expr.(*ast.Ident)
+	if ret.Obj != outer {
+		t.Errorf("expected return refers to the outer a")
+	}
+}
+
+func TestExprType(t *testing.T) {
+	src := `int main() {
+  int a[3];
+  int *p = a + 1;
+  return *p - a[0] == 0;
+}`
+	nodes, c := check(t, src)
+	if c.Diags().Len() != 0 {
+		t.Fatalf("unexpected diagnostic %s", c.Diags().All()[0].Msg)
+	}
+	f := nodes[0].(*ast.FuncDef)
+	init := *f.Block.Nodes[1].(*ast.VarDef).Init
+	if ty := init.Type(); !ty.IsPtr() || ty.Elem().Kind != ast.C_int {
+		t.Errorf("expected type is int *, but got %s", ty)
+	}
+	ret := f.Block.Nodes[2].(*ast.ReturnStmt).Expr.(*ast.BinaryExpr)
+	if ty := ret.X.Type(); ty.Kind != ast.C_int {
+		t.Errorf("expected type is int, but got %s", ty)
+	}
+	if ty := ret.X.(*ast.BinaryExpr).X.Type(); ty.IsPtr() {
+		t.Errorf("expected type of *p is int, but got %s", ty)
+	}
+}
+
+func TestFuncPointer(t *testing.T) {
+	src := `int add(int a, int b) { return a + b; }
+int (*fp)(int, int) = add;
+int main() {
+  return (*fp)(1, 2) + (&add)(3, 4);
+}`
+	nodes, c := check(t, src)
+	if c.Diags().Len() != 0 {
+		t.Fatalf("unexpected diagnostic %s", c.Diags().All()[0].Msg)
+	}
+	if init := *nodes[1].(*ast.VarDef).Init; init.Type().String() != "int (int, int)" {
+		t.Errorf("expected add has type int (int, int), but got %s", init.Type())
+	}
+	ret := nodes[2].(*ast.FuncDef).Block.Nodes[0].(*ast.ReturnStmt).Expr.(*ast.BinaryExpr)
+	for _, call := range []ast.Expr{ret.X, ret.Y} {
+		f := call.(*ast.FuncCall).Func
+		if ty := f.Type().Decay(); !ty.IsPtr() || !ty.Base.IsFunc() || call.Type().Kind != ast.C_int {
+			t.Errorf("expected a call through int (*)(int, int), but got %s", ty)
+		}
+	}
+}
+
+func TestFloatType(t *testing.T) {
+	src := "int main() { float f = 1.5f; char c = 1; long l = 2; f * c; f + 2.0; l / f; -f; f < l; return 0; }"
+	nodes, c := check(t, src)
+	if c.Diags().Len() != 0 {
+		t.Fatalf("unexpected diagnostic %s", c.Diags().All()[0].Msg)
+	}
+	f := nodes[0].(*ast.FuncDef)
+	expects := []*ast.CType{ast.FloatType, ast.DoubleType, ast.FloatType, ast.FloatType, ast.IntType}
+	for i, expect := range expects {
+		e := f.Block.Nodes[3+i].(*ast.ExprStmt).Expr
+		if ty := e.Type(); !ast.Compatible(ty, expect) {
+			t.Errorf("statement %d: expected type is %s, but got %s", 3+i, expect, ty)
+		}
+	}
+}
+
+func TestLvalueType(t *testing.T) {
+	src := "int main() { int m[2][3]; int *p; int **pp; m[1]; m[1][2]; *(p + 1); 1[p]; (*pp)[0]; &m[0]; &m; return 0; }"
+	nodes, c := check(t, src)
+	if c.Diags().Len() != 0 {
+		t.Fatalf("unexpected error: %s", c.Diags().All()[0].Msg)
+	}
+	want := []string{"int [3]", "int", "int", "int", "int", "int (*)[3]", "int (*)[2][3]"}
+	stmts := nodes[0].(*ast.FuncDef).Block.Nodes[3:]
+	for i, w := range want {
+		e := stmts[i].(*ast.ExprStmt).Expr
+		if e.Type().String() != w {
+			t.Errorf("expected type of expression %d is %s, but got %s", i, w, e.Type())
+		}
+	}
+}
+
+func TestStringType(t *testing.T) {
+	nodes, c := check(t, `char s[] = "ab\n"; int main() { char *p = "xy" "z"; return 0; }`)
+	if c.Diags().Len() != 0 {
+		t.Fatalf("unexpected diagnostic %s", c.Diags().All()[0].Msg)
+	}
+	if ty := nodes[0].(*ast.ArrayDef).Type; ty.String() != "char [4]" {
+		t.Errorf("expected type is char [4], but got %s", ty)
+	}
+	init := *nodes[1].(*ast.FuncDef).Block.Nodes[0].(*ast.VarDef).Init
+	if ty := init.Type(); ty.String() != "char [4]" {
+		t.Errorf("expected type is char [4], but got %s", ty)
+	}
+}
+
+func TestRedeclaration(t *testing.T) {
+	src := `extern int a[];
+int f(int);
+int main() { return f(a[1]); }
+int a[3] = {1, 2, 3};
+int f(int x) { return x; }
+extern int a[];`
+	nodes, c := check(t, src)
+	if c.Diags().Len() != 0 {
+		t.Fatalf("unexpected diagnostic %s", c.Diags().All()[0].Msg)
+	}
+	obj := nodes[0].(*ast.ArrayDef).Obj
+	if nodes[3].(*ast.ArrayDef).Obj != obj || nodes[5].(*ast.ArrayDef).Obj != obj {
+		t.Errorf("expected declarations of a share one object")
+	}
+	if obj.Decl != nodes[3] || obj.Type.Len != 3 {
+		t.Errorf("expected a is defined with type int [3], but got %s", obj.Type)
+	}
+	fn := nodes[1].(*ast.FuncDef).Obj
+	call := nodes[2].(*ast.FuncDef).Block.Nodes[0].(*ast.ReturnStmt).Expr.(*ast.FuncCall)
+	if call.Func.(*ast.Ident).Obj != fn || nodes[4].(*ast.FuncDef).Obj != fn || fn.Decl != nodes[4] {
+		t.Errorf("expected declarations of f share one object")
+	}
+}
+
+func TestTentativeDefinition(t *testing.T) {
+	src := `int x; int x = 3; int x; static int y[2]; static int y[2]; int z = 1; int z;`
+	nodes, c := check(t, src)
+	if c.Diags().Len() != 0 {
+		t.Fatalf("unexpected diagnostic %s", c.Diags().All()[0].Msg)
+	}
+	if x := nodes[0].(*ast.VarDef).Obj; x.Decl != nodes[1] || nodes[2].(*ast.VarDef).Obj != x {
+		t.Errorf("expected x is defined by its initialized declaration")
+	}
+	if y := nodes[3].(*ast.ArrayDef).Obj; y.Decl != nodes[3] || nodes[4].(*ast.ArrayDef).Obj != y {
+		t.Errorf("expected y is defined by its first tentative definition")
+	}
+	if z := nodes[5].(*ast.VarDef).Obj; z.Decl != nodes[5] {
+		t.Errorf("expected z is defined by its initialized declaration")
+	}
+	_, c = check(t, "int a; int a = 1; int a = 2;")
+	if ds := c.Diags().All(); len(ds) != 1 || ds[0].Msg != "redefinition of 'a'" {
+		t.Errorf("expected a redefinition of a, but got %d diagnostics", len(ds))
+	}
+}
+
+func TestMemberType(t *testing.T) {
+	src := `struct S { char c; struct S *next; };
+int main() {
+  struct S s;
+  s.next = &s;
+  return s.next->c;
+}`
+	nodes, c := check(t, src)
+	if c.Diags().Len() != 0 {
+		t.Fatalf("unexpected diagnostic %s", c.Diags().All()[0].Msg)
+	}
+	f := nodes[1].(*ast.FuncDef)
+	ret := f.Block.Nodes[2].(*ast.ReturnStmt).Expr.(*ast.MemberExpr)
+	if ty := ret.Type(); ty.Kind != ast.C_char {
+		t.Errorf("expected type is char, but got %s", ty)
+	}
+	if ret.Field == nil || ret.Field.Offset != 0 {
+		t.Errorf("expected member c at offset 0")
+	}
+	if ty := ret.X.Type(); !ty.IsPtr() || !ty.Elem().IsStruct() || ty.Elem().Struct.Fields[1].Offset != 8 {
+		t.Errorf("expected type is struct S *, but got %s", ty)
+	}
+}
@@ -3,6 +3,10 @@ ASM=asm
 OUT=a.out
 TESTFILE=testfile
 APP=app
+TARGET=
+if [ "$(uname)" = Darwin ]; then
+  TARGET="-target x86_64-apple-darwin"
+fi
 
 RED='\033[0;31m'
 GREEN='\033[0;32m'
@@ -43,7 +47,7 @@ test() {
     exit 1
   fi
   ASM_FILE="${ASM}/${1}.s"
-  ./$APP -S -o $ASM_FILE $FILE || return
+  ./$APP $TARGET -S -o $ASM_FILE $FILE || return
   gcc $ASM_FILE -o $OUT
   ./$OUT
   res=$?
@@ -66,29 +70,61 @@ test var_def 4
 test var_def_expr 20
 test var_def_2 7
 test var_def_3 43
+test global 37
 
 test call_no_arg 11
 test call_2_args 3
 test call_10_args 110
+test stdarg 149
+test funcptr 95
 
 test char 98
 test char_arg 195
 test char_int_args 118
+test string 107
+test printf 28
+test abi 32
+test unsigned 39
+test bool 15
+test float 24
+test literal 17
+test enum 20
+test decl 82
+test cast 0
+test const 0
 
 test pointer 3
 test pointer2 20
+test pointer_pointer 11
 
 test array 16
+test lvalue 61
 
 test if_stmt 1
 test if_else 10
 test if_else_if 1
 test if_binaries 5
+test bitwise 63
+test unary 75
+test compound 144
+test cond 66
 
 test inc_dec 11
 test inc_pointer 1
 
 test for_stmt 10
+test while 45
+test do_while 30
+test break_continue 31
+test switch 85
+test switch_table 85
+test goto 36
+
+test macro 15
+
+test struct 25
+test struct_arg 48
+test init 17
 
 echo "Finished test."
 FAILED=$(( COUNT - PASSED ))
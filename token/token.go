@@ -1,6 +1,7 @@
 package token
 
 type Position struct {
+	File   string // set by line markers of the preprocessor
 	Line   int
 	Column int
 	Offset int
@@ -20,6 +21,26 @@ func (t Token) String() string {
 	return string(t.Str)
 }
 
+// End returns the position just after the last byte of the token.
+func (t Token) End() Position {
+	p := t.Pos
+	p.Column += len(t.Str)
+	p.Offset += len(t.Str)
+	return p
+}
+
+// Describe returns the token as it should appear in a diagnostic message.
+func (t Token) Describe() string {
+	switch t.Kind {
+	case EOF:
+		return "end of file"
+	case IDENT:
+		return "identifier '" + t.String() + "'"
+	default:
+		return "'" + t.String() + "'"
+	}
+}
+
 type TokenKind int
 
 const (
@@ -38,6 +59,7 @@ const (
 	LONG
 	SHORT
 	DOUBLE
+	BOOL
 
 	// keyword
 	DO
@@ -65,6 +87,7 @@ const (
 	UNION
 	VOLATILE
 	ENUM
+	ALIGNOF
 
 	// operator
 	ADD   // +
@@ -140,6 +163,7 @@ func (k TokenKind) String() string {
 		LONG:   "LONG",
 		SHORT:  "SHORT",
 		DOUBLE: "DOUBLE",
+		BOOL:   "BOOL",
 
 		DO:       "DO",
 		WHILE:    "WHILE",
@@ -166,6 +190,7 @@ func (k TokenKind) String() string {
 		UNION:    "UNION",
 		VOLATILE: "VOLATILE",
 		ENUM:     "ENUM",
+		ALIGNOF:  "ALIGNOF",
 
 		ADD:   "ADD",
 		SUB:   "SUB",
@@ -223,3 +248,115 @@ func (k TokenKind) String() string {
 		UNKNOWN: "UNKNOWN",
 	}[k]
 }
+
+// Symbol returns the source spelling of fixed tokens such as ';' or 'int',
+// and a short description for the token classes that have no fixed spelling.
+func (k TokenKind) Symbol() string {
+	switch k {
+	case IDENT:
+		return "identifier"
+	case INT_CONST, FLOAT_CONST:
+		return "number"
+	case STRING_CONST:
+		return "string literal"
+	case CHAR_CONST:
+		return "character constant"
+	case EOF:
+		return "end of file"
+	case COMMENT, UNKNOWN:
+		return k.String()
+	}
+	if s, ok := symbols[k]; ok {
+		return "'" + s + "'"
+	}
+	return k.String()
+}
+
+var symbols = map[TokenKind]string{
+	INT:    "int",
+	VOID:   "void",
+	CHAR:   "char",
+	FLOAT:  "float",
+	LONG:   "long",
+	SHORT:  "short",
+	DOUBLE: "double",
+	BOOL:   "_Bool",
+
+	DO:       "do",
+	WHILE:    "while",
+	IF:       "if",
+	ELSE:     "else",
+	FOR:      "for",
+	AUTO:     "auto",
+	RETURN:   "return",
+	SWITCH:   "switch",
+	CASE:     "case",
+	DEFAULT:  "default",
+	CONTINUE: "continue",
+	BREAK:    "break",
+	GOTO:     "goto",
+	CONST:    "const",
+	EXTERN:   "extern",
+	REGISTER: "register",
+	SIGNED:   "signed",
+	UNSIGNED: "unsigned",
+	SIZEOF:   "sizeof",
+	STATIC:   "static",
+	STRUCT:   "struct",
+	TYPEDEF:  "typedef",
+	UNION:    "union",
+	VOLATILE: "volatile",
+	ENUM:     "enum",
+	ALIGNOF:  "_Alignof",
+
+	ADD:   "+",
+	SUB:   "-",
+	MUL:   "*",
+	DIV:   "/",
+	REM:   "%",
+	AND:   "&",
+	OR:    "|",
+	QUE:   "?",
+	NOT:   "!",
+	XOR:   "^",
+	TILDE: "~",
+
+	ADD_ASSIGN:   "+=",
+	SUB_ASSIGN:   "-=",
+	MUL_ASSIGN:   "*=",
+	DIV_ASSIGN:   "/=",
+	REM_ASSIGN:   "%=",
+	RIGHT_ASSIGN: ">>=",
+	LEFT_ASSIGN:  "<<=",
+	AND_ASSIGN:   "&=",
+	OR_ASSIGN:    "|=",
+	XOR_ASSIGN:   "^=",
+
+	LSHIFT: "<<",
+	RSHIFT: ">>",
+	ARROW:  "->",
+	LAND:   "&&",
+	LOR:    "||",
+	INC:    "++",
+	DEC:    "--",
+	EQ:     "==",
+	LT:     "<",
+	GT:     ">",
+	ASSIGN: "=",
+	NE:     "!=",
+	LE:     "<=",
+	GE:     ">=",
+
+	LPAREN:   "(",
+	LBRACK:   "[",
+	LBRACE:   "{",
+	COMMA:    ",",
+	PERIOD:   ".",
+	ELLIPSIS: "...",
+
+	RPAREN:    ")",
+	RBRACK:    "]",
+	RBRACE:    "}",
+	SEMICOLON: ";",
+	COLON:     ":",
+}